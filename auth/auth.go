@@ -4,12 +4,71 @@
 
 package auth
 
+import (
+	"context"
+	"time"
+)
+
 // AuthenticateFunc is a function type that is responsible to authenticate
 // the input token. It is an auth middleware that should be implemented by
 // the client to validate user token before subscribing to a private channel
 // and sending the message to a private channel.
+//
+// AuthenticateFunc implements the Authenticator interface and ignores the
+// input context.
 type AuthenticateFunc func(token string) (*Token, error)
 
+// Authenticate calls the function with the input token.
+func (f AuthenticateFunc) Authenticate(_ context.Context, token string) (*Token, error) {
+	return f(token)
+}
+
+// Authenticator is responsible to authenticate the input token. It should be
+// implemented by the client to validate user token before subscribing to a
+// private channel and sending the message to a private channel.
+//
+// The input context is cancelled if the authentication takes longer than the
+// configured timeout.
+type Authenticator interface {
+	Authenticate(ctx context.Context, token string) (*Token, error)
+}
+
+// AuthenticatorFunc is an adapter to use ordinary functions as Authenticator.
+type AuthenticatorFunc func(ctx context.Context, token string) (*Token, error)
+
+// Authenticate calls the function with the input context and token.
+func (f AuthenticatorFunc) Authenticate(ctx context.Context, token string) (*Token, error) {
+	return f(ctx, token)
+}
+
+// WithTimeout wraps the input Authenticator and cancels the authentication
+// context after the input timeout.
+func WithTimeout(authenticator Authenticator, timeout time.Duration) Authenticator {
+	return AuthenticatorFunc(func(ctx context.Context, token string) (*Token, error) {
+		ctx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+
+		return authenticator.Authenticate(ctx, token)
+	})
+}
+
+// Authorizer decides whether an authenticated user can access a channel. It
+// returns nil if the access is allowed. Otherwise, returns an error.
+//
+// It is called only for the private channels, since the public channels are
+// available to the anonymous connections that don't have any token.
+type Authorizer interface {
+	Authorize(ctx context.Context, token *Token, channel string) error
+}
+
+// AuthorizerFunc is an adapter to use ordinary functions as Authorizer.
+type AuthorizerFunc func(ctx context.Context, token *Token, channel string) error
+
+// Authorize calls the function with the input context, token, and channel.
+func (f AuthorizerFunc) Authorize(ctx context.Context, token *Token, channel string) error {
+	return f(ctx, token, channel)
+}
+
 // Token represent the client websocket token details.
 type Token struct {
 	// Token represents client websocket token that sends it via the MessageIn.
@@ -21,4 +80,23 @@ type Token struct {
 	// ExpiresAt represents Token expiration time. The value of ExpiresAt is
 	// unix seconds.
 	ExpiresAt int64
+
+	// Scopes represents the list of permissions of the Token, e.g. the channels
+	// that the user can access.
+	Scopes []string
+
+	// Claims represents the other details of the Token that the Authenticator
+	// extracted from it.
+	Claims map[string]interface{}
+}
+
+// HasScope returns true if the Token has the input scope.
+func (t *Token) HasScope(scope string) bool {
+	for _, s := range t.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+
+	return false
 }
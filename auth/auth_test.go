@@ -0,0 +1,57 @@
+/**
+ * Copyright © 2022 Hamed Yousefi <hdyousefi@gmail.com>.
+ */
+
+package auth
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuthenticateFunc_Authenticate(t *testing.T) {
+	expectedToken := &Token{Token: testToken, UserID: "test-user-id"}
+	authFunc := AuthenticateFunc(func(token string) (*Token, error) {
+		assert.Equal(t, testToken, token)
+		return expectedToken, nil
+	})
+
+	token, err := authFunc.Authenticate(context.Background(), testToken)
+	require.Nil(t, err)
+	assert.Equal(t, expectedToken, token)
+}
+
+func TestWithTimeout(t *testing.T) {
+	authenticator := WithTimeout(AuthenticatorFunc(func(ctx context.Context, _ string) (*Token, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}), time.Millisecond)
+
+	token, err := authenticator.Authenticate(context.Background(), testToken)
+	assert.Nil(t, token)
+	assert.Equal(t, context.DeadlineExceeded, err)
+}
+
+func TestToken_HasScope(t *testing.T) {
+	token := &Token{Scopes: []string{"orders", "trades"}}
+	assert.True(t, token.HasScope("orders"))
+	assert.True(t, token.HasScope("trades"))
+	assert.False(t, token.HasScope("admin-alerts"))
+}
+
+func TestScopeAuthorizer(t *testing.T) {
+	ctx := context.Background()
+	authorizer := ScopeAuthorizer()
+
+	token := &Token{Scopes: []string{"orders"}}
+	assert.Nil(t, authorizer.Authorize(ctx, token, "orders"))
+	assert.Equal(t, ErrAccessDenied, authorizer.Authorize(ctx, token, "admin-alerts"))
+	assert.Equal(t, ErrAccessDenied, authorizer.Authorize(ctx, nil, "orders"))
+
+	admin := &Token{Scopes: []string{ScopeAllChannels}}
+	assert.Nil(t, authorizer.Authorize(ctx, admin, "admin-alerts"))
+}
@@ -0,0 +1,33 @@
+/**
+ * Copyright © 2022 Hamed Yousefi <hdyousefi@gmail.com>.
+ */
+
+package auth
+
+import (
+	"context"
+	"errors"
+)
+
+const (
+	// ScopeAllChannels is a scope that gives access to all the channels.
+	ScopeAllChannels = "*"
+)
+
+var (
+	// ErrAccessDenied is returned by the built-in authorizers if the user
+	// doesn't have access to the channel.
+	ErrAccessDenied = errors.New("access denied")
+)
+
+// ScopeAuthorizer creates an Authorizer that allows access to a channel if the
+// token scopes include the channel name or ScopeAllChannels.
+func ScopeAuthorizer() Authorizer {
+	return AuthorizerFunc(func(_ context.Context, token *Token, channel string) error {
+		if token != nil && (token.HasScope(channel) || token.HasScope(ScopeAllChannels)) {
+			return nil
+		}
+
+		return ErrAccessDenied
+	})
+}
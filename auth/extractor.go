@@ -0,0 +1,67 @@
+/**
+ * Copyright © 2022 Hamed Yousefi <hdyousefi@gmail.com>.
+ */
+
+package auth
+
+import (
+	"net/http"
+	"strings"
+)
+
+const (
+	bearerPrefix = "bearer "
+)
+
+// TokenExtractor is a function type that extracts the auth token from the
+// websocket upgrade request. It returns an empty string if the request
+// doesn't contain a token.
+type TokenExtractor func(r *http.Request) string
+
+// FromHeader creates a TokenExtractor that reads the token from the input
+// header. It removes the "Bearer " prefix if it exists, so it can be used
+// with the Authorization header.
+func FromHeader(name string) TokenExtractor {
+	return func(r *http.Request) string {
+		value := strings.TrimSpace(r.Header.Get(name))
+		if len(value) > len(bearerPrefix) && strings.EqualFold(value[:len(bearerPrefix)], bearerPrefix) {
+			value = strings.TrimSpace(value[len(bearerPrefix):])
+		}
+
+		return value
+	}
+}
+
+// FromCookie creates a TokenExtractor that reads the token from the input cookie.
+func FromCookie(name string) TokenExtractor {
+	return func(r *http.Request) string {
+		cookie, err := r.Cookie(name)
+		if err != nil {
+			return ""
+		}
+
+		return strings.TrimSpace(cookie.Value)
+	}
+}
+
+// FromQuery creates a TokenExtractor that reads the token from the input
+// URL query parameter.
+func FromQuery(param string) TokenExtractor {
+	return func(r *http.Request) string {
+		return strings.TrimSpace(r.URL.Query().Get(param))
+	}
+}
+
+// FromFirst creates a TokenExtractor that returns the first non-empty token
+// of the input extractors.
+func FromFirst(extractors ...TokenExtractor) TokenExtractor {
+	return func(r *http.Request) string {
+		for _, extractor := range extractors {
+			if token := extractor(r); token != "" {
+				return token
+			}
+		}
+
+		return ""
+	}
+}
@@ -0,0 +1,67 @@
+/**
+ * Copyright © 2022 Hamed Yousefi <hdyousefi@gmail.com>.
+ */
+
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	testToken = "test-auth-token" // nolint
+)
+
+func TestFromHeader(t *testing.T) {
+	extractor := FromHeader("Authorization")
+
+	t.Run("bearer token", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodGet, "/ws", nil)
+		r.Header.Set("Authorization", "Bearer "+testToken)
+		assert.Equal(t, testToken, extractor(r))
+	})
+
+	t.Run("raw token", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodGet, "/ws", nil)
+		r.Header.Set("Authorization", testToken)
+		assert.Equal(t, testToken, extractor(r))
+	})
+
+	t.Run("missing header", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodGet, "/ws", nil)
+		assert.Empty(t, extractor(r))
+	})
+}
+
+func TestFromCookie(t *testing.T) {
+	extractor := FromCookie("token")
+
+	r := httptest.NewRequest(http.MethodGet, "/ws", nil)
+	assert.Empty(t, extractor(r))
+
+	r.AddCookie(&http.Cookie{Name: "token", Value: testToken})
+	assert.Equal(t, testToken, extractor(r))
+}
+
+func TestFromQuery(t *testing.T) {
+	extractor := FromQuery("token")
+
+	assert.Empty(t, extractor(httptest.NewRequest(http.MethodGet, "/ws", nil)))
+	assert.Equal(t, testToken, extractor(httptest.NewRequest(http.MethodGet, "/ws?token="+testToken, nil)))
+}
+
+func TestFromFirst(t *testing.T) {
+	extractor := FromFirst(FromHeader("Authorization"), FromQuery("token"))
+
+	r := httptest.NewRequest(http.MethodGet, "/ws?token=query-token", nil)
+	assert.Equal(t, "query-token", extractor(r))
+
+	r.Header.Set("Authorization", "Bearer "+testToken)
+	assert.Equal(t, testToken, extractor(r))
+
+	assert.Empty(t, extractor(httptest.NewRequest(http.MethodGet, "/ws", nil)))
+}
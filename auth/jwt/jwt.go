@@ -0,0 +1,296 @@
+/**
+ * Copyright © 2022 Hamed Yousefi <hdyousefi@gmail.com>.
+ */
+
+// Package jwt provides a built-in authenticator that validates JSON Web Tokens
+// signed with HS256, RS256, or ES256 algorithms.
+package jwt
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/hmdsefi/channelize/auth"
+	"github.com/hmdsefi/channelize/internal/common/utils"
+)
+
+const (
+	claimSubject   = "sub"
+	claimExpiresAt = "exp"
+	claimNotBefore = "nbf"
+	claimIssuer    = "iss"
+	claimAudience  = "aud"
+
+	es256KeySize = 32
+)
+
+var (
+	ErrMalformedToken       = errors.New("jwt: malformed token")
+	ErrUnsupportedAlgorithm = errors.New("jwt: unsupported algorithm")
+	ErrKeyNotFound          = errors.New("jwt: verification key not found")
+	ErrInvalidSignature     = errors.New("jwt: invalid signature")
+	ErrMissingSubject       = errors.New("jwt: sub claim is missing")
+	ErrMissingExpiration    = errors.New("jwt: exp claim is missing")
+	ErrTokenExpired         = errors.New("jwt: token is expired")
+	ErrTokenNotValidYet     = errors.New("jwt: token is not valid yet")
+	ErrInvalidIssuer        = errors.New("jwt: invalid issuer")
+	ErrInvalidAudience      = errors.New("jwt: invalid audience")
+)
+
+// Config represents the Authenticator configuration.
+type Config struct {
+	// leeway represents the allowed clock skew for validating the time claims.
+	leeway time.Duration
+
+	// scopeClaims represents the claims that are mapped to the token scopes.
+	scopeClaims []string
+
+	// issuer represents the expected iss claim. Empty means any issuer.
+	issuer string
+
+	// audience represents the expected aud claim. Empty means any audience.
+	audience string
+}
+
+type Option func(*Config)
+
+// WithLeeway sets the allowed clock skew for validating the exp and nbf claims.
+func WithLeeway(leeway time.Duration) Option {
+	return func(config *Config) {
+		config.leeway = leeway
+	}
+}
+
+// WithScopeClaims sets the claims that are mapped to the auth.Token scopes.
+// A claim can be a space separated string, e.g. "scope", or an array of strings.
+func WithScopeClaims(claims ...string) Option {
+	return func(config *Config) {
+		config.scopeClaims = claims
+	}
+}
+
+// WithIssuer sets the expected iss claim.
+func WithIssuer(issuer string) Option {
+	return func(config *Config) {
+		config.issuer = issuer
+	}
+}
+
+// WithAudience sets the expected aud claim.
+func WithAudience(audience string) Option {
+	return func(config *Config) {
+		config.audience = audience
+	}
+}
+
+// Authenticator validates the JWT signature and claims. It maps the sub claim
+// to the auth.Token UserID, the exp claim to the auth.Token ExpiresAt, and the
+// configured scope claims to the auth.Token Scopes.
+//
+// Authenticator implements the auth.Authenticator interface.
+type Authenticator struct {
+	keys   *KeySet
+	config Config
+	now    func() time.Time
+}
+
+// NewAuthenticator creates a new Authenticator that verifies the tokens with
+// the input key set.
+func NewAuthenticator(keys *KeySet, options ...Option) *Authenticator {
+	config := new(Config)
+	for _, option := range options {
+		option(config)
+	}
+
+	return &Authenticator{
+		keys:   keys,
+		config: *config,
+		now:    utils.Now,
+	}
+}
+
+// AuthenticateFunc returns an auth.AuthenticateFunc that validates the tokens.
+func (a *Authenticator) AuthenticateFunc() auth.AuthenticateFunc {
+	return func(token string) (*auth.Token, error) {
+		return a.Authenticate(context.Background(), token)
+	}
+}
+
+type header struct {
+	Algorithm string `json:"alg"`
+	KeyID     string `json:"kid"`
+}
+
+// Authenticate validates the input token and returns its details.
+func (a *Authenticator) Authenticate(_ context.Context, token string) (*auth.Token, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrMalformedToken
+	}
+
+	var h header
+	if err := decodeJSON(parts[0], &h); err != nil {
+		return nil, err
+	}
+
+	signature, err := decodeSegment(parts[2])
+	if err != nil {
+		return nil, ErrMalformedToken
+	}
+
+	if err = a.verify(h, []byte(parts[0]+"."+parts[1]), signature); err != nil {
+		return nil, err
+	}
+
+	claims := make(map[string]interface{})
+	if err = decodeJSON(parts[1], &claims); err != nil {
+		return nil, err
+	}
+
+	return a.validateClaims(token, claims)
+}
+
+// verify verifies the signature with the keys that match the header.
+func (a *Authenticator) verify(h header, signed, signature []byte) error {
+	switch h.Algorithm {
+	case AlgorithmHS256, AlgorithmRS256, AlgorithmES256:
+	default:
+		return ErrUnsupportedAlgorithm
+	}
+
+	keys := a.keys.find(h.KeyID, h.Algorithm)
+	if len(keys) == 0 {
+		return ErrKeyNotFound
+	}
+
+	digest := sha256.Sum256(signed)
+	for _, key := range keys {
+		if verifySignature(key, signed, digest[:], signature) {
+			return nil
+		}
+	}
+
+	return ErrInvalidSignature
+}
+
+func verifySignature(key Key, signed, digest, signature []byte) bool {
+	switch k := key.key.(type) {
+	case []byte:
+		mac := hmac.New(sha256.New, k)
+		mac.Write(signed)
+		return hmac.Equal(signature, mac.Sum(nil))
+	case *rsa.PublicKey:
+		return rsa.VerifyPKCS1v15(k, crypto.SHA256, digest, signature) == nil
+	case *ecdsa.PublicKey:
+		if len(signature) != 2*es256KeySize {
+			return false
+		}
+
+		r := new(big.Int).SetBytes(signature[:es256KeySize])
+		s := new(big.Int).SetBytes(signature[es256KeySize:])
+		return ecdsa.Verify(k, digest, r, s)
+	default:
+		return false
+	}
+}
+
+// validateClaims validates the registered claims and creates the auth.Token.
+func (a *Authenticator) validateClaims(token string, claims map[string]interface{}) (*auth.Token, error) {
+	subject, _ := claims[claimSubject].(string)
+	if strings.TrimSpace(subject) == "" {
+		return nil, ErrMissingSubject
+	}
+
+	expiresAt, ok := claims[claimExpiresAt].(float64)
+	if !ok {
+		return nil, ErrMissingExpiration
+	}
+
+	now := a.now()
+	leeway := int64(a.config.leeway.Seconds())
+
+	// extend the expiration time with the leeway to keep the auth.Token
+	// ExpiresAt consistent with the validation.
+	exp := int64(expiresAt) + leeway
+	if now.Unix() > exp {
+		return nil, ErrTokenExpired
+	}
+
+	if notBefore, ok := claims[claimNotBefore].(float64); ok && now.Unix()+leeway < int64(notBefore) {
+		return nil, ErrTokenNotValidYet
+	}
+
+	if a.config.issuer != "" {
+		if issuer, _ := claims[claimIssuer].(string); issuer != a.config.issuer {
+			return nil, ErrInvalidIssuer
+		}
+	}
+
+	if a.config.audience != "" && !containsString(claimStrings(claims[claimAudience]), a.config.audience) {
+		return nil, ErrInvalidAudience
+	}
+
+	var scopes []string
+	for _, claim := range a.config.scopeClaims {
+		scopes = append(scopes, claimStrings(claims[claim])...)
+	}
+
+	return &auth.Token{
+		Token:     token,
+		UserID:    subject,
+		ExpiresAt: exp,
+		Scopes:    scopes,
+		Claims:    claims,
+	}, nil
+}
+
+// claimStrings converts a claim value to a list of strings. A string value
+// is split by spaces.
+func claimStrings(value interface{}) []string {
+	switch v := value.(type) {
+	case string:
+		return strings.Fields(v)
+	case []interface{}:
+		out := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				out = append(out, s)
+			}
+		}
+		return out
+	default:
+		return nil
+	}
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+func decodeJSON(segment string, out interface{}) error {
+	data, err := decodeSegment(segment)
+	if err != nil {
+		return ErrMalformedToken
+	}
+
+	if err = json.Unmarshal(data, out); err != nil {
+		return ErrMalformedToken
+	}
+
+	return nil
+}
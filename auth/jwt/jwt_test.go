@@ -0,0 +1,330 @@
+/**
+ * Copyright © 2022 Hamed Yousefi <hdyousefi@gmail.com>.
+ */
+
+package jwt
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/hmdsefi/channelize/internal/common/utils"
+	"github.com/hmdsefi/channelize/log"
+)
+
+const (
+	testUserID = "test-user-id"
+	testKeyID  = "test-key-id"
+)
+
+var (
+	testSecret = []byte("test-secret")
+)
+
+type testKeys struct {
+	rsa   *rsa.PrivateKey
+	ecdsa *ecdsa.PrivateKey
+}
+
+func generateKeys(t *testing.T) testKeys {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.Nil(t, err)
+
+	ecdsaKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.Nil(t, err)
+
+	return testKeys{rsa: rsaKey, ecdsa: ecdsaKey}
+}
+
+func encodeSegment(t *testing.T, value interface{}) string {
+	data, err := json.Marshal(value)
+	require.Nil(t, err)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// sign creates a signed JWT with the input algorithm, key, and claims.
+func sign(t *testing.T, algorithm, keyID string, key interface{}, claims map[string]interface{}) string {
+	h := map[string]string{"alg": algorithm, "typ": "JWT"}
+	if keyID != "" {
+		h["kid"] = keyID
+	}
+
+	signed := encodeSegment(t, h) + "." + encodeSegment(t, claims)
+	digest := sha256.Sum256([]byte(signed))
+
+	var signature []byte
+	switch k := key.(type) {
+	case []byte:
+		mac := hmac.New(sha256.New, k)
+		mac.Write([]byte(signed))
+		signature = mac.Sum(nil)
+	case *rsa.PrivateKey:
+		var err error
+		signature, err = rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, digest[:])
+		require.Nil(t, err)
+	case *ecdsa.PrivateKey:
+		r, s, err := ecdsa.Sign(rand.Reader, k, digest[:])
+		require.Nil(t, err)
+		signature = make([]byte, 2*es256KeySize)
+		r.FillBytes(signature[:es256KeySize])
+		s.FillBytes(signature[es256KeySize:])
+	}
+
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func validClaims() map[string]interface{} {
+	return map[string]interface{}{
+		"sub":   testUserID,
+		"exp":   utils.Now().Add(time.Hour).Unix(),
+		"scope": "orders trades",
+	}
+}
+
+func TestAuthenticator_Authenticate(t *testing.T) {
+	ctx := context.Background()
+	keys := generateKeys(t)
+
+	authenticator := NewAuthenticator(
+		NewKeySet(
+			NewHMACKey("", testSecret),
+			NewRSAKey(testKeyID, &keys.rsa.PublicKey),
+			NewECDSAKey(testKeyID, &keys.ecdsa.PublicKey),
+		),
+		WithScopeClaims("scope"),
+	)
+
+	for algorithm, key := range map[string]interface{}{
+		AlgorithmHS256: testSecret,
+		AlgorithmRS256: keys.rsa,
+		AlgorithmES256: keys.ecdsa,
+	} {
+		algorithm, key := algorithm, key
+		t.Run("valid "+algorithm+" token", func(t *testing.T) {
+			claims := validClaims()
+			token := sign(t, algorithm, testKeyID, key, claims)
+
+			authToken, err := authenticator.Authenticate(ctx, token)
+			require.Nil(t, err)
+			assert.Equal(t, token, authToken.Token)
+			assert.Equal(t, testUserID, authToken.UserID)
+			assert.Equal(t, claims["exp"], authToken.ExpiresAt)
+			assert.Equal(t, []string{"orders", "trades"}, authToken.Scopes)
+			assert.Equal(t, testUserID, authToken.Claims["sub"])
+		})
+	}
+
+	t.Run("authenticate func", func(t *testing.T) {
+		authToken, err := authenticator.AuthenticateFunc()(sign(t, AlgorithmHS256, "", testSecret, validClaims()))
+		require.Nil(t, err)
+		assert.Equal(t, testUserID, authToken.UserID)
+	})
+
+	t.Run("invalid signature", func(t *testing.T) {
+		otherKeys := generateKeys(t)
+		_, err := authenticator.Authenticate(ctx, sign(t, AlgorithmRS256, testKeyID, otherKeys.rsa, validClaims()))
+		assert.Equal(t, ErrInvalidSignature, err)
+
+		_, err = authenticator.Authenticate(ctx, sign(t, AlgorithmHS256, "", []byte("other-secret"), validClaims()))
+		assert.Equal(t, ErrInvalidSignature, err)
+	})
+
+	t.Run("unknown key id", func(t *testing.T) {
+		_, err := authenticator.Authenticate(ctx, sign(t, AlgorithmRS256, "unknown", keys.rsa, validClaims()))
+		assert.Equal(t, ErrKeyNotFound, err)
+	})
+
+	t.Run("unsupported algorithm", func(t *testing.T) {
+		token := encodeSegment(t, map[string]string{"alg": "none"}) + "." + encodeSegment(t, validClaims()) + "."
+		_, err := authenticator.Authenticate(ctx, token)
+		assert.Equal(t, ErrUnsupportedAlgorithm, err)
+	})
+
+	t.Run("algorithm confusion", func(t *testing.T) {
+		// sign a HS256 token with the RSA public key as the shared secret.
+		publicKey := keys.rsa.PublicKey.N.Bytes()
+		_, err := authenticator.Authenticate(ctx, sign(t, AlgorithmHS256, testKeyID, publicKey, validClaims()))
+		assert.NotNil(t, err)
+	})
+
+	t.Run("malformed token", func(t *testing.T) {
+		for _, token := range []string{"", "a.b", "a.b.c", "!!.??.**"} {
+			_, err := authenticator.Authenticate(ctx, token)
+			assert.Equal(t, ErrMalformedToken, err, token)
+		}
+	})
+
+	t.Run("missing subject", func(t *testing.T) {
+		claims := validClaims()
+		delete(claims, "sub")
+		_, err := authenticator.Authenticate(ctx, sign(t, AlgorithmHS256, "", testSecret, claims))
+		assert.Equal(t, ErrMissingSubject, err)
+	})
+
+	t.Run("missing expiration", func(t *testing.T) {
+		claims := validClaims()
+		delete(claims, "exp")
+		_, err := authenticator.Authenticate(ctx, sign(t, AlgorithmHS256, "", testSecret, claims))
+		assert.Equal(t, ErrMissingExpiration, err)
+	})
+
+	t.Run("expired token", func(t *testing.T) {
+		claims := validClaims()
+		claims["exp"] = utils.Now().Add(-time.Minute).Unix()
+		_, err := authenticator.Authenticate(ctx, sign(t, AlgorithmHS256, "", testSecret, claims))
+		assert.Equal(t, ErrTokenExpired, err)
+	})
+
+	t.Run("not valid yet", func(t *testing.T) {
+		claims := validClaims()
+		claims["nbf"] = utils.Now().Add(time.Minute).Unix()
+		_, err := authenticator.Authenticate(ctx, sign(t, AlgorithmHS256, "", testSecret, claims))
+		assert.Equal(t, ErrTokenNotValidYet, err)
+	})
+}
+
+func TestAuthenticator_Leeway(t *testing.T) {
+	ctx := context.Background()
+	authenticator := NewAuthenticator(NewKeySet(NewHMACKey("", testSecret)), WithLeeway(2*time.Minute))
+
+	now := utils.Now()
+	authenticator.now = func() time.Time { return now }
+
+	claims := validClaims()
+	claims["exp"] = now.Add(-time.Minute).Unix()
+	claims["nbf"] = now.Add(time.Minute).Unix()
+
+	authToken, err := authenticator.Authenticate(ctx, sign(t, AlgorithmHS256, "", testSecret, claims))
+	require.Nil(t, err)
+	assert.Equal(t, now.Add(time.Minute).Unix(), authToken.ExpiresAt)
+
+	now = now.Add(2 * time.Minute)
+	_, err = authenticator.Authenticate(ctx, sign(t, AlgorithmHS256, "", testSecret, claims))
+	assert.Equal(t, ErrTokenExpired, err)
+}
+
+func TestAuthenticator_IssuerAndAudience(t *testing.T) {
+	ctx := context.Background()
+	authenticator := NewAuthenticator(
+		NewKeySet(NewHMACKey("", testSecret)),
+		WithIssuer("test-issuer"),
+		WithAudience("channelize"),
+		WithScopeClaims("channels"),
+	)
+
+	claims := validClaims()
+	claims["iss"] = "test-issuer"
+	claims["aud"] = []string{"api", "channelize"}
+	claims["channels"] = []string{"orders"}
+
+	authToken, err := authenticator.Authenticate(ctx, sign(t, AlgorithmHS256, "", testSecret, claims))
+	require.Nil(t, err)
+	assert.Equal(t, []string{"orders"}, authToken.Scopes)
+
+	claims["aud"] = "api"
+	_, err = authenticator.Authenticate(ctx, sign(t, AlgorithmHS256, "", testSecret, claims))
+	assert.Equal(t, ErrInvalidAudience, err)
+
+	claims["iss"] = "other-issuer"
+	_, err = authenticator.Authenticate(ctx, sign(t, AlgorithmHS256, "", testSecret, claims))
+	assert.Equal(t, ErrInvalidIssuer, err)
+}
+
+func TestLoadJWKS(t *testing.T) {
+	ctx := context.Background()
+	keys := generateKeys(t)
+
+	encodeInt := func(i *big.Int) string {
+		return base64.RawURLEncoding.EncodeToString(i.Bytes())
+	}
+
+	jwks := map[string]interface{}{
+		"keys": []map[string]string{
+			{
+				"kty": "RSA",
+				"kid": "rsa-key",
+				"alg": AlgorithmRS256,
+				"n":   encodeInt(keys.rsa.N),
+				"e":   encodeInt(big.NewInt(int64(keys.rsa.E))),
+			},
+			{
+				"kty": "EC",
+				"kid": "ec-key",
+				"crv": "P-256",
+				"x":   encodeInt(keys.ecdsa.X),
+				"y":   encodeInt(keys.ecdsa.Y),
+			},
+			{
+				"kty": "oct",
+				"kid": "hmac-key",
+				"k":   base64.RawURLEncoding.EncodeToString(testSecret),
+			},
+			{
+				"kty": "RSA",
+				"use": "enc",
+			},
+		},
+	}
+
+	data, err := json.Marshal(jwks)
+	require.Nil(t, err)
+
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	require.Nil(t, os.WriteFile(path, data, 0o600))
+
+	keySet, err := LoadJWKS(path)
+	require.Nil(t, err)
+	require.Len(t, keySet.keys, 3)
+
+	authenticator := NewAuthenticator(keySet)
+	for _, token := range []string{
+		sign(t, AlgorithmRS256, "rsa-key", keys.rsa, validClaims()),
+		sign(t, AlgorithmES256, "ec-key", keys.ecdsa, validClaims()),
+		sign(t, AlgorithmHS256, "hmac-key", testSecret, validClaims()),
+	} {
+		authToken, err := authenticator.Authenticate(ctx, token)
+		require.Nil(t, err)
+		assert.Equal(t, testUserID, authToken.UserID)
+	}
+
+	t.Run("missing file", func(t *testing.T) {
+		_, err := LoadJWKS(filepath.Join(t.TempDir(), "missing.json"))
+		assert.NotNil(t, err)
+	})
+
+	t.Run("no usable key", func(t *testing.T) {
+		_, err := ParseJWKS([]byte(`{"keys":[{"kty":"RSA","alg":"ES256","n":"AQAB","e":"AQAB"}]}`))
+		assert.NotNil(t, err)
+
+		_, err = ParseJWKS([]byte(`{"keys":[{"kty":"OKP"}]}`))
+		assert.NotNil(t, err)
+	})
+
+	t.Run("skip unsupported keys", func(t *testing.T) {
+		keySet, err := ParseJWKS([]byte(`{"keys":[
+			{"kty":"OKP","crv":"Ed25519","x":"AQAB"},
+			{"kty":"EC","crv":"P-384","x":"AQAB","y":"AQAB"},
+			{"kty":"RSA","alg":"RSA-OAEP","n":"AQAB","e":"AQAB"},
+			{"kty":"oct","kid":"hmac-key","k":"c2VjcmV0"}
+		]}`), WithJWKSLogger(log.NewDefaultLogger()))
+		require.Nil(t, err)
+		require.Len(t, keySet.keys, 1)
+		assert.Equal(t, "hmac-key", keySet.keys[0].ID)
+	})
+}
@@ -0,0 +1,250 @@
+/**
+ * Copyright © 2022 Hamed Yousefi <hdyousefi@gmail.com>.
+ */
+
+package jwt
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+
+	"github.com/hmdsefi/channelize/log"
+)
+
+const (
+	AlgorithmHS256 = "HS256"
+	AlgorithmRS256 = "RS256"
+	AlgorithmES256 = "ES256"
+)
+
+const (
+	keyTypeRSA       = "RSA"
+	keyTypeEC        = "EC"
+	keyTypeOctet     = "oct"
+	curveP256        = "P-256"
+	keyUseEncryption = "enc"
+)
+
+// Key represents a key that verifies the JWT signatures of an algorithm.
+type Key struct {
+	// ID represents the key ID. It is matched with the kid header of the token.
+	// It can be empty if the token doesn't have kid header.
+	ID string
+
+	// Algorithm represents the signing algorithm of the key.
+	Algorithm string
+
+	// key is the verification key. It is []byte for HS256, *rsa.PublicKey for
+	// RS256, and *ecdsa.PublicKey for ES256.
+	key interface{}
+}
+
+// NewHMACKey creates a HS256 key with the input shared secret.
+func NewHMACKey(id string, secret []byte) Key {
+	return Key{ID: id, Algorithm: AlgorithmHS256, key: secret}
+}
+
+// NewRSAKey creates a RS256 key with the input public key.
+func NewRSAKey(id string, publicKey *rsa.PublicKey) Key {
+	return Key{ID: id, Algorithm: AlgorithmRS256, key: publicKey}
+}
+
+// NewECDSAKey creates a ES256 key with the input P-256 public key.
+func NewECDSAKey(id string, publicKey *ecdsa.PublicKey) Key {
+	return Key{ID: id, Algorithm: AlgorithmES256, key: publicKey}
+}
+
+// KeySet is a static set of verification keys.
+type KeySet struct {
+	keys []Key
+}
+
+// NewKeySet creates a new KeySet with the input keys.
+func NewKeySet(keys ...Key) *KeySet {
+	return &KeySet{keys: keys}
+}
+
+// find returns the keys that match the input key ID and algorithm. If the
+// input key ID is empty, it returns all the keys of the algorithm. The keys
+// without ID match any key ID.
+func (s *KeySet) find(id, algorithm string) []Key {
+	var out []Key
+	for _, key := range s.keys {
+		if key.Algorithm != algorithm {
+			continue
+		}
+
+		if id != "" && key.ID != "" && key.ID != id {
+			continue
+		}
+
+		out = append(out, key)
+	}
+
+	return out
+}
+
+// jsonWebKey represents a key of a JWKS document.
+type jsonWebKey struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Algorithm string `json:"alg"`
+	Use       string `json:"use"`
+	N         string `json:"n"`
+	E         string `json:"e"`
+	Curve     string `json:"crv"`
+	X         string `json:"x"`
+	Y         string `json:"y"`
+	K         string `json:"k"`
+}
+
+// JWKSConfig represents the configuration of parsing the JWKS documents.
+type JWKSConfig struct {
+	// logger logs the keys that are skipped. The default value is the
+	// log.DefaultLogger.
+	logger log.Logger
+}
+
+type JWKSOption func(*JWKSConfig)
+
+// WithJWKSLogger sets the logger of the skipped JWKS keys.
+func WithJWKSLogger(logger log.Logger) JWKSOption {
+	return func(config *JWKSConfig) {
+		if config == nil || logger == nil {
+			return
+		}
+
+		config.logger = logger
+	}
+}
+
+// LoadJWKS reads a JWKS document from the input file path and creates a KeySet.
+func LoadJWKS(path string, options ...JWKSOption) (*KeySet, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseJWKS(data, options...)
+}
+
+// ParseJWKS parses the input JWKS document and creates a KeySet. It skips the
+// encryption keys, and logs and skips the keys that are not supported or are
+// invalid, e.g. the keys of the other algorithms. It returns error if there
+// is no usable key in the document.
+func ParseJWKS(data []byte, options ...JWKSOption) (*KeySet, error) {
+	config := JWKSConfig{logger: log.NewDefaultLogger()}
+	for _, option := range options {
+		option(&config)
+	}
+
+	var jwks struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+
+	if err := json.Unmarshal(data, &jwks); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal jwks: %w", err)
+	}
+
+	keySet := new(KeySet)
+	for i, jwk := range jwks.Keys {
+		if jwk.Use == keyUseEncryption {
+			continue
+		}
+
+		key, err := jwk.toKey()
+		if err != nil {
+			config.logger.Warn(
+				"jwks key is skipped",
+				"index", i,
+				"kid", jwk.KeyID,
+				"error", err.Error(),
+			)
+			continue
+		}
+
+		keySet.keys = append(keySet.keys, key)
+	}
+
+	if len(keySet.keys) == 0 {
+		return nil, errors.New("jwks has no usable key")
+	}
+
+	return keySet, nil
+}
+
+func (k jsonWebKey) toKey() (Key, error) {
+	switch k.KeyType {
+	case keyTypeOctet:
+		secret, err := decodeSegment(k.K)
+		if err != nil {
+			return Key{}, err
+		}
+
+		return k.withAlgorithm(NewHMACKey(k.KeyID, secret), AlgorithmHS256)
+	case keyTypeRSA:
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return Key{}, err
+		}
+
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return Key{}, err
+		}
+
+		return k.withAlgorithm(NewRSAKey(k.KeyID, &rsa.PublicKey{N: n, E: int(e.Int64())}), AlgorithmRS256)
+	case keyTypeEC:
+		if k.Curve != curveP256 {
+			return Key{}, fmt.Errorf("unsupported curve %q", k.Curve)
+		}
+
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return Key{}, err
+		}
+
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return Key{}, err
+		}
+
+		publicKey := &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}
+		if !publicKey.Curve.IsOnCurve(x, y) {
+			return Key{}, fmt.Errorf("invalid %s point", curveP256)
+		}
+
+		return k.withAlgorithm(NewECDSAKey(k.KeyID, publicKey), AlgorithmES256)
+	default:
+		return Key{}, fmt.Errorf("unsupported key type %q", k.KeyType)
+	}
+}
+
+// withAlgorithm checks that the alg field of the JWK matches the key type.
+func (k jsonWebKey) withAlgorithm(key Key, algorithm string) (Key, error) {
+	if k.Algorithm != "" && k.Algorithm != algorithm {
+		return Key{}, fmt.Errorf("unsupported algorithm %q for key type %q", k.Algorithm, k.KeyType)
+	}
+
+	return key, nil
+}
+
+func decodeSegment(segment string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(segment)
+}
+
+func decodeBigInt(segment string) (*big.Int, error) {
+	data, err := decodeSegment(segment)
+	if err != nil {
+		return nil, err
+	}
+
+	return new(big.Int).SetBytes(data), nil
+}
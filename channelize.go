@@ -6,20 +6,28 @@ package channelize
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
 	"time"
 
 	"github.com/gorilla/websocket"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/trace"
 
 	"github.com/hmdsefi/channelize/auth"
+	"github.com/hmdsefi/channelize/internal/admin"
+	"github.com/hmdsefi/channelize/internal/admission"
 	"github.com/hmdsefi/channelize/internal/channel"
 	"github.com/hmdsefi/channelize/internal/common"
-	internalLog "github.com/hmdsefi/channelize/internal/common/log"
+	"github.com/hmdsefi/channelize/internal/common/errorx"
 	"github.com/hmdsefi/channelize/internal/conn"
 	"github.com/hmdsefi/channelize/internal/core"
-	"github.com/hmdsefi/channelize/internal/metrics"
+	"github.com/hmdsefi/channelize/internal/hooks"
+	"github.com/hmdsefi/channelize/internal/rpc"
 	"github.com/hmdsefi/channelize/log"
+	"github.com/hmdsefi/channelize/metrics"
+	prommetrics "github.com/hmdsefi/channelize/metrics/prometheus"
 )
 
 // connectionHelper is a middleware between connection and storage. It helps
@@ -28,12 +36,27 @@ import (
 // connectionHelper gives this ability to the connection to register or unregister
 // itself into the storage.
 type connectionHelper interface {
+	// Register adds the connection to the storage. It returns error if the
+	// connection is rejected by the hooks.
+	Register(ctx context.Context, connection *conn.Connection) error
+
+	// ApproveToken calls the OnAuth hook before storing a validated token in
+	// the connection.
+	ApproveToken(ctx context.Context, connection *conn.Connection, token *auth.Token) error
+
 	// ParseMessage deserializes the inbound messages and call the storage methods
 	// based on the message type.
 	ParseMessage(ctx context.Context, connection *conn.Connection, data []byte)
 
 	// Remove removes the connection from the storage.
 	Remove(ctx context.Context, connID string, userID *string)
+
+	// SendError sends the input error to the error channel of the connection.
+	SendError(connection *conn.Connection, err error)
+
+	// NotifyTokenExpiring notifies the client that the connection token is
+	// about to expire.
+	NotifyTokenExpiring(connection *conn.Connection)
 }
 
 // dispatcher is a mechanism to send the public messages to the existing connections.
@@ -43,44 +66,235 @@ type dispatcher interface {
 	// since the message is public.
 	SendPublicMessage(ctx context.Context, ch channel.Channel, message interface{}) error
 
+	// SendPublicMessageWithResult sends the input message to the connections
+	// that already subscribed to the input channel, and returns the delivery
+	// result.
+	SendPublicMessageWithResult(ctx context.Context, ch channel.Channel, message interface{}) (*DeliveryResult, error)
+
+	// SendPublicMessageAsync sends the input message in another goroutine, and
+	// calls the callback with the delivery result.
+	SendPublicMessageAsync(
+		ctx context.Context,
+		ch channel.Channel,
+		message interface{},
+		callback func(result *DeliveryResult, err error),
+	)
+
 	// SendPrivateMessage sends the input message to the input channel if the client
 	// already authenticated with the input userID. Otherwise, skips and returns.
 	SendPrivateMessage(ctx context.Context, ch channel.Channel, userID string, message interface{}) error
-}
 
-// collector is an interface for collecting the connection metrics.
-type collector interface {
-	// OpenConnectionsInc increases the total number of open connections.
-	OpenConnectionsInc()
+	// Broadcast sends the input message to all the connections in the
+	// announcement channel, regardless of their subscriptions.
+	Broadcast(ctx context.Context, message interface{}) error
 
-	// OpenConnectionsDec decreases the total number of open connections.
-	OpenConnectionsDec()
+	// SendToConnection sends the input message to the connection with the
+	// input connID, regardless of its user and subscriptions.
+	SendToConnection(ctx context.Context, connID string, ch channel.Channel, message interface{}) error
 
-	// PrivateConnectionsInc increases total number of private connections.
-	PrivateConnectionsInc()
+	// SendToTag sends the input message to the connections of the input
+	// channel that have the input tag.
+	SendToTag(ctx context.Context, ch channel.Channel, tag string, message interface{}) error
 
-	// PrivateConnectionsDec decreases total number of private connections.
-	PrivateConnectionsDec()
+	// SendPublicMessages sends the input messages to the connections of their
+	// channels, and returns the result of each message.
+	SendPublicMessages(ctx context.Context, envelopes []Envelope) []EnvelopeResult
 
-	SubscribedChannels(float64)
-	PrivateConnections(float64)
-	OpenConnections(float64)
+	// Close stops the fan-out workers after they send the queued messages.
+	Close()
 }
 
 type Option func(*Config)
 
+// AdmissionFunc is a function type that decides whether an upgrade request
+// should be accepted by the MakeHTTPHandler. It returns nil to accept the
+// request. Returning an *AdmissionError rejects the request with its status
+// code, and any other error rejects the request with http.StatusForbidden.
+type AdmissionFunc = admission.Func
+
+// AdmissionError represents the rejection of an upgrade request.
+type AdmissionError = admission.Error
+
+// NewAdmissionError creates a new AdmissionError with the input HTTP status
+// code and message.
+func NewAdmissionError(statusCode int, message string) *AdmissionError {
+	return admission.NewError(statusCode, message)
+}
+
+// MetricsCollector is an interface for collecting the Channelize metrics.
+// The default implementation is the prometheus collector.
+type MetricsCollector = metrics.Collector
+
+// Hooks represents the functions that are called on the connection lifecycle
+// transitions. The OnConnect, OnAuth, and OnSubscribe hooks can reject the
+// action by returning an error that is sent to the error channel.
+type Hooks = hooks.Hooks
+
+// Channel represents the name of a channel.
+type Channel = channel.Channel
+
+// ChannelOption represents the options of the channel registration.
+type ChannelOption = channel.Option
+
+// SnapshotFunc is a function type that returns the current state of a
+// channel. The token is nil if the connection is not authenticated, and
+// params is the raw params object of the subscribe message.
+type SnapshotFunc = channel.SnapshotFunc
+
+// PublishFunc is a function type that authorizes the messages that clients
+// publish to a channel. It can validate and transform the data, and returns
+// the message that is sent to the subscribers. Any error rejects the message.
+type PublishFunc = channel.PublishFunc
+
+// MessageHandler is a function type that handles a custom inbound message
+// type. It gets the connection, the raw params object of the message, and
+// a ReplyFunc that sends the reply to the reply channel of the connection.
+type MessageHandler = rpc.Handler
+
+// MessageConnection represents the connection that has sent a custom message.
+type MessageConnection = rpc.Connection
+
+// ReplyFunc is a function type that replies a custom message. It can be called
+// once per message, and it doesn't send anything if the message has no ID.
+type ReplyFunc = rpc.ReplyFunc
+
+// TagsFunc is a function type that returns the connection tags from the auth
+// token, e.g. from the token claims.
+type TagsFunc = conn.TagsFunc
+
+// Envelope represents a message of a batch publish and its channel.
+type Envelope = core.Envelope
+
+// EnvelopeResult represents the result of publishing an Envelope. It contains
+// the delivery result and the marshal error.
+type EnvelopeResult = core.EnvelopeResult
+
+// DeliveryResult represents the result of sending a message to the
+// subscribers of a channel. It contains the number of subscribers, delivered
+// and dropped messages, and the connections that didn't receive the message.
+type DeliveryResult = core.DeliveryResult
+
+// DeliveryFailure represents a connection that didn't receive the message,
+// and the reason.
+type DeliveryFailure = core.DeliveryFailure
+
+// FanoutOption represents the options of the fan-out worker pool.
+type FanoutOption = core.FanoutOption
+
+// OverflowPolicy specifies what happens to a published message when the
+// fan-out queue is full.
+type OverflowPolicy = core.OverflowPolicy
+
+const (
+	// OverflowBlock blocks the publisher until the fan-out queue has room, the
+	// publish context is done, or the Channelize is closed. It is the default
+	// policy.
+	OverflowBlock = core.OverflowBlock
+
+	// OverflowDropNewest drops the new message and keeps the queued messages.
+	OverflowDropNewest = core.OverflowDropNewest
+
+	// OverflowDropOldest drops the oldest queued message to make room for the
+	// new message.
+	OverflowDropOldest = core.OverflowDropOldest
+)
+
+// PresenceMembers represents the current members of a presence channel.
+type PresenceMembers = core.PresenceMembers
+
+// ConnectionInfo represents the connection metadata. It contains the remote
+// address, the connection time, the number of bytes that have been sent to
+// the peer, the outbound buffer fill, and the subscribed channels.
+type ConnectionInfo = common.ConnectionInfo
+
+// AdminAuthFunc is a function type that authorizes the requests of the admin
+// handler. It returns nil to accept the request. Any error rejects the request
+// with http.StatusUnauthorized.
+type AdminAuthFunc = admin.AuthFunc
+
 // Config represents Channelize configuration.
 type Config struct {
-	logger   log.Logger
-	authFunc auth.AuthenticateFunc
+	logger        log.Logger
+	authenticator auth.Authenticator
+	authorizer    auth.Authorizer
+
+	// authTimeout represents the maximum duration of authenticating a token.
+	// Zero means there is no timeout.
+	authTimeout time.Duration
+
+	// maxSubscriptions represents the maximum number of channels that a
+	// connection can subscribe. Zero means there is no limit.
+	maxSubscriptions int
+
+	// maxChannelsPerRequest represents the maximum number of channels in
+	// a single inbound message. Zero means there is no limit.
+	maxChannelsPerRequest int
+
+	// admissionOptions represents the admission control configuration of
+	// the MakeHTTPHandler.
+	admissionOptions []admission.Option
+
+	// tokenExtractor extracts the auth token from the upgrade request in the
+	// MakeHTTPHandler. If it is nil, the handshake authentication is disabled.
+	tokenExtractor auth.TokenExtractor
+
+	// handshakeAuthRequired rejects the upgrade requests without token if it
+	// is true.
+	handshakeAuthRequired bool
+
+	// metricsOptions represents the prometheus metrics configuration.
+	metricsOptions []prommetrics.Option
+
+	// collector collects the metrics. The default value is the prometheus
+	// collector that is created by the metricsOptions.
+	collector metrics.Collector
+
+	// tracerProvider provides the tracer of the published messages. Tracing
+	// is disabled if it is nil.
+	tracerProvider trace.TracerProvider
+
+	// injectTraceID adds the trace ID to the outbound messages metadata.
+	injectTraceID bool
+
+	// batchFrames sends the messages of a batch publish that belong to a
+	// connection in a single frame.
+	batchFrames bool
+
+	// fanoutPool sends the published messages by using a pool of workers.
+	fanoutPool bool
+
+	// fanoutOptions represents the fan-out pool configuration.
+	fanoutOptions []core.FanoutOption
+
+	// asyncQueueSize represents the maximum number of the messages that wait
+	// to be sent by SendPublicMessageAsync without the fan-out pool.
+	asyncQueueSize int
+
+	// hooks are called on the connection lifecycle transitions.
+	hooks hooks.Hooks
+
+	// handlers stores the custom message handlers by their message type.
+	handlers map[string]rpc.Route
+
+	// tagsFunc returns the connection tags from the auth tokens.
+	tagsFunc conn.TagsFunc
+
+	// presence stores the presence channels. The value shows if the join and
+	// leave events should be sent to the channel.
+	presence map[channel.Channel]bool
 }
 
 func newDefaultConfig() *Config {
 	return &Config{
-		logger: internalLog.NewDefaultLogger(),
+		logger: log.NewDefaultLogger(),
 	}
 }
 
+// WithLogger sets the logger. The default value is log.DefaultLogger that
+// writes the text messages with info level or higher to the os.Stderr.
+//
+// If the logger implements log.ChildLogger, the connection-scoped loggers are
+// created by its With method.
 func WithLogger(logger log.Logger) func(config *Config) {
 	return func(config *Config) {
 		config.logger = logger
@@ -89,7 +303,302 @@ func WithLogger(logger log.Logger) func(config *Config) {
 
 func WithAuthFunc(authFunc auth.AuthenticateFunc) func(config *Config) {
 	return func(config *Config) {
-		config.authFunc = authFunc
+		if authFunc == nil {
+			config.authenticator = nil
+			return
+		}
+
+		config.authenticator = authFunc
+	}
+}
+
+// WithAuthenticator sets the context-aware authenticator that validates the
+// client tokens. It overrides the WithAuthFunc option.
+func WithAuthenticator(authenticator auth.Authenticator) func(config *Config) {
+	return func(config *Config) {
+		config.authenticator = authenticator
+	}
+}
+
+// WithAuthTimeout sets the maximum duration of authenticating a token. The
+// context of the authenticator is cancelled after the timeout.
+func WithAuthTimeout(timeout time.Duration) func(config *Config) {
+	return func(config *Config) {
+		config.authTimeout = timeout
+	}
+}
+
+// WithAuthorizer sets the authorizer that decides whether an authenticated
+// user can subscribe to a private channel. Subscribe messages that include
+// a denied channel are rejected with an error on the error channel.
+//
+// The authorizer is not called for the public channels, so the channels that
+// need authorization should be registered by RegisterPrivateChannel.
+func WithAuthorizer(authorizer auth.Authorizer) func(config *Config) {
+	return func(config *Config) {
+		config.authorizer = authorizer
+	}
+}
+
+// WithMaxSubscriptions sets the maximum number of channels that a connection
+// can subscribe. Subscribe messages that exceed the limit are rejected with
+// an error on the error channel.
+func WithMaxSubscriptions(n int) func(config *Config) {
+	return func(config *Config) {
+		config.maxSubscriptions = n
+	}
+}
+
+// WithMaxChannelsPerRequest sets the maximum number of channels in a single
+// inbound message. Messages that exceed the limit are rejected with an error
+// on the error channel.
+func WithMaxChannelsPerRequest(n int) func(config *Config) {
+	return func(config *Config) {
+		config.maxChannelsPerRequest = n
+	}
+}
+
+// WithMaxConnections sets the maximum number of connections that are created
+// by the MakeHTTPHandler. Upgrade requests that exceed the limit are rejected
+// with http.StatusServiceUnavailable.
+func WithMaxConnections(n int) func(config *Config) {
+	return func(config *Config) {
+		config.admissionOptions = append(config.admissionOptions, admission.WithMaxConnections(n))
+	}
+}
+
+// WithMaxConnectionsPerIP sets the maximum number of connections per remote
+// address that are created by the MakeHTTPHandler. Upgrade requests that
+// exceed the limit are rejected with http.StatusTooManyRequests.
+func WithMaxConnectionsPerIP(n int) func(config *Config) {
+	return func(config *Config) {
+		config.admissionOptions = append(config.admissionOptions, admission.WithMaxConnectionsPerIP(n))
+	}
+}
+
+// WithClientIPHeader sets the HTTP header that holds the client address, e.g.
+// X-Forwarded-For. By default, the remote address of the request is used. If
+// the header contains a list of addresses, the rightmost address is used,
+// since it is appended by the proxy and the client can't spoof it. Use
+// WithTrustedProxyHops if there is more than one proxy.
+func WithClientIPHeader(header string) func(config *Config) {
+	return func(config *Config) {
+		config.admissionOptions = append(config.admissionOptions, admission.WithClientIPHeader(header))
+	}
+}
+
+// WithTrustedProxyHops sets the number of trusted proxies in front of the
+// server. The client address is the address that is appended to the client
+// IP header by the outermost trusted proxy. If the header has fewer addresses
+// than the trusted hops, the remote address is used. The default value is one.
+func WithTrustedProxyHops(hops int) func(config *Config) {
+	return func(config *Config) {
+		config.admissionOptions = append(config.admissionOptions, admission.WithTrustedProxyHops(hops))
+	}
+}
+
+// WithUpgradeRateLimit sets the rate limit of the upgrade requests in the
+// MakeHTTPHandler. Upgrade requests that exceed the limit are rejected with
+// http.StatusTooManyRequests.
+func WithUpgradeRateLimit(rate float64, burst int) func(config *Config) {
+	return func(config *Config) {
+		config.admissionOptions = append(config.admissionOptions, admission.WithUpgradeRateLimit(rate, burst))
+	}
+}
+
+// WithAdmissionFunc sets a hook that can reject the upgrade requests in the
+// MakeHTTPHandler before creating the websocket connection.
+func WithAdmissionFunc(fn AdmissionFunc) func(config *Config) {
+	return func(config *Config) {
+		config.admissionOptions = append(config.admissionOptions, admission.WithAdmissionFunc(fn))
+	}
+}
+
+// WithHandshakeAuth enables authentication of the websocket upgrade requests
+// in the MakeHTTPHandler. The extractor reads the token from the request,
+// e.g. auth.FromHeader("Authorization"), and the token is validated by the
+// auth function before the upgrade. The connection starts bound to the
+// token userID.
+//
+// Requests with an invalid token are rejected with http.StatusUnauthorized.
+// If required is true, the requests without token are rejected too.
+// Otherwise, they create anonymous connections.
+func WithHandshakeAuth(extractor auth.TokenExtractor, required bool) func(config *Config) {
+	return func(config *Config) {
+		config.tokenExtractor = extractor
+		config.handshakeAuthRequired = required
+	}
+}
+
+// WithCollector sets the metrics collector, e.g. the OpenTelemetry or expvar
+// collector. The prometheus metrics options are ignored if the collector
+// is set.
+func WithCollector(collector MetricsCollector) func(config *Config) {
+	return func(config *Config) {
+		config.collector = collector
+	}
+}
+
+// WithHooks sets the connection lifecycle hooks, e.g. for audit logging or
+// custom authorization.
+func WithHooks(hooks Hooks) func(config *Config) {
+	return func(config *Config) {
+		config.hooks = hooks
+	}
+}
+
+// WithMessageHandler registers the handler of the input custom message type.
+// The built-in message types, e.g. subscribe, can't be overridden, and they
+// are ignored. It can be used multiple times with different message types.
+//
+// The handler is called only for the authenticated connections. The messages
+// of the connections without a valid token are rejected with an auth error.
+// Use WithAnonymousMessageHandler to accept them.
+func WithMessageHandler(messageType string, handler MessageHandler) func(config *Config) {
+	return withMessageRoute(messageType, rpc.Route{Handler: handler})
+}
+
+// WithAnonymousMessageHandler registers the handler of the input custom
+// message type like WithMessageHandler, but the handler is called for all
+// the connections, including the ones without a valid token.
+func WithAnonymousMessageHandler(messageType string, handler MessageHandler) func(config *Config) {
+	return withMessageRoute(messageType, rpc.Route{Handler: handler, Anonymous: true})
+}
+
+func withMessageRoute(messageType string, route rpc.Route) func(config *Config) {
+	return func(config *Config) {
+		if route.Handler == nil || core.IsBuiltinMessageType(messageType) {
+			return
+		}
+
+		if config.handlers == nil {
+			config.handlers = make(map[string]rpc.Route)
+		}
+
+		config.handlers[messageType] = route
+	}
+}
+
+// WithTokenTags sets the function that returns the connection tags from the
+// auth token. The tags are added to the connection each time that a token is
+// stored, e.g. after the authentication and the token refresh. They replace the
+// tags of the previous token, and are removed when the token is revoked.
+func WithTokenTags(tagsFunc TagsFunc) func(config *Config) {
+	return func(config *Config) {
+		config.tagsFunc = tagsFunc
+	}
+}
+
+// WithTracerProvider enables the OpenTelemetry tracing. It starts a span per
+// published message that records the fan-out size and the number of dropped
+// messages, and a child span per connection when the message is written to
+// the websocket connection.
+func WithTracerProvider(provider trace.TracerProvider) func(config *Config) {
+	return func(config *Config) {
+		config.tracerProvider = provider
+	}
+}
+
+// WithTraceIDInjection adds the trace ID of the publisher span to the metadata
+// of the outbound messages, so the clients can correlate the messages with the
+// traces. It has no effect if the tracing is disabled.
+func WithTraceIDInjection(enabled bool) func(config *Config) {
+	return func(config *Config) {
+		config.injectTraceID = enabled
+	}
+}
+
+// WithBatchFrames sends the messages of a SendPublicMessages call that belong
+// to the same connection in a single frame of the batch channel, instead of a
+// frame per message.
+func WithBatchFrames(enabled bool) func(config *Config) {
+	return func(config *Config) {
+		config.batchFrames = enabled
+	}
+}
+
+// WithAsyncQueueSize sets the maximum number of the messages that wait to be
+// sent by SendPublicMessageAsync if the fan-out pool is disabled. The caller
+// blocks while the queue is full. The default value is 256.
+func WithAsyncQueueSize(size int) func(config *Config) {
+	return func(config *Config) {
+		config.asyncQueueSize = size
+	}
+}
+
+// WithFanoutPool sends the published messages to the connections by using a
+// bounded pool of workers instead of the publisher goroutine, e.g. for the
+// channels with many subscribers. The connections are partitioned between
+// the workers, so each connection receives the messages in the publish order.
+func WithFanoutPool(options ...FanoutOption) func(config *Config) {
+	return func(config *Config) {
+		config.fanoutPool = true
+		config.fanoutOptions = options
+	}
+}
+
+// WithFanoutWorkers sets the number of the fan-out workers. The default value
+// is runtime.GOMAXPROCS.
+func WithFanoutWorkers(workers int) FanoutOption {
+	return core.WithFanoutWorkers(workers)
+}
+
+// WithFanoutQueueSize sets the maximum number of queued messages per fan-out
+// worker. The default value is 1024.
+func WithFanoutQueueSize(size int) FanoutOption {
+	return core.WithFanoutQueueSize(size)
+}
+
+// WithOverflowPolicy sets the policy of the full fan-out queues. The default
+// value is OverflowBlock.
+func WithOverflowPolicy(policy OverflowPolicy) FanoutOption {
+	return core.WithOverflowPolicy(policy)
+}
+
+// WithMetricsRegisterer sets the prometheus registerer of the Channelize
+// metrics. The default value is prometheus.DefaultRegisterer.
+func WithMetricsRegisterer(registerer prometheus.Registerer) func(config *Config) {
+	return func(config *Config) {
+		config.metricsOptions = append(config.metricsOptions, prommetrics.WithRegisterer(registerer))
+	}
+}
+
+// WithMetricsNamespace sets the prefix of the Channelize metric names.
+func WithMetricsNamespace(namespace string) func(config *Config) {
+	return func(config *Config) {
+		config.metricsOptions = append(config.metricsOptions, prommetrics.WithNamespace(namespace))
+	}
+}
+
+// WithMetricsConstLabels sets the labels with fixed values that are added to
+// all the Channelize metrics.
+func WithMetricsConstLabels(labels prometheus.Labels) func(config *Config) {
+	return func(config *Config) {
+		config.metricsOptions = append(config.metricsOptions, prommetrics.WithConstLabels(labels))
+	}
+}
+
+// WithMetricsLatencyBuckets sets the buckets of the latency histograms in
+// seconds. By default, the buckets are exponential from 50µs to ~1.6s.
+func WithMetricsLatencyBuckets(buckets []float64) func(config *Config) {
+	return func(config *Config) {
+		config.metricsOptions = append(config.metricsOptions, prommetrics.WithLatencyBuckets(buckets))
+	}
+}
+
+// WithPresence enables the presence tracking for the input channels. If events
+// is true, the join and leave events of the authenticated users are sent to
+// the channel subscribers. It can be used multiple times with different
+// events value.
+func WithPresence(events bool, channels ...channel.Channel) func(config *Config) {
+	return func(config *Config) {
+		if config.presence == nil {
+			config.presence = make(map[channel.Channel]bool)
+		}
+
+		for _, ch := range channels {
+			config.presence[ch] = events
+		}
 	}
 }
 
@@ -98,46 +607,135 @@ func WithAuthFunc(authFunc auth.AuthenticateFunc) func(config *Config) {
 //
 // It provides more APIs like HTTP handlers to facilitate the API usage.
 type Channelize struct {
-	helper     connectionHelper
-	dispatcher dispatcher
-	logger     log.Logger
-	authFunc   auth.AuthenticateFunc
-	collector  collector
+	helper        connectionHelper
+	dispatcher    dispatcher
+	logger        log.Logger
+	authenticator auth.Authenticator
+	collector     metrics.Collector
+	tracer        trace.Tracer
+	admission     *admission.Controller
+	sweeper       *core.Sweeper
+	revoker       *core.Revoker
+	storage       *core.PresenceCache
+	tagsFunc      conn.TagsFunc
+
+	tokenExtractor        auth.TokenExtractor
+	handshakeAuthRequired bool
 }
 
 // NewChannelize creates new instance of Channelize struct. It uses in-memory
 // storage by default to store the connections and mapping between the connections and
 // channels.
+//
+// It panics if the prometheus metrics are already registered, e.g. by another
+// instance with the same registerer. Use a distinct registerer, namespace, or
+// const labels for each instance, or set a collector by WithCollector.
 func NewChannelize(options ...Option) *Channelize {
 	config := newDefaultConfig()
 	for _, option := range options {
 		option(config)
 	}
 
-	collector := metrics.NewMetrics()
-	storage := core.NewCache(collector)
+	if config.authenticator != nil && config.authTimeout > 0 {
+		config.authenticator = auth.WithTimeout(config.authenticator, config.authTimeout)
+	}
+
+	collector := config.collector
+	if collector == nil {
+		var err error
+		collector, err = prommetrics.NewMetrics(config.metricsOptions...)
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	tracerProvider := config.tracerProvider
+	if tracerProvider == nil {
+		tracerProvider = trace.NewNoopTracerProvider()
+	}
+
+	tracer := tracerProvider.Tracer(common.TracerName)
+
+	storage := core.NewPresenceCache(core.NewCache(collector), config.logger, config.presence)
+	dispatchOptions := []core.DispatchOption{
+		core.WithTracer(tracer),
+		core.WithTraceIDInjection(config.injectTraceID),
+		core.WithBatchFrames(config.batchFrames),
+		core.WithAsyncQueueSize(config.asyncQueueSize),
+	}
+	if config.fanoutPool {
+		dispatchOptions = append(dispatchOptions, core.WithFanoutPool(config.fanoutOptions...))
+	}
+
+	dispatcher := core.NewDispatch(storage, collector, config.logger, dispatchOptions...)
 
 	return &Channelize{
-		helper:     newHelper(storage),
-		dispatcher: core.NewDispatch(storage, config.logger),
-		logger:     config.logger,
-		authFunc:   config.authFunc,
-		collector:  collector,
+		helper:        newHelper(storage, dispatcher, collector, config),
+		dispatcher:    dispatcher,
+		logger:        config.logger,
+		authenticator: config.authenticator,
+		collector:     collector,
+		tracer:        tracer,
+		admission:     admission.NewController(config.admissionOptions...),
+		sweeper:       core.NewSweeper(storage, collector, config.logger),
+		revoker:       core.NewRevoker(storage, config.logger),
+		storage:       storage,
+		tagsFunc:      config.tagsFunc,
+
+		tokenExtractor:        config.tokenExtractor,
+		handshakeAuthRequired: config.handshakeAuthRequired,
 	}
 }
 
 // CreateConnection creates a `conn.Connection` object with the input options.
 func (c *Channelize) CreateConnection(ctx context.Context, wsConn *websocket.Conn, options ...conn.Option) *conn.Connection {
-	return conn.NewConnection(ctx, wsConn, c.helper, c.authFunc, c.logger, append(options, conn.WithCollector(c.collector))...)
+	options = append(options, conn.WithCollector(c.collector), conn.WithTracer(c.tracer))
+	if c.tagsFunc != nil {
+		options = append(options, conn.WithTagsFunc(c.tagsFunc))
+	}
+
+	return conn.NewConnection(ctx, wsConn, c.helper, c.authenticator, c.logger, options...)
 }
 
 // MakeHTTPHandler makes a built-in HTTP handler function. The client should
 // provide the websocket.Upgrader. It automatically creates the websocket.Conn
 // and conn.Connection.
+//
+// Before upgrading the request, it checks the admission control limits and
+// rejects the request with an HTTP error if any of them has been exceeded.
+// If the handshake authentication is enabled, it authenticates the request
+// before the upgrade.
 func (c *Channelize) MakeHTTPHandler(appCtx context.Context, upgrader websocket.Upgrader, options ...conn.Option) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		ip, err := c.admission.Admit(r)
+		if err != nil {
+			var admissionErr *admission.Error
+			if !errors.As(err, &admissionErr) {
+				admissionErr = admission.NewError(http.StatusForbidden, err.Error())
+			}
+
+			c.logger.Warn("websocket upgrade request rejected", common.LogFieldError, admissionErr.Error())
+			http.Error(w, admissionErr.Message, admissionErr.StatusCode)
+			return
+		}
+
+		token, err := c.authenticateRequest(r)
+		if err != nil {
+			c.collector.AuthFailuresInc()
+			c.admission.Release(ip)
+			c.logger.Warn("websocket upgrade request is not authenticated", common.LogFieldError, err.Error())
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		connOptions := options
+		if token != nil {
+			connOptions = append(append(make([]conn.Option, 0, len(options)+1), options...), conn.WithToken(token))
+		}
+
 		wsConn, err := upgrader.Upgrade(w, r, nil)
 		if err != nil {
+			c.admission.Release(ip)
 			c.logger.Error("failed to create websocket.Conn", common.LogFieldError, err.Error())
 			http.Error(
 				w,
@@ -147,25 +745,264 @@ func (c *Channelize) MakeHTTPHandler(appCtx context.Context, upgrader websocket.
 			return
 		}
 
-		c.CreateConnection(appCtx, wsConn, options...)
+		connection := c.CreateConnection(appCtx, wsConn, connOptions...)
+
+		// release the admission slot after closing the connection.
+		go func() {
+			<-connection.Done()
+			c.admission.Release(ip)
+		}()
+	}
+}
+
+// authenticateRequest extracts the token from the upgrade request and validates
+// it. It returns nil token if the handshake authentication is disabled or the
+// token is missing and not required.
+func (c *Channelize) authenticateRequest(r *http.Request) (*auth.Token, error) {
+	if c.tokenExtractor == nil {
+		return nil, nil
+	}
+
+	token := c.tokenExtractor(r)
+	if token == "" {
+		if c.handshakeAuthRequired {
+			return nil, errorx.NewChannelizeError(errorx.CodeAuthTokenIsMissing)
+		}
+
+		return nil, nil
 	}
+
+	return conn.ValidateToken(r.Context(), c.authenticator, token)
 }
 
-// SendPublicMessage sends the message to the input channel.
+// SendPublicMessage sends the message to the input channel. If the fan-out
+// pool is enabled, it returns after queueing the message.
 func (c *Channelize) SendPublicMessage(ctx context.Context, ch channel.Channel, message interface{}) error {
 	return c.dispatcher.SendPublicMessage(ctx, ch, message)
 }
 
+// SendPublicMessageWithResult sends the message to the input channel, and
+// returns the number of subscribers, delivered and dropped messages, and the
+// connections that didn't receive the message. The result is nil if the
+// message can't be serialized.
+func (c *Channelize) SendPublicMessageWithResult(
+	ctx context.Context,
+	ch channel.Channel,
+	message interface{},
+) (*DeliveryResult, error) {
+	return c.dispatcher.SendPublicMessageWithResult(ctx, ch, message)
+}
+
+// SendPublicMessageAsync sends the message to the input channel in another
+// goroutine, and calls the callback with the delivery result. The callback
+// can be nil.
+//
+// Without the fan-out pool, the messages are queued and sent by a single
+// worker in the publish order, and the caller blocks while the queue is full.
+// The queue size can be set by WithAsyncQueueSize. If the fan-out pool is
+// enabled, each connection receives the messages in the publish order. In both
+// cases, the callback is called by a worker, so it shouldn't block.
+func (c *Channelize) SendPublicMessageAsync(
+	ctx context.Context,
+	ch channel.Channel,
+	message interface{},
+	callback func(result *DeliveryResult, err error),
+) {
+	c.dispatcher.SendPublicMessageAsync(ctx, ch, message, callback)
+}
+
+// Close stops the fan-out workers, or the async worker if the fan-out pool is
+// disabled, after they send the queued messages. The next messages are sent
+// by the publisher goroutine.
+func (c *Channelize) Close() {
+	c.dispatcher.Close()
+}
+
+// RunTokenSweeper checks the token expiration of the private connections with
+// the input interval until the input context is cancelled. The expired tokens
+// are authenticated again, and if the authentication fails, the private channel
+// subscriptions of the connection are revoked and the client receives a
+// `token_expired` event in the auth channel. The public subscriptions are kept.
+//
+// RunTokenSweeper blocks the caller, so it should be called in a new goroutine.
+// If the interval is not positive, the default interval of one minute is used.
+func (c *Channelize) RunTokenSweeper(ctx context.Context, interval time.Duration) {
+	c.sweeper.Run(ctx, interval)
+}
+
+// DisconnectUser closes all the connections of the input userID. The peers
+// receive a close message with the policy violation code (1008) and the input
+// reason. The reason is truncated to 123 bytes on a character boundary. It
+// returns the number of closed connections.
+func (c *Channelize) DisconnectUser(ctx context.Context, userID string, reason string) int {
+	return c.revoker.DisconnectUser(ctx, userID, websocket.ClosePolicyViolation, reason)
+}
+
+// DisconnectConnection closes the connection with the input connID. The peer
+// receives a close message with the policy violation code (1008) and the input
+// reason. The reason is truncated to 123 bytes on a character boundary. It
+// returns error if the connection doesn't exist.
+func (c *Channelize) DisconnectConnection(ctx context.Context, connID string, reason string) error {
+	return c.revoker.DisconnectConnection(ctx, connID, websocket.ClosePolicyViolation, reason)
+}
+
+// RevokePrivateSubscriptions removes the auth token and the private channel
+// subscriptions of all the connections of the input userID. The connections
+// stay open with their public subscriptions and receive a `subscriptions_revoked`
+// event in the auth channel. It returns the number of revoked connections.
+func (c *Channelize) RevokePrivateSubscriptions(ctx context.Context, userID string) int {
+	return c.revoker.RevokePrivateSubscriptions(ctx, userID)
+}
+
+// Presence returns the user IDs and the number of connections that subscribed
+// to the input channel. It returns error if the presence is not enabled for
+// the channel by the WithPresence option.
+func (c *Channelize) Presence(ctx context.Context, ch channel.Channel) (*PresenceMembers, error) {
+	return c.storage.Members(ctx, ch)
+}
+
+// SubscriberCounts returns the number of connections that subscribed to each
+// channel. The channels without any subscriber are not included.
+func (c *Channelize) SubscriberCounts(ctx context.Context) map[channel.Channel]int {
+	return c.storage.SubscriberCounts(ctx)
+}
+
+// ConnectionChannels returns the channels that the connection with the input
+// connID subscribed.
+func (c *Channelize) ConnectionChannels(ctx context.Context, connID string) []channel.Channel {
+	return c.storage.Channels(ctx, connID)
+}
+
+// TagConnection adds the input tags to the connection with the input connID.
+// It returns error if the connection doesn't exist.
+func (c *Channelize) TagConnection(ctx context.Context, connID string, tags ...string) error {
+	connection := c.storage.Connection(ctx, connID)
+	if connection == nil {
+		return errorx.NewChannelizeError(errorx.CodeConnectionNotFound)
+	}
+
+	connection.AddTags(tags...)
+
+	return nil
+}
+
+// UntagConnection removes the input tags from the connection with the input
+// connID. It returns error if the connection doesn't exist.
+func (c *Channelize) UntagConnection(ctx context.Context, connID string, tags ...string) error {
+	connection := c.storage.Connection(ctx, connID)
+	if connection == nil {
+		return errorx.NewChannelizeError(errorx.CodeConnectionNotFound)
+	}
+
+	connection.RemoveTags(tags...)
+
+	return nil
+}
+
+// ConnectionInfo returns the metadata of the connection with the input connID.
+// It returns error if the connection doesn't exist.
+func (c *Channelize) ConnectionInfo(ctx context.Context, connID string) (*ConnectionInfo, error) {
+	info := c.storage.ConnectionInfo(ctx, connID)
+	if info == nil {
+		return nil, errorx.NewChannelizeError(errorx.CodeConnectionNotFound)
+	}
+
+	return info, nil
+}
+
+// Connections returns the metadata of all the connections.
+func (c *Channelize) Connections(ctx context.Context) []ConnectionInfo {
+	connections := c.storage.AllConnections(ctx)
+
+	infos := make([]ConnectionInfo, 0, len(connections))
+	for _, connection := range connections {
+		if info := c.storage.ConnectionInfo(ctx, connection.ID()); info != nil {
+			infos = append(infos, *info)
+		}
+	}
+
+	return infos
+}
+
+// UserConnections returns the metadata of all the connections that are
+// authenticated with the input userID.
+func (c *Channelize) UserConnections(ctx context.Context, userID string) []ConnectionInfo {
+	var infos []ConnectionInfo
+	for _, connection := range c.storage.ConnectionsByUserID(ctx, userID) {
+		if info := c.storage.ConnectionInfo(ctx, connection.ID()); info != nil {
+			infos = append(infos, *info)
+		}
+	}
+
+	return infos
+}
+
+// Broadcast sends the input message to all the connections, regardless of
+// their subscriptions. The message is sent in the `announcement` channel.
+func (c *Channelize) Broadcast(ctx context.Context, message interface{}) error {
+	return c.dispatcher.Broadcast(ctx, message)
+}
+
+// UnregisterChannel removes the input channel from the registered channels and
+// removes all of its subscriptions. The clients can't subscribe to the channel
+// anymore, until it is registered again.
+func (c *Channelize) UnregisterChannel(ctx context.Context, ch channel.Channel) {
+	channel.UnregisterChannel(ch)
+	c.storage.RemoveChannel(ctx, ch)
+}
+
+// MakeAdminHandler creates an HTTP handler for the operators. It serves the
+// registered channels, connections and users as JSON, and the POST actions to
+// disconnect connections, unregister channels and broadcast messages. Every
+// request must be accepted by the input authFunc. If authFunc is nil, all the
+// requests are rejected with http.StatusForbidden.
+//
+// The handler routes are relative, so it should be mounted with http.StripPrefix:
+//
+//	mux.Handle("/admin/", http.StripPrefix("/admin", chlz.MakeAdminHandler(authFunc)))
+func (c *Channelize) MakeAdminHandler(authFunc AdminAuthFunc) http.Handler {
+	return admin.NewHandler(c, authFunc)
+}
+
 // SendPrivateMessage sends the message to the input channel.
 func (c *Channelize) SendPrivateMessage(ctx context.Context, ch channel.Channel, userID string, message interface{}) error {
 	return c.dispatcher.SendPrivateMessage(ctx, ch, userID, message)
 }
 
+// SendToConnection sends the message to the connection with the input connID
+// in the input channel. The connection doesn't need a user ID or a subscription
+// to the channel, e.g. an anonymous connection in an onboarding flow. It returns
+// error if the channel isn't registered, the connection doesn't exist, or its
+// outbound buffer is full. If the channel is private, the connection must have
+// a valid token.
+func (c *Channelize) SendToConnection(ctx context.Context, connID string, ch channel.Channel, message interface{}) error {
+	return c.dispatcher.SendToConnection(ctx, connID, ch, message)
+}
+
+// SendPublicMessages sends a batch of messages to the connections of their
+// channels, e.g. the records of a Kafka batch. It takes a single snapshot of
+// the storage for all the channels and marshals each message once. Each
+// connection receives its messages in the input order. If the fan-out pool is
+// enabled, the messages are sent by the fan-out workers.
+//
+// The returned results have the same order as the input envelopes.
+func (c *Channelize) SendPublicMessages(ctx context.Context, envelopes []Envelope) []EnvelopeResult {
+	return c.dispatcher.SendPublicMessages(ctx, envelopes)
+}
+
+// SendToTag sends the message to all the connections that subscribed to the
+// input channel and have the input tag, e.g. all the users of an organization.
+// The message is marshaled once for all the connections. If the channel is
+// private, the connections without a valid token are skipped.
+func (c *Channelize) SendToTag(ctx context.Context, ch channel.Channel, tag string, message interface{}) error {
+	return c.dispatcher.SendToTag(ctx, ch, tag, message)
+}
+
 // RegisterPublicChannel creates and registers a new channel by calling the
 // internal channel.RegisterPublicChannel function. It returns the created
 // channel.
-func RegisterPublicChannel(channelStr string) channel.Channel {
-	return channel.RegisterPublicChannel(channelStr)
+func RegisterPublicChannel(channelStr string, options ...ChannelOption) channel.Channel {
+	return channel.RegisterPublicChannel(channelStr, options...)
 }
 
 // RegisterPublicChannels creates and registers a list of input channels by
@@ -178,15 +1015,36 @@ func RegisterPublicChannels(channels ...string) []channel.Channel {
 // RegisterPrivateChannel creates and registers a new channel by calling the
 // internal channel.RegisterPrivateChannel function. It returns the created
 // channel.
-func RegisterPrivateChannel(channelStr string) channel.Channel {
-	return channel.RegisterPublicChannel(channelStr)
+func RegisterPrivateChannel(channelStr string, options ...ChannelOption) channel.Channel {
+	return channel.RegisterPrivateChannel(channelStr, options...)
 }
 
 // RegisterPrivateChannels creates and registers a list of input channels by
 // calling the internal channel.RegisterPrivateChannels function. It returns
 // a list of created channels.
 func RegisterPrivateChannels(channels ...string) []channel.Channel {
-	return channel.RegisterPublicChannels(channels...)
+	return channel.RegisterPrivateChannels(channels...)
+}
+
+// WithSnapshot sets the snapshot provider of the channel. The provider is
+// called after subscribing to the channel, and its result is sent as the
+// first message of the channel. The messages that are published meanwhile
+// are delivered after the snapshot.
+func WithSnapshot(snapshot SnapshotFunc) ChannelOption {
+	return channel.WithSnapshot(snapshot)
+}
+
+// WithClientPublish allows the subscribers of the channel to publish messages
+// to the channel. The input function authorizes, validates, and transforms
+// the messages. If it is nil, the messages are sent as they are.
+func WithClientPublish(authorize PublishFunc) ChannelOption {
+	return channel.WithClientPublish(authorize)
+}
+
+// WithEchoSuppression prevents sending the client messages back to the
+// publisher connection.
+func WithEchoSuppression(enabled bool) ChannelOption {
+	return channel.WithEchoSuppression(enabled)
 }
 
 // WithOutboundBufferSize sets the outbound buffer size.
@@ -208,3 +1066,39 @@ func WithPingPeriod(duration time.Duration) conn.Option {
 func WithPingMessageFunc(messageFunc conn.PingMessageFunc) conn.Option {
 	return conn.WithPingMessageFunc(messageFunc)
 }
+
+// WithReadLimit sets the maximum size in bytes for an inbound message.
+func WithReadLimit(limit int64) conn.Option {
+	return conn.WithReadLimit(limit)
+}
+
+// WithInboundRateLimit sets the inbound message rate limit per connection.
+// The rate is the number of messages per second, and burst is the maximum
+// number of messages that can be received at once.
+func WithInboundRateLimit(rate float64, burst int) conn.Option {
+	return conn.WithInboundRateLimit(rate, burst)
+}
+
+// WithMaxRateLimitViolations sets the number of consecutive rate limited messages
+// that closes the connection with the policy violation close code.
+func WithMaxRateLimitViolations(n int) conn.Option {
+	return conn.WithMaxRateLimitViolations(n)
+}
+
+// WithAuthToken sets the auth token details of a client that has been already
+// authenticated, e.g. in a custom HTTP handler that calls CreateConnection.
+func WithAuthToken(token *auth.Token) conn.Option {
+	return conn.WithToken(token)
+}
+
+// WithTokenExpiryNotice sets the duration before the token expiration that the
+// client is notified in the auth channel to refresh the token.
+func WithTokenExpiryNotice(duration time.Duration) conn.Option {
+	return conn.WithTokenExpiryNotice(duration)
+}
+
+// WithBufferOccupancyMetric enables observing the outbound buffer occupancy
+// ratio of the connection on each outbound message.
+func WithBufferOccupancyMetric(enabled bool) conn.Option {
+	return conn.WithBufferOccupancy(enabled)
+}
@@ -6,17 +6,26 @@ package channelize
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 
+	"github.com/hmdsefi/channelize/auth"
 	"github.com/hmdsefi/channelize/internal/channel"
 	"github.com/hmdsefi/channelize/internal/common"
+	"github.com/hmdsefi/channelize/internal/common/errorx"
 	"github.com/hmdsefi/channelize/internal/conn"
 	"github.com/hmdsefi/channelize/internal/core"
+	"github.com/hmdsefi/channelize/internal/hooks"
+	"github.com/hmdsefi/channelize/internal/rpc"
 )
 
 // store is an interface this provides the ability of storing mapping
 // between connections and channels. It can register a connection into
 // the storage or remove it from the storage.
 type store interface {
+	// Add stores the input connection without any subscription.
+	Add(ctx context.Context, conn common.ConnectionWrapper)
+
 	// Subscribe creates a mapping between the connection and input channels.
 	Subscribe(ctx context.Context, conn common.ConnectionWrapper, channels ...channel.Channel)
 
@@ -24,19 +33,65 @@ type store interface {
 	// and channels.
 	Unsubscribe(ctx context.Context, connID string, channels ...channel.Channel)
 
+	// Replace replaces the stored connection with the same ID, e.g. after
+	// releasing its core.SnapshotGate.
+	Replace(ctx context.Context, conn common.ConnectionWrapper)
+
 	// Remove removes all the subscriptions for the input connection.
 	Remove(ctx context.Context, connID string, userID *string)
+
+	// Channels returns the list of channels that the input connection subscribed.
+	Channels(ctx context.Context, connID string) []channel.Channel
+
+	// ConnectionInfo returns the metadata and the channels of the input
+	// connection. It returns nil if the connection doesn't exist.
+	ConnectionInfo(ctx context.Context, connID string) *common.ConnectionInfo
+}
+
+// publisher sends the client messages to the channel subscribers.
+type publisher interface {
+	// SendClientMessage sends the input message to the subscribers of the
+	// channel, except the connection with excludeConnID.
+	SendClientMessage(ctx context.Context, ch channel.Channel, message interface{}, excludeConnID string) error
+}
+
+// helperCollector is an interface for collecting the inbound message metrics.
+type helperCollector interface {
+	// AuthFailuresInc increases the total number of failed authentications.
+	AuthFailuresInc()
 }
 
 // helper provides functionalities to the connection to register and unregister
 // itself into the storage.
 type helper struct {
-	store store
+	store      store
+	publisher  publisher
+	collector  helperCollector
+	authorizer auth.Authorizer
+	hooks      hooks.Hooks
+
+	// handlers stores the custom message handlers by their message type.
+	handlers map[string]rpc.Route
+
+	// maxSubscriptions represents the maximum number of channels that a
+	// connection can subscribe. Zero means there is no limit.
+	maxSubscriptions int
+
+	// maxChannelsPerRequest represents the maximum number of channels in
+	// a single inbound message. Zero means there is no limit.
+	maxChannelsPerRequest int
 }
 
-func newHelper(store store) *helper {
+func newHelper(store store, publisher publisher, collector helperCollector, config *Config) *helper {
 	return &helper{
-		store: store,
+		store:                 store,
+		publisher:             publisher,
+		collector:             collector,
+		authorizer:            config.authorizer,
+		hooks:                 config.hooks,
+		handlers:              config.handlers,
+		maxSubscriptions:      config.maxSubscriptions,
+		maxChannelsPerRequest: config.maxChannelsPerRequest,
 	}
 }
 
@@ -52,32 +107,343 @@ func newHelper(store store) *helper {
 func (h *helper) ParseMessage(ctx context.Context, connection *conn.Connection, data []byte) {
 	msg, err := core.UnmarshalMessageIn(data)
 	if err != nil {
-		// TODO write error to the websocket connection 'error' channel
+		h.SendError(connection, err)
+		return
+	}
+
+	// the custom messages are passed to their handlers without validation,
+	// but only the anonymous handlers accept the unauthenticated connections.
+	if route, ok := h.handlers[msg.MessageType.String()]; ok {
+		reply := rpc.NewReplyFunc(connection, msg.ID, msg.MessageType)
+		if err := route.Serve(ctx, connection, msg.RawParams, reply); err != nil {
+			if msg.ID == "" {
+				h.SendError(connection, err)
+				return
+			}
+
+			if replyErr := reply(nil, err); replyErr != nil {
+				connection.Logger().Error("failed to reply custom message", common.LogFieldError, replyErr.Error())
+			}
+		}
+
 		return
 	}
 
-	if res := msg.Validate(); !res.IsValid() {
-		// TODO write error to the websocket connection 'error' channel
+	// private channels don't need the token parameter if the connection has
+	// been already authenticated, e.g. during the websocket handshake. The
+	// expired token is not validated again, it is left to the token sweeper
+	// and the token refresh.
+	validate := msg.Validate
+	if !msg.Params.HasToken() && connection.IsAuthenticated() {
+		validate = msg.ValidateAuthenticated
+	}
+
+	if res := validate(); !res.IsValid() {
+		h.send(connection, core.NewValidationErrorMessageOut(res))
+		return
+	}
+
+	// refresh the connection token without changing the subscriptions.
+	if msg.MessageType == core.MessageTypeRefresh {
+		h.refresh(ctx, connection, *msg.Params.Token)
+		return
+	}
+
+	if h.maxChannelsPerRequest > 0 && len(msg.Params.Channels) > h.maxChannelsPerRequest {
+		h.SendError(connection, errorx.NewChannelizeError(errorx.CodeTooManyChannels))
 		return
 	}
 
 	// validate token and store it in connection if it exists in the message.
 	if msg.Params.HasToken() {
-		if err := connection.AuthenticateAndStore(*msg.Params.Token); err != nil {
-			// TODO write error to the websocket connection 'error' channel
+		if err := connection.AuthenticateAndStore(ctx, *msg.Params.Token); err != nil {
+			h.collector.AuthFailuresInc()
+			h.SendError(connection, err)
 			return
 		}
 	}
 
 	switch msg.MessageType {
 	case core.MessageTypeSubscribe:
-		h.store.Subscribe(ctx, connection, msg.Params.Channels...)
+		if h.exceedsMaxSubscriptions(ctx, connection.ID(), msg.Params.Channels) {
+			h.SendError(connection, errorx.NewChannelizeError(errorx.CodeTooManySubscriptions))
+			return
+		}
+
+		if err := h.authorize(ctx, connection, msg.Params.Channels); err != nil {
+			h.SendError(connection, err)
+			return
+		}
+
+		if err := h.hooks.Subscribe(ctx, h.connectionInfo(ctx, connection), msg.Params.Channels); err != nil {
+			h.SendError(connection, err)
+			return
+		}
+
+		h.subscribe(ctx, connection, msg.Params.Channels, msg.RawParams)
 	case core.MessageTypeUnsubscribe:
 		h.store.Unsubscribe(ctx, connection.ID(), msg.Params.Channels...)
+		h.hooks.Unsubscribe(ctx, h.connectionInfo(ctx, connection), msg.Params.Channels)
+	case core.MessageTypePublish:
+		h.publish(ctx, connection, msg.ID, msg.Params.Channel, msg.Params.Data)
+	}
+}
+
+// publish authorizes the client message and sends it to the subscribers of
+// the channel. The publisher should be subscribed to the channel. If the
+// message has an ID, the result is sent to the reply channel. Otherwise, only
+// the errors are sent to the error channel.
+func (h *helper) publish(ctx context.Context, connection *conn.Connection, id string, ch channel.Channel, data json.RawMessage) {
+	reply := rpc.NewReplyFunc(connection, id, core.MessageTypePublish)
+	respond := func(err error) {
+		if id == "" {
+			if err != nil {
+				h.SendError(connection, err)
+			}
+			return
+		}
+
+		if replyErr := reply(nil, err); replyErr != nil {
+			connection.Logger().Error("failed to reply publish message", common.LogFieldError, replyErr.Error())
+		}
+	}
+
+	if !h.isSubscribed(ctx, connection.ID(), ch) {
+		respond(errorx.NewChannelizeErrorWithErr(errorx.CodeNotSubscribed, errors.New(ch.String())))
+		return
+	}
+
+	message, err := ch.AuthorizePublish(ctx, connection.Token(), data)
+	if err != nil {
+		var chanErr *errorx.ChannelizeError
+		if !errors.As(err, &chanErr) {
+			err = errorx.NewChannelizeErrorWithErr(errorx.CodePublishRejected, err)
+		}
+
+		respond(err)
+		return
+	}
+
+	var excludeConnID string
+	if ch.SuppressEcho() {
+		excludeConnID = connection.ID()
+	}
+
+	respond(h.publisher.SendClientMessage(ctx, ch, message, excludeConnID))
+}
+
+// isSubscribed returns true if the input connection subscribed to the channel.
+func (h *helper) isSubscribed(ctx context.Context, connID string, ch channel.Channel) bool {
+	for _, subscribed := range h.store.Channels(ctx, connID) {
+		if subscribed == ch {
+			return true
+		}
+	}
+
+	return false
+}
+
+// subscribe stores the subscriptions of the connection. The channels that
+// have a snapshot provider are subscribed through a core.SnapshotGate, so
+// their snapshots are delivered before the messages that are published in
+// the meantime. If a snapshot provider fails, the connection is unsubscribed
+// from its channel and the error is sent to the error channel. After releasing
+// the gate, the connection itself is stored instead of the gate.
+func (h *helper) subscribe(ctx context.Context, connection *conn.Connection, channels []channel.Channel, params json.RawMessage) {
+	var plain, snapshotted []channel.Channel
+	providers := make(map[channel.Channel]channel.SnapshotFunc)
+	for _, ch := range channels {
+		if provider := ch.Snapshot(); provider != nil {
+			providers[ch] = provider
+			snapshotted = append(snapshotted, ch)
+			continue
+		}
+
+		plain = append(plain, ch)
+	}
+
+	if len(snapshotted) == 0 {
+		h.store.Subscribe(ctx, connection, channels...)
+		return
+	}
+
+	gate := core.NewSnapshotGate(connection)
+	h.store.Subscribe(ctx, gate, snapshotted...)
+	if len(plain) != 0 {
+		h.store.Subscribe(ctx, connection, plain...)
 	}
+
+	snapshots := make([][]byte, 0, len(snapshotted))
+	for _, ch := range snapshotted {
+		snapshot, err := h.snapshot(ctx, connection, ch, providers[ch], params)
+		if err != nil {
+			h.store.Unsubscribe(ctx, connection.ID(), ch)
+			h.SendError(connection, err)
+			continue
+		}
+
+		snapshots = append(snapshots, snapshot)
+	}
+
+	gate.Release(ctx, snapshots...)
+	h.store.Replace(ctx, connection)
+}
+
+// snapshot calls the snapshot provider of the input channel and serializes
+// its result as the snapshot message of the channel.
+func (h *helper) snapshot(
+	ctx context.Context,
+	connection *conn.Connection,
+	ch channel.Channel,
+	provider channel.SnapshotFunc,
+	params json.RawMessage,
+) ([]byte, error) {
+	data, err := provider(ctx, connection.Token(), params)
+	if err != nil {
+		connection.Logger().Error(
+			errorx.ErrorMsgSnapshotFailed,
+			common.LogFieldChannel, ch.String(),
+			common.LogFieldError, err.Error(),
+		)
+
+		return nil, errorx.NewChannelizeErrorWithErr(errorx.CodeSnapshotFailed, errors.New(ch.String()))
+	}
+
+	snapshot, err := json.Marshal(core.NewSnapshotMessageOut(ch, data))
+	if err != nil {
+		connection.Logger().Error(errorx.ErrorMsgMarshalOutboundMessage, common.LogFieldError, err.Error())
+
+		return nil, errorx.NewChannelizeErrorWithErr(errorx.CodeFailedToMarshalMessage, errors.New(ch.String()))
+	}
+
+	return snapshot, nil
+}
+
+// refresh replaces the connection token with the input token and acknowledges
+// it in the auth channel. It sends the error to the error channel if the token
+// is not valid, and keeps the current token.
+func (h *helper) refresh(ctx context.Context, connection *conn.Connection, token string) {
+	if err := connection.RefreshToken(ctx, token); err != nil {
+		h.collector.AuthFailuresInc()
+		h.SendError(connection, err)
+		return
+	}
+
+	h.send(connection, core.NewAuthEventMessageOut(core.AuthEventTokenRefreshed, connection.Token().ExpiresAt))
+}
+
+// exceedsMaxSubscriptions returns true if subscribing to the input channels
+// exceeds the maximum number of subscriptions of the connection.
+func (h *helper) exceedsMaxSubscriptions(ctx context.Context, connID string, channels []channel.Channel) bool {
+	if h.maxSubscriptions <= 0 {
+		return false
+	}
+
+	subscribed := make(map[channel.Channel]struct{})
+	for _, ch := range h.store.Channels(ctx, connID) {
+		subscribed[ch] = struct{}{}
+	}
+
+	for _, ch := range channels {
+		subscribed[ch] = struct{}{}
+	}
+
+	return len(subscribed) > h.maxSubscriptions
+}
+
+// authorize checks the access of the connection to the input private channels
+// by calling the authorizer. It returns error for the first denied channel.
+func (h *helper) authorize(ctx context.Context, connection *conn.Connection, channels []channel.Channel) error {
+	if h.authorizer == nil {
+		return nil
+	}
+
+	for _, ch := range channels {
+		if !ch.IsSupportedPrivateChannel() {
+			continue
+		}
+
+		if err := h.authorizer.Authorize(ctx, connection.Token(), ch.String()); err != nil {
+			connection.Logger().Debug(errorx.ErrorMsgAccessDenied, common.LogFieldError, err.Error())
+
+			return errorx.NewChannelizeErrorWithErr(errorx.CodeAccessDenied, errors.New(ch.String()))
+		}
+	}
+
+	return nil
 }
 
-// Remove removes a connection from the storage.
+// Register adds the input connection to the storage. It returns error if
+// the OnConnect hook, or the OnAuth hook for the handshake token, rejects
+// the connection.
+func (h *helper) Register(ctx context.Context, connection *conn.Connection) error {
+	info := connection.Info()
+	if token := connection.Token(); token != nil {
+		if err := h.hooks.Auth(ctx, info, token); err != nil {
+			return err
+		}
+	}
+
+	if err := h.hooks.Connect(ctx, info); err != nil {
+		return err
+	}
+
+	h.store.Add(ctx, connection)
+
+	return nil
+}
+
+// ApproveToken calls the OnAuth hook before storing the validated token in
+// the connection.
+func (h *helper) ApproveToken(ctx context.Context, connection *conn.Connection, token *auth.Token) error {
+	return h.hooks.Auth(ctx, h.connectionInfo(ctx, connection), token)
+}
+
+// Remove removes a connection from the storage and calls the OnDisconnect hook.
 func (h *helper) Remove(ctx context.Context, connID string, userID *string) {
+	info := h.store.ConnectionInfo(ctx, connID)
+
 	h.store.Remove(ctx, connID, userID)
+
+	if info != nil {
+		h.hooks.Disconnect(ctx, *info)
+	}
+}
+
+// connectionInfo returns the metadata and the subscribed channels of the
+// input connection.
+func (h *helper) connectionInfo(ctx context.Context, connection *conn.Connection) common.ConnectionInfo {
+	info := connection.Info()
+	info.Channels = h.store.Channels(ctx, connection.ID())
+
+	return info
+}
+
+// SendError sends the input error to the error channel of the connection.
+func (h *helper) SendError(connection *conn.Connection, err error) {
+	h.send(connection, core.NewErrorMessageOut(err))
+}
+
+// NotifyTokenExpiring sends the token expiration notice to the auth channel
+// of the connection.
+func (h *helper) NotifyTokenExpiring(connection *conn.Connection) {
+	token := connection.Token()
+	if token == nil {
+		return
+	}
+
+	h.send(connection, core.NewAuthEventMessageOut(core.AuthEventTokenExpiring, token.ExpiresAt))
+}
+
+// send serializes the input message and sends it to the connection.
+func (h *helper) send(connection *conn.Connection, msgOut *core.MessageOut) {
+	msgOutBytes, err := json.Marshal(msgOut)
+	if err != nil {
+		connection.Logger().Error(errorx.ErrorMsgMarshalOutboundMessage, common.LogFieldError, err.Error())
+		return
+	}
+
+	if err = connection.SendMessage(msgOutBytes); err != nil {
+		connection.Logger().Error("failed to send message to the outbound buffer", common.LogFieldError, err.Error())
+	}
 }
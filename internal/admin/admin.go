@@ -0,0 +1,326 @@
+/**
+ * Copyright © 2022 Hamed Yousefi <hdyousefi@gmail.com>.
+ */
+
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+
+	"github.com/hmdsefi/channelize/internal/channel"
+	"github.com/hmdsefi/channelize/internal/common"
+)
+
+const (
+	ErrorMsgUnauthorized          = "unauthorized"
+	ErrorMsgAuthIsNotConfigured   = "admin auth function is not configured"
+	ErrorMsgMethodNotAllowed      = "method not allowed"
+	ErrorMsgInvalidRequestBody    = "invalid request body"
+	ErrorMsgDisconnectTarget      = "exactly one of connection_id and user_id is required"
+	ErrorMsgConnectionNotFound    = "connection not found"
+	ErrorMsgUserNotFound          = "user has no connection"
+	ErrorMsgChannelNotFound       = "channel is not registered"
+	ErrorMsgBroadcastChannel      = "broadcast channel should be a public channel"
+	ErrorMsgBroadcastMessageEmpty = "message is empty"
+
+	// defaultDisconnectReason is the close message reason if the request
+	// doesn't have any reason.
+	defaultDisconnectReason = "disconnected by the server"
+
+	// maxRequestBodySize is the maximum size of the POST request body.
+	maxRequestBodySize = 1 << 20
+
+	channelTypePublic  = "public"
+	channelTypePrivate = "private"
+)
+
+// AuthFunc is a function type that authorizes the admin requests. It returns
+// nil to accept the request. Any error rejects the request with
+// http.StatusUnauthorized.
+type AuthFunc func(r *http.Request) error
+
+// Backend provides the state and the control actions to the admin handler.
+type Backend interface {
+	// SubscriberCounts returns the number of subscribers per channel.
+	SubscriberCounts(ctx context.Context) map[channel.Channel]int
+
+	// Connections returns the metadata of all the connections.
+	Connections(ctx context.Context) []common.ConnectionInfo
+
+	// DisconnectConnection closes the connection with the input connID.
+	DisconnectConnection(ctx context.Context, connID string, reason string) error
+
+	// DisconnectUser closes all the connections of the input userID and returns
+	// the number of closed connections.
+	DisconnectUser(ctx context.Context, userID string, reason string) int
+
+	// UnregisterChannel removes the channel and all of its subscriptions.
+	UnregisterChannel(ctx context.Context, ch channel.Channel)
+
+	// SendPublicMessage sends the input message to the subscribers of the channel.
+	SendPublicMessage(ctx context.Context, ch channel.Channel, message interface{}) error
+
+	// Broadcast sends the input message to all the connections.
+	Broadcast(ctx context.Context, message interface{}) error
+}
+
+// ChannelInfo represents a registered channel in the channels listing.
+type ChannelInfo struct {
+	Name        channel.Channel `json:"name"`
+	Type        string          `json:"type"`
+	Subscribers int             `json:"subscribers"`
+}
+
+// UserInfo represents an authenticated user in the users listing.
+type UserInfo struct {
+	UserID      string `json:"user_id"`
+	Connections int    `json:"connections"`
+}
+
+type disconnectRequest struct {
+	ConnectionID string `json:"connection_id"`
+	UserID       string `json:"user_id"`
+	Reason       string `json:"reason"`
+}
+
+type disconnectResponse struct {
+	Disconnected int `json:"disconnected"`
+}
+
+type unregisterRequest struct {
+	Channel channel.Channel `json:"channel"`
+}
+
+type broadcastRequest struct {
+	// Channel is the target public channel. If it is empty, the message is
+	// sent to all the connections in the announcement channel.
+	Channel channel.Channel `json:"channel"`
+	Message json.RawMessage `json:"message"`
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// Handler serves the live state of the Channelize as JSON and the control
+// actions for the operators. All the requests should pass the auth function.
+//
+// The handler serves the following routes:
+//
+//	GET  /channels             registered channels with their subscriber counts
+//	GET  /connections          connections metadata, filtered by ?user_id=
+//	GET  /users                authenticated users with their connection counts
+//	POST /disconnect           closes a connection or all the connections of a user
+//	POST /channels/unregister  unregisters a channel and removes its subscriptions
+//	POST /broadcast            sends a message to a public channel or all the connections
+type Handler struct {
+	backend  Backend
+	authFunc AuthFunc
+	mux      *http.ServeMux
+}
+
+// NewHandler creates a new instance of Handler. If the input authFunc is nil,
+// all the requests are rejected with http.StatusForbidden.
+func NewHandler(backend Backend, authFunc AuthFunc) *Handler {
+	h := &Handler{
+		backend:  backend,
+		authFunc: authFunc,
+		mux:      http.NewServeMux(),
+	}
+
+	h.mux.HandleFunc("/channels", h.method(http.MethodGet, h.channels))
+	h.mux.HandleFunc("/connections", h.method(http.MethodGet, h.connections))
+	h.mux.HandleFunc("/users", h.method(http.MethodGet, h.users))
+	h.mux.HandleFunc("/disconnect", h.method(http.MethodPost, h.disconnect))
+	h.mux.HandleFunc("/channels/unregister", h.method(http.MethodPost, h.unregister))
+	h.mux.HandleFunc("/broadcast", h.method(http.MethodPost, h.broadcast))
+
+	return h
+}
+
+// ServeHTTP checks the request authorization and serves the admin routes.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if h.authFunc == nil {
+		writeError(w, http.StatusForbidden, ErrorMsgAuthIsNotConfigured)
+		return
+	}
+
+	if err := h.authFunc(r); err != nil {
+		writeError(w, http.StatusUnauthorized, ErrorMsgUnauthorized)
+		return
+	}
+
+	h.mux.ServeHTTP(w, r)
+}
+
+// method rejects the requests with other HTTP methods.
+func (h *Handler) method(method string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != method {
+			w.Header().Set("Allow", method)
+			writeError(w, http.StatusMethodNotAllowed, ErrorMsgMethodNotAllowed)
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+func (h *Handler) channels(w http.ResponseWriter, r *http.Request) {
+	counts := h.backend.SubscriberCounts(r.Context())
+
+	infos := make([]ChannelInfo, 0)
+	for _, ch := range channel.PublicChannels() {
+		infos = append(infos, ChannelInfo{Name: ch, Type: channelTypePublic, Subscribers: counts[ch]})
+	}
+
+	for _, ch := range channel.PrivateChannels() {
+		infos = append(infos, ChannelInfo{Name: ch, Type: channelTypePrivate, Subscribers: counts[ch]})
+	}
+
+	writeJSON(w, http.StatusOK, infos)
+}
+
+func (h *Handler) connections(w http.ResponseWriter, r *http.Request) {
+	userID := r.URL.Query().Get("user_id")
+
+	infos := make([]common.ConnectionInfo, 0)
+	for _, info := range h.backend.Connections(r.Context()) {
+		if userID == "" || info.UserID == userID {
+			infos = append(infos, info)
+		}
+	}
+
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].ConnectedAt.Before(infos[j].ConnectedAt)
+	})
+
+	writeJSON(w, http.StatusOK, infos)
+}
+
+func (h *Handler) users(w http.ResponseWriter, r *http.Request) {
+	counts := make(map[string]int)
+	for _, info := range h.backend.Connections(r.Context()) {
+		if info.UserID != "" {
+			counts[info.UserID]++
+		}
+	}
+
+	users := make([]UserInfo, 0, len(counts))
+	for userID, count := range counts {
+		users = append(users, UserInfo{UserID: userID, Connections: count})
+	}
+
+	sort.Slice(users, func(i, j int) bool {
+		return users[i].UserID < users[j].UserID
+	})
+
+	writeJSON(w, http.StatusOK, users)
+}
+
+func (h *Handler) disconnect(w http.ResponseWriter, r *http.Request) {
+	var req disconnectRequest
+	if !readJSON(w, r, &req) {
+		return
+	}
+
+	if (req.ConnectionID == "") == (req.UserID == "") {
+		writeError(w, http.StatusBadRequest, ErrorMsgDisconnectTarget)
+		return
+	}
+
+	if req.Reason == "" {
+		req.Reason = defaultDisconnectReason
+	}
+
+	if req.ConnectionID != "" {
+		if err := h.backend.DisconnectConnection(r.Context(), req.ConnectionID, req.Reason); err != nil {
+			writeError(w, http.StatusNotFound, ErrorMsgConnectionNotFound)
+			return
+		}
+
+		writeJSON(w, http.StatusOK, disconnectResponse{Disconnected: 1})
+		return
+	}
+
+	disconnected := h.backend.DisconnectUser(r.Context(), req.UserID, req.Reason)
+	if disconnected == 0 {
+		writeError(w, http.StatusNotFound, ErrorMsgUserNotFound)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, disconnectResponse{Disconnected: disconnected})
+}
+
+func (h *Handler) unregister(w http.ResponseWriter, r *http.Request) {
+	var req unregisterRequest
+	if !readJSON(w, r, &req) {
+		return
+	}
+
+	if !req.Channel.IsSupportedChannel() {
+		writeError(w, http.StatusNotFound, ErrorMsgChannelNotFound)
+		return
+	}
+
+	h.backend.UnregisterChannel(r.Context(), req.Channel)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) broadcast(w http.ResponseWriter, r *http.Request) {
+	var req broadcastRequest
+	if !readJSON(w, r, &req) {
+		return
+	}
+
+	if len(req.Message) == 0 {
+		writeError(w, http.StatusBadRequest, ErrorMsgBroadcastMessageEmpty)
+		return
+	}
+
+	var err error
+	switch {
+	case req.Channel == "":
+		err = h.backend.Broadcast(r.Context(), req.Message)
+	case req.Channel.IsSupportedPublicChannel():
+		err = h.backend.SendPublicMessage(r.Context(), req.Channel, req.Message)
+	default:
+		writeError(w, http.StatusBadRequest, ErrorMsgBroadcastChannel)
+		return
+	}
+
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// readJSON decodes the request body into the input value. It writes the
+// http.StatusBadRequest response and returns false if the body is invalid.
+func readJSON(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestBodySize))
+	decoder.DisallowUnknownFields()
+
+	if err := decoder.Decode(v); err != nil {
+		writeError(w, http.StatusBadRequest, ErrorMsgInvalidRequestBody)
+		return false
+	}
+
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, statusCode int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, statusCode int, msg string) {
+	writeJSON(w, statusCode, errorResponse{Error: msg})
+}
@@ -0,0 +1,239 @@
+/**
+ * Copyright © 2022 Hamed Yousefi <hdyousefi@gmail.com>.
+ */
+
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/hmdsefi/channelize/internal/channel"
+	"github.com/hmdsefi/channelize/internal/common"
+)
+
+const (
+	testUserID = "test-user-id"
+	testToken  = "test-admin-token" // nolint
+)
+
+var (
+	testPublicChannel  = channel.RegisterPublicChannel("admin-public-channel")
+	testPrivateChannel = channel.RegisterPrivateChannel("admin-private-channel")
+)
+
+type mockBackend struct {
+	connections  []common.ConnectionInfo
+	disconnected []string
+	unregistered []channel.Channel
+	published    map[channel.Channel]interface{}
+	broadcast    []interface{}
+}
+
+func newMockBackend() *mockBackend {
+	now := time.Now()
+	return &mockBackend{
+		connections: []common.ConnectionInfo{
+			{ID: "conn-2", UserID: testUserID, ConnectedAt: now.Add(time.Second)},
+			{ID: "conn-1", UserID: testUserID, ConnectedAt: now},
+			{ID: "conn-3", ConnectedAt: now.Add(2 * time.Second)},
+		},
+		published: make(map[channel.Channel]interface{}),
+	}
+}
+
+func (m *mockBackend) SubscriberCounts(_ context.Context) map[channel.Channel]int {
+	return map[channel.Channel]int{testPublicChannel: 3, testPrivateChannel: 2}
+}
+
+func (m *mockBackend) Connections(_ context.Context) []common.ConnectionInfo {
+	return m.connections
+}
+
+func (m *mockBackend) DisconnectConnection(_ context.Context, connID string, reason string) error {
+	for _, info := range m.connections {
+		if info.ID == connID {
+			m.disconnected = append(m.disconnected, connID+":"+reason)
+			return nil
+		}
+	}
+
+	return errors.New("not found")
+}
+
+func (m *mockBackend) DisconnectUser(_ context.Context, userID string, reason string) int {
+	var n int
+	for _, info := range m.connections {
+		if info.UserID == userID {
+			m.disconnected = append(m.disconnected, info.ID+":"+reason)
+			n++
+		}
+	}
+
+	return n
+}
+
+func (m *mockBackend) UnregisterChannel(_ context.Context, ch channel.Channel) {
+	m.unregistered = append(m.unregistered, ch)
+}
+
+func (m *mockBackend) SendPublicMessage(_ context.Context, ch channel.Channel, message interface{}) error {
+	m.published[ch] = message
+	return nil
+}
+
+func (m *mockBackend) Broadcast(_ context.Context, message interface{}) error {
+	m.broadcast = append(m.broadcast, message)
+	return nil
+}
+
+func testAuthFunc(r *http.Request) error {
+	if r.Header.Get("Authorization") != testToken {
+		return errors.New("invalid token")
+	}
+	return nil
+}
+
+func serve(handler http.Handler, method, path, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, path, strings.NewReader(body))
+	r.Header.Set("Authorization", testToken)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	return w
+}
+
+func TestHandler_Auth(t *testing.T) {
+	t.Run("missing auth func", func(t *testing.T) {
+		w := serve(NewHandler(newMockBackend(), nil), http.MethodGet, "/channels", "")
+		assert.Equal(t, http.StatusForbidden, w.Code)
+	})
+
+	t.Run("rejected request", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodGet, "/channels", nil)
+		w := httptest.NewRecorder()
+		NewHandler(newMockBackend(), testAuthFunc).ServeHTTP(w, r)
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		assert.JSONEq(t, `{"error":"unauthorized"}`, w.Body.String())
+	})
+
+	t.Run("method not allowed", func(t *testing.T) {
+		w := serve(NewHandler(newMockBackend(), testAuthFunc), http.MethodPost, "/channels", "")
+		assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+		assert.Equal(t, http.MethodGet, w.Header().Get("Allow"))
+	})
+}
+
+func TestHandler_Listings(t *testing.T) {
+	handler := NewHandler(newMockBackend(), testAuthFunc)
+
+	t.Run("channels", func(t *testing.T) {
+		w := serve(handler, http.MethodGet, "/channels", "")
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var infos []ChannelInfo
+		require.Nil(t, json.Unmarshal(w.Body.Bytes(), &infos))
+		assert.Contains(t, infos, ChannelInfo{Name: testPublicChannel, Type: channelTypePublic, Subscribers: 3})
+		assert.Contains(t, infos, ChannelInfo{Name: testPrivateChannel, Type: channelTypePrivate, Subscribers: 2})
+	})
+
+	t.Run("connections", func(t *testing.T) {
+		w := serve(handler, http.MethodGet, "/connections", "")
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var infos []common.ConnectionInfo
+		require.Nil(t, json.Unmarshal(w.Body.Bytes(), &infos))
+		require.Equal(t, 3, len(infos))
+		assert.Equal(t, []string{"conn-1", "conn-2", "conn-3"}, []string{infos[0].ID, infos[1].ID, infos[2].ID})
+	})
+
+	t.Run("user connections", func(t *testing.T) {
+		w := serve(handler, http.MethodGet, "/connections?user_id="+testUserID, "")
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var infos []common.ConnectionInfo
+		require.Nil(t, json.Unmarshal(w.Body.Bytes(), &infos))
+		assert.Equal(t, 2, len(infos))
+	})
+
+	t.Run("users", func(t *testing.T) {
+		w := serve(handler, http.MethodGet, "/users", "")
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.JSONEq(t, `[{"user_id":"test-user-id","connections":2}]`, w.Body.String())
+	})
+}
+
+func TestHandler_Disconnect(t *testing.T) {
+	t.Run("disconnect connection", func(t *testing.T) {
+		backend := newMockBackend()
+		w := serve(NewHandler(backend, testAuthFunc), http.MethodPost, "/disconnect", `{"connection_id":"conn-3","reason":"bye"}`)
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.JSONEq(t, `{"disconnected":1}`, w.Body.String())
+		assert.Equal(t, []string{"conn-3:bye"}, backend.disconnected)
+	})
+
+	t.Run("disconnect user", func(t *testing.T) {
+		backend := newMockBackend()
+		w := serve(NewHandler(backend, testAuthFunc), http.MethodPost, "/disconnect", `{"user_id":"test-user-id"}`)
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.JSONEq(t, `{"disconnected":2}`, w.Body.String())
+		assert.Equal(t, []string{
+			"conn-2:" + defaultDisconnectReason,
+			"conn-1:" + defaultDisconnectReason,
+		}, backend.disconnected)
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		handler := NewHandler(newMockBackend(), testAuthFunc)
+		assert.Equal(t, http.StatusNotFound, serve(handler, http.MethodPost, "/disconnect", `{"connection_id":"unknown"}`).Code)
+		assert.Equal(t, http.StatusNotFound, serve(handler, http.MethodPost, "/disconnect", `{"user_id":"unknown"}`).Code)
+	})
+
+	t.Run("invalid request", func(t *testing.T) {
+		handler := NewHandler(newMockBackend(), testAuthFunc)
+		assert.Equal(t, http.StatusBadRequest, serve(handler, http.MethodPost, "/disconnect", `{}`).Code)
+		assert.Equal(t, http.StatusBadRequest, serve(handler, http.MethodPost, "/disconnect", `{"connection_id":"a","user_id":"b"}`).Code)
+		assert.Equal(t, http.StatusBadRequest, serve(handler, http.MethodPost, "/disconnect", `{"id":"a"}`).Code)
+		assert.Equal(t, http.StatusBadRequest, serve(handler, http.MethodPost, "/disconnect", `not json`).Code)
+	})
+}
+
+func TestHandler_Unregister(t *testing.T) {
+	backend := newMockBackend()
+	handler := NewHandler(backend, testAuthFunc)
+
+	w := serve(handler, http.MethodPost, "/channels/unregister", `{"channel":"admin-public-channel"}`)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, []channel.Channel{testPublicChannel}, backend.unregistered)
+
+	w = serve(handler, http.MethodPost, "/channels/unregister", `{"channel":"unknown-channel"}`)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestHandler_Broadcast(t *testing.T) {
+	backend := newMockBackend()
+	handler := NewHandler(backend, testAuthFunc)
+
+	w := serve(handler, http.MethodPost, "/broadcast", `{"message":{"text":"maintenance"}}`)
+	require.Equal(t, http.StatusNoContent, w.Code)
+	require.Equal(t, 1, len(backend.broadcast))
+	assert.JSONEq(t, `{"text":"maintenance"}`, string(backend.broadcast[0].(json.RawMessage)))
+
+	w = serve(handler, http.MethodPost, "/broadcast", `{"channel":"admin-public-channel","message":"hello"}`)
+	require.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, json.RawMessage(`"hello"`), backend.published[testPublicChannel])
+
+	w = serve(handler, http.MethodPost, "/broadcast", `{"channel":"admin-private-channel","message":"hello"}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = serve(handler, http.MethodPost, "/broadcast", `{"channel":"admin-public-channel"}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
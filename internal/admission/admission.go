@@ -0,0 +1,275 @@
+/**
+ * Copyright © 2022 Hamed Yousefi <hdyousefi@gmail.com>.
+ */
+
+package admission
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/hmdsefi/channelize/internal/common/ratelimit"
+)
+
+const (
+	ErrorMsgTooManyConnections      = "too many connections"
+	ErrorMsgTooManyConnectionsPerIP = "too many connections from the same address"
+	ErrorMsgUpgradeRateLimit        = "connection rate limit exceeded"
+	ErrorMsgRejected                = "connection rejected"
+)
+
+// Func is a function type that decides whether an upgrade request should be
+// accepted. It returns nil to accept the request. Returning an *Error rejects
+// the request with its status code, and any other error rejects the request
+// with http.StatusForbidden.
+type Func func(r *http.Request) error
+
+// Error represents the rejection of an upgrade request. The StatusCode will
+// be written to the HTTP response before the upgrade.
+type Error struct {
+	StatusCode int
+	Message    string
+}
+
+// NewError creates a new Error with the input status code and message.
+func NewError(statusCode int, message string) *Error {
+	return &Error{StatusCode: statusCode, Message: message}
+}
+
+func (e Error) Error() string {
+	return e.Message
+}
+
+// Config represents the admission controller configuration.
+type Config struct {
+	// maxConnections represents the maximum number of open connections.
+	// Zero means there is no limit.
+	maxConnections int
+
+	// maxConnectionsPerIP represents the maximum number of open connections
+	// per remote address. Zero means there is no limit.
+	maxConnectionsPerIP int
+
+	// ipHeader represents the HTTP header that holds the client address, e.g.
+	// X-Forwarded-For. If it is empty, the request remote address is used.
+	ipHeader string
+
+	// trustedHops represents the number of trusted proxies that append the
+	// address of their peer to the ipHeader. The default value is one.
+	trustedHops int
+
+	// upgradeRate represents the number of upgrades per second. Zero means
+	// there is no limit.
+	upgradeRate float64
+
+	// upgradeBurst represents the maximum number of upgrades at once.
+	upgradeBurst int
+
+	// admissionFunc is a custom hook to accept or reject the upgrade requests.
+	admissionFunc Func
+}
+
+type Option func(*Config)
+
+// WithMaxConnections sets the maximum number of open connections.
+func WithMaxConnections(n int) Option {
+	return func(config *Config) {
+		if config == nil {
+			return
+		}
+
+		config.maxConnections = n
+	}
+}
+
+// WithMaxConnectionsPerIP sets the maximum number of open connections per
+// remote address.
+func WithMaxConnectionsPerIP(n int) Option {
+	return func(config *Config) {
+		if config == nil {
+			return
+		}
+
+		config.maxConnectionsPerIP = n
+	}
+}
+
+// WithClientIPHeader sets the HTTP header that holds the client address. If
+// the header contains a list of addresses, the address that is appended by
+// the outermost trusted proxy is used, which is the rightmost address by
+// default. The leading addresses are set by the client, so they are ignored.
+func WithClientIPHeader(header string) Option {
+	return func(config *Config) {
+		if config == nil {
+			return
+		}
+
+		config.ipHeader = header
+	}
+}
+
+// WithTrustedProxyHops sets the number of trusted proxies in front of the
+// server that append the address of their peer to the client IP header. It
+// ignores the values less than one.
+func WithTrustedProxyHops(hops int) Option {
+	return func(config *Config) {
+		if config == nil || hops < 1 {
+			return
+		}
+
+		config.trustedHops = hops
+	}
+}
+
+// WithUpgradeRateLimit sets the rate limit of the upgrade requests.
+func WithUpgradeRateLimit(rate float64, burst int) Option {
+	return func(config *Config) {
+		if config == nil {
+			return
+		}
+
+		config.upgradeRate = rate
+		config.upgradeBurst = burst
+	}
+}
+
+// WithAdmissionFunc sets a custom admission hook.
+func WithAdmissionFunc(fn Func) Option {
+	return func(config *Config) {
+		if config == nil {
+			return
+		}
+
+		config.admissionFunc = fn
+	}
+}
+
+// Controller accepts or rejects the upgrade requests before creating the
+// websocket connections. It keeps the number of open connections in total
+// and per remote address.
+type Controller struct {
+	mu sync.Mutex
+
+	config Config
+
+	// limiter limits the rate of the upgrade requests. It is nil if the
+	// upgrade rate limit is not configured.
+	limiter *ratelimit.TokenBucket
+
+	// total represents the number of admitted connections.
+	total int
+
+	// perIP stores the number of admitted connections per remote address.
+	// map[ip]count
+	perIP map[string]int
+}
+
+// NewController creates a new instance of Controller.
+func NewController(options ...Option) *Controller {
+	config := &Config{trustedHops: 1}
+	for _, option := range options {
+		option(config)
+	}
+
+	controller := &Controller{
+		config: *config,
+		perIP:  make(map[string]int),
+	}
+
+	if config.upgradeRate > 0 {
+		controller.limiter = ratelimit.NewTokenBucket(config.upgradeRate, config.upgradeBurst)
+	}
+
+	return controller
+}
+
+// Admit decides whether the input upgrade request should be accepted. If
+// it is accepted, it reserves a connection slot and returns the client
+// address. The caller must call Release with the returned address after
+// closing the connection.
+//
+// It returns an *Error if the request should be rejected.
+func (c *Controller) Admit(r *http.Request) (string, error) {
+	if c.config.admissionFunc != nil {
+		if err := c.config.admissionFunc(r); err != nil {
+			var admissionErr *Error
+			if errors.As(err, &admissionErr) {
+				return "", admissionErr
+			}
+
+			return "", NewError(http.StatusForbidden, ErrorMsgRejected)
+		}
+	}
+
+	ip := c.clientIP(r)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.config.maxConnections > 0 && c.total >= c.config.maxConnections {
+		return "", NewError(http.StatusServiceUnavailable, ErrorMsgTooManyConnections)
+	}
+
+	if c.config.maxConnectionsPerIP > 0 && c.perIP[ip] >= c.config.maxConnectionsPerIP {
+		return "", NewError(http.StatusTooManyRequests, ErrorMsgTooManyConnectionsPerIP)
+	}
+
+	// the rate limit is checked after the capacity, so the rejected requests
+	// don't consume the upgrade rate.
+	if c.limiter != nil && !c.limiter.Allow() {
+		return "", NewError(http.StatusTooManyRequests, ErrorMsgUpgradeRateLimit)
+	}
+
+	c.total++
+	c.perIP[ip]++
+
+	return ip, nil
+}
+
+// Release releases the connection slot of the input client address.
+func (c *Controller) Release(ip string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.total > 0 {
+		c.total--
+	}
+
+	if c.perIP[ip] <= 1 {
+		delete(c.perIP, ip)
+		return
+	}
+
+	c.perIP[ip]--
+}
+
+// clientIP returns the client address. It uses the configured header if it
+// exists in the request. Otherwise, it uses the host of the remote address.
+//
+// The addresses of the header are counted from the right, since each proxy
+// appends its peer address and only the trusted proxies are reliable. If the
+// header has fewer addresses than the trusted hops, the request hasn't passed
+// through all the proxies and the header is ignored, since its left addresses
+// are set by the client.
+func (c *Controller) clientIP(r *http.Request) string {
+	if c.config.ipHeader != "" {
+		if value := r.Header.Get(c.config.ipHeader); value != "" {
+			addresses := strings.Split(value, ",")
+			if i := len(addresses) - c.config.trustedHops; i >= 0 {
+				if address := strings.TrimSpace(addresses[i]); address != "" {
+					return address
+				}
+			}
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
@@ -0,0 +1,189 @@
+/**
+ * Copyright © 2022 Hamed Yousefi <hdyousefi@gmail.com>.
+ */
+
+package admission
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testRemoteAddr = "10.0.0.1:4242"
+	testRemoteIP   = "10.0.0.1"
+)
+
+func newTestRequest(remoteAddr string) *http.Request {
+	r := httptest.NewRequest(http.MethodGet, "/ws", nil)
+	r.RemoteAddr = remoteAddr
+	return r
+}
+
+func requireAdmissionError(t *testing.T, err error, expectedStatus int, expectedMsg string) {
+	require.NotNil(t, err)
+	var admissionErr *Error
+	require.True(t, errors.As(err, &admissionErr))
+	assert.Equal(t, expectedStatus, admissionErr.StatusCode)
+	assert.Equal(t, expectedMsg, admissionErr.Error())
+}
+
+func TestController_Admit(t *testing.T) {
+	t.Run("no limit", func(t *testing.T) {
+		controller := NewController()
+		for i := 0; i < 100; i++ {
+			ip, err := controller.Admit(newTestRequest(testRemoteAddr))
+			require.Nil(t, err)
+			assert.Equal(t, testRemoteIP, ip)
+		}
+	})
+
+	t.Run("max connections", func(t *testing.T) {
+		controller := NewController(WithMaxConnections(2))
+		_, err := controller.Admit(newTestRequest("10.0.0.1:1"))
+		require.Nil(t, err)
+		ip, err := controller.Admit(newTestRequest("10.0.0.2:1"))
+		require.Nil(t, err)
+
+		_, err = controller.Admit(newTestRequest("10.0.0.3:1"))
+		requireAdmissionError(t, err, http.StatusServiceUnavailable, ErrorMsgTooManyConnections)
+
+		controller.Release(ip)
+		_, err = controller.Admit(newTestRequest("10.0.0.3:1"))
+		assert.Nil(t, err)
+	})
+
+	t.Run("max connections per ip", func(t *testing.T) {
+		controller := NewController(WithMaxConnectionsPerIP(1))
+		ip, err := controller.Admit(newTestRequest(testRemoteAddr))
+		require.Nil(t, err)
+
+		_, err = controller.Admit(newTestRequest(testRemoteAddr))
+		requireAdmissionError(t, err, http.StatusTooManyRequests, ErrorMsgTooManyConnectionsPerIP)
+
+		_, err = controller.Admit(newTestRequest("10.0.0.2:1"))
+		require.Nil(t, err)
+
+		controller.Release(ip)
+		_, err = controller.Admit(newTestRequest(testRemoteAddr))
+		assert.Nil(t, err)
+	})
+
+	t.Run("client ip header", func(t *testing.T) {
+		controller := NewController(WithClientIPHeader("X-Forwarded-For"), WithMaxConnectionsPerIP(1))
+
+		r := newTestRequest(testRemoteAddr)
+		r.Header.Set("X-Forwarded-For", "192.168.1.1, 172.16.0.1")
+		ip, err := controller.Admit(r)
+		require.Nil(t, err)
+		assert.Equal(t, "172.16.0.1", ip)
+
+		r = newTestRequest(testRemoteAddr)
+		r.Header.Set("X-Forwarded-For", "192.168.1.2")
+		_, err = controller.Admit(r)
+		require.Nil(t, err)
+
+		// the spoofed leading address is ignored.
+		r = newTestRequest(testRemoteAddr)
+		r.Header.Set("X-Forwarded-For", "192.168.1.3, 172.16.0.1")
+		_, err = controller.Admit(r)
+		assert.NotNil(t, err)
+
+		ip, err = controller.Admit(newTestRequest(testRemoteAddr))
+		require.Nil(t, err)
+		assert.Equal(t, testRemoteIP, ip)
+	})
+
+	t.Run("trusted proxy hops", func(t *testing.T) {
+		controller := NewController(
+			WithClientIPHeader("X-Forwarded-For"),
+			WithTrustedProxyHops(2),
+			WithMaxConnectionsPerIP(1),
+		)
+
+		r := newTestRequest(testRemoteAddr)
+		r.Header.Set("X-Forwarded-For", "1.1.1.1, 192.168.1.1, 10.0.0.1")
+		ip, err := controller.Admit(r)
+		require.Nil(t, err)
+		assert.Equal(t, "192.168.1.1", ip)
+
+		// the header with fewer addresses than the trusted hops is ignored.
+		r = newTestRequest(testRemoteAddr)
+		r.Header.Set("X-Forwarded-For", "172.16.0.1")
+		ip, err = controller.Admit(r)
+		require.Nil(t, err)
+		assert.Equal(t, testRemoteIP, ip)
+	})
+
+	t.Run("upgrade rate limit", func(t *testing.T) {
+		controller := NewController(WithUpgradeRateLimit(0.001, 2))
+		for i := 0; i < 2; i++ {
+			_, err := controller.Admit(newTestRequest(testRemoteAddr))
+			require.Nil(t, err)
+		}
+
+		_, err := controller.Admit(newTestRequest(testRemoteAddr))
+		requireAdmissionError(t, err, http.StatusTooManyRequests, ErrorMsgUpgradeRateLimit)
+	})
+
+	t.Run("rejected upgrade doesn't consume the rate", func(t *testing.T) {
+		controller := NewController(WithUpgradeRateLimit(0.001, 2), WithMaxConnections(1))
+		ip, err := controller.Admit(newTestRequest(testRemoteAddr))
+		require.Nil(t, err)
+
+		_, err = controller.Admit(newTestRequest(testRemoteAddr))
+		requireAdmissionError(t, err, http.StatusServiceUnavailable, ErrorMsgTooManyConnections)
+
+		// the second token is still available after the rejected upgrade.
+		controller.Release(ip)
+		_, err = controller.Admit(newTestRequest(testRemoteAddr))
+		require.Nil(t, err)
+	})
+
+	t.Run("admission func", func(t *testing.T) {
+		controller := NewController(WithAdmissionFunc(func(r *http.Request) error {
+			switch r.URL.Query().Get("client") {
+			case "banned":
+				return NewError(http.StatusUnauthorized, "banned")
+			case "unknown":
+				return errors.New("unknown client")
+			}
+			return nil
+		}))
+
+		_, err := controller.Admit(httptest.NewRequest(http.MethodGet, "/ws?client=banned", nil))
+		requireAdmissionError(t, err, http.StatusUnauthorized, "banned")
+
+		_, err = controller.Admit(httptest.NewRequest(http.MethodGet, "/ws?client=unknown", nil))
+		requireAdmissionError(t, err, http.StatusForbidden, ErrorMsgRejected)
+
+		_, err = controller.Admit(httptest.NewRequest(http.MethodGet, "/ws?client=known", nil))
+		assert.Nil(t, err)
+	})
+
+	t.Run("parallel admit and release", func(t *testing.T) {
+		controller := NewController(WithMaxConnections(10), WithMaxConnectionsPerIP(10))
+		wg := new(sync.WaitGroup)
+		n := 100
+		wg.Add(n)
+		for i := 0; i < n; i++ {
+			go func() {
+				defer wg.Done()
+				ip, err := controller.Admit(newTestRequest(testRemoteAddr))
+				if err == nil {
+					controller.Release(ip)
+				}
+			}()
+		}
+
+		wg.Wait()
+		assert.Equal(t, 0, controller.total)
+		assert.Empty(t, controller.perIP)
+	})
+}
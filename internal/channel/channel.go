@@ -4,22 +4,119 @@
 
 package channel
 
-import "sync"
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"sync"
+
+	"github.com/hmdsefi/channelize/auth"
+)
 
 const (
 	// ErrorChannel handles all the errors that happens inside the server.
 	ErrorChannel Channel = "error"
+
+	// AuthChannel handles the authentication events of the connection, e.g.
+	// token refresh acknowledgement and token expiration notice.
+	AuthChannel Channel = "auth"
+
+	// AnnouncementChannel handles the messages that are broadcast to all the
+	// connections, regardless of their subscriptions.
+	AnnouncementChannel Channel = "announcement"
+
+	// ReplyChannel handles the replies of the custom inbound messages.
+	ReplyChannel Channel = "reply"
+
+	// BatchChannel handles the frames that contain multiple messages of a
+	// batch publish.
+	BatchChannel Channel = "batch"
 )
 
 // Channel represents a websocket stream channel
 type Channel string
 
+// SnapshotFunc is a function type that returns the current state of a channel.
+// It is called after storing the subscription, and its result is sent to the
+// connection as the first message of the channel. The token is nil if the
+// connection is not authenticated, and params is the raw params object of the
+// subscribe message.
+type SnapshotFunc func(ctx context.Context, token *auth.Token, params json.RawMessage) (interface{}, error)
+
+// PublishFunc is a function type that authorizes the messages that clients
+// publish to a channel. It can validate and transform the data, and returns
+// the message that is sent to the subscribers. The token is nil if the
+// connection is not authenticated, and data is the raw data of the publish
+// message. Any error rejects the message.
+type PublishFunc func(ctx context.Context, token *auth.Token, data json.RawMessage) (interface{}, error)
+
+// Config represents the channel configuration.
+type Config struct {
+	snapshot SnapshotFunc
+
+	// allowClientPublish allows the clients to publish messages to the channel.
+	allowClientPublish bool
+
+	// authorizePublish authorizes the client messages. If it is nil, the
+	// messages are sent as they are.
+	authorizePublish PublishFunc
+
+	// suppressEcho prevents sending the client messages back to the publisher
+	// connection.
+	suppressEcho bool
+}
+
+type Option func(*Config)
+
+// WithClientPublish allows the clients to publish messages to the channel. The
+// input function authorizes, validates, and transforms the messages. If it is
+// nil, the messages of the subscribers are sent as they are.
+func WithClientPublish(authorize PublishFunc) Option {
+	return func(config *Config) {
+		if config == nil {
+			return
+		}
+
+		config.allowClientPublish = true
+		config.authorizePublish = authorize
+	}
+}
+
+// WithEchoSuppression prevents sending the client messages back to the
+// publisher connection.
+func WithEchoSuppression(enabled bool) Option {
+	return func(config *Config) {
+		if config == nil {
+			return
+		}
+
+		config.suppressEcho = enabled
+	}
+}
+
+// WithSnapshot sets the snapshot provider of the channel.
+func WithSnapshot(snapshot SnapshotFunc) Option {
+	return func(config *Config) {
+		if config == nil || snapshot == nil {
+			return
+		}
+
+		config.snapshot = snapshot
+	}
+}
+
 var (
 	mu = sync.RWMutex{}
 
 	supportedChannels        = map[Channel]struct{}{}
 	supportedPublicChannels  = map[Channel]struct{}{}
 	supportedPrivateChannels = map[Channel]struct{}{}
+
+	snapshots = map[Channel]SnapshotFunc{}
+
+	// publishConfigs stores the configuration of the channels that accept
+	// the client messages.
+	publishConfigs = map[Channel]Config{}
 )
 
 func (c Channel) String() string {
@@ -53,6 +150,48 @@ func (c Channel) IsSupportedPrivateChannel() bool {
 	return ok
 }
 
+// Snapshot returns the snapshot provider of the channel. It returns nil if
+// the channel doesn't have a snapshot provider. It is thread-safe.
+func (c Channel) Snapshot() SnapshotFunc {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	return snapshots[c]
+}
+
+// AllowClientPublish returns true if the clients can publish messages to the
+// channel. It is thread-safe.
+func (c Channel) AllowClientPublish() bool {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	return publishConfigs[c].allowClientPublish
+}
+
+// AuthorizePublish authorizes the input client message and returns the message
+// that should be sent to the subscribers. It returns the input data if the
+// channel doesn't have a PublishFunc. It is thread-safe.
+func (c Channel) AuthorizePublish(ctx context.Context, token *auth.Token, data json.RawMessage) (interface{}, error) {
+	mu.RLock()
+	authorize := publishConfigs[c].authorizePublish
+	mu.RUnlock()
+
+	if authorize == nil {
+		return data, nil
+	}
+
+	return authorize(ctx, token, data)
+}
+
+// SuppressEcho returns true if the client messages should not be sent back to
+// the publisher connection. It is thread-safe.
+func (c Channel) SuppressEcho() bool {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	return publishConfigs[c].suppressEcho
+}
+
 // RegisterPublicChannel registers a new public channel. It converts the input string
 // to the Channel type and adds it to the supportedChannels a supportedPublicChannels
 // maps.
@@ -60,13 +199,14 @@ func (c Channel) IsSupportedPrivateChannel() bool {
 // RegisterPublicChannel is thread safe and client can use it in multiple goroutines.
 //
 // Client should call this function in application startup to register the public channels.
-func RegisterPublicChannel(channelStr string) Channel {
+func RegisterPublicChannel(channelStr string, options ...Option) Channel {
 	mu.Lock()
 	defer mu.Unlock()
 
 	channel := Channel(channelStr)
 	supportedChannels[channel] = struct{}{}
 	supportedPublicChannels[channel] = struct{}{}
+	configure(channel, options)
 
 	return channel
 }
@@ -93,13 +233,14 @@ func RegisterPublicChannels(channels ...string) []Channel {
 // RegisterPrivateChannel is thread safe and client can use it in multiple goroutines.
 //
 // Client should call this function in application startup to register the private channels.
-func RegisterPrivateChannel(channelStr string) Channel {
+func RegisterPrivateChannel(channelStr string, options ...Option) Channel {
 	mu.Lock()
 	defer mu.Unlock()
 
 	channel := Channel(channelStr)
 	supportedChannels[channel] = struct{}{}
 	supportedPrivateChannels[channel] = struct{}{}
+	configure(channel, options)
 
 	return channel
 }
@@ -118,3 +259,69 @@ func RegisterPrivateChannels(channels ...string) []Channel {
 
 	return out
 }
+
+// UnregisterChannel removes the input channel from the supported channels. It
+// is thread safe.
+func UnregisterChannel(channel Channel) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	delete(supportedChannels, channel)
+	delete(supportedPublicChannels, channel)
+	delete(supportedPrivateChannels, channel)
+	delete(snapshots, channel)
+	delete(publishConfigs, channel)
+}
+
+// configure applies the input options to the channel. It replaces the
+// previous configuration of the channel. The caller should hold the lock.
+func configure(channel Channel, options []Option) {
+	var config Config
+	for _, option := range options {
+		option(&config)
+	}
+
+	if config.allowClientPublish {
+		publishConfigs[channel] = config
+	} else {
+		delete(publishConfigs, channel)
+	}
+
+	if config.snapshot == nil {
+		delete(snapshots, channel)
+		return
+	}
+
+	snapshots[channel] = config.snapshot
+}
+
+// PublicChannels returns the sorted list of the registered public channels.
+// It is thread safe.
+func PublicChannels() []Channel {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	return sortedChannels(supportedPublicChannels)
+}
+
+// PrivateChannels returns the sorted list of the registered private channels.
+// It is thread safe.
+func PrivateChannels() []Channel {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	return sortedChannels(supportedPrivateChannels)
+}
+
+func sortedChannels(channels map[Channel]struct{}) []Channel {
+	out := make([]Channel, 0, len(channels))
+	for channel := range channels {
+		out = append(out, channel)
+	}
+
+	sort.Slice(out, func(i, j int) bool {
+		return out[i] < out[j]
+	})
+
+	return out
+}
@@ -6,10 +6,15 @@ package channel
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"sync"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/hmdsefi/channelize/auth"
 )
 
 var (
@@ -252,3 +257,87 @@ func TestRegisterPrivateChannels_Concurrent(t *testing.T) {
 	cancel()
 	wg.Wait()
 }
+
+// TestUnregisterChannel registers channels, lists them, and removes one of them.
+func TestUnregisterChannel(t *testing.T) {
+	public := RegisterPublicChannel("unregister-public")
+	private := RegisterPrivateChannel("unregister-private")
+
+	assert.Contains(t, PublicChannels(), public)
+	assert.NotContains(t, PublicChannels(), private)
+	assert.Contains(t, PrivateChannels(), private)
+
+	UnregisterChannel(public)
+	UnregisterChannel(private)
+
+	assert.False(t, public.IsSupportedChannel())
+	assert.False(t, public.IsSupportedPublicChannel())
+	assert.False(t, private.IsSupportedPrivateChannel())
+	assert.NotContains(t, PublicChannels(), public)
+	assert.NotContains(t, PrivateChannels(), private)
+}
+
+// TestWithSnapshot registers channels with snapshot providers, and replaces
+// and removes the providers.
+func TestWithSnapshot(t *testing.T) {
+	snapshot := func(_ context.Context, _ *auth.Token, _ json.RawMessage) (interface{}, error) {
+		return "state", nil
+	}
+
+	public := RegisterPublicChannel("snapshot-public", WithSnapshot(snapshot))
+	private := RegisterPrivateChannel("snapshot-private", WithSnapshot(snapshot))
+	plain := RegisterPublicChannel("snapshot-plain", WithSnapshot(nil))
+
+	require.NotNil(t, public.Snapshot())
+	require.NotNil(t, private.Snapshot())
+	assert.Nil(t, plain.Snapshot())
+
+	state, err := public.Snapshot()(context.Background(), nil, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "state", state)
+
+	// registering the channel again replaces its configuration.
+	RegisterPublicChannel("snapshot-public")
+	assert.Nil(t, public.Snapshot())
+
+	UnregisterChannel(private)
+	assert.Nil(t, private.Snapshot())
+}
+
+// TestWithClientPublish registers channels that accept the client messages
+// and authorizes the messages.
+func TestWithClientPublish(t *testing.T) {
+	ctx := context.Background()
+	authorize := func(_ context.Context, token *auth.Token, data json.RawMessage) (interface{}, error) {
+		if token == nil {
+			return nil, errors.New("token is missing")
+		}
+
+		return map[string]interface{}{"user_id": token.UserID, "text": string(data)}, nil
+	}
+
+	room := RegisterPrivateChannel("publish-room", WithClientPublish(authorize), WithEchoSuppression(true))
+	cursors := RegisterPublicChannel("publish-cursors", WithClientPublish(nil))
+	plain := RegisterPublicChannel("publish-plain", WithEchoSuppression(true))
+
+	assert.True(t, room.AllowClientPublish())
+	assert.True(t, room.SuppressEcho())
+	assert.True(t, cursors.AllowClientPublish())
+	assert.False(t, cursors.SuppressEcho())
+	assert.False(t, plain.AllowClientPublish())
+	assert.False(t, plain.SuppressEcho())
+
+	_, err := room.AuthorizePublish(ctx, nil, json.RawMessage(`"hi"`))
+	assert.EqualError(t, err, "token is missing")
+
+	msg, err := room.AuthorizePublish(ctx, &auth.Token{UserID: "user-1"}, json.RawMessage(`"hi"`))
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]interface{}{"user_id": "user-1", "text": `"hi"`}, msg)
+
+	msg, err = cursors.AuthorizePublish(ctx, nil, json.RawMessage(`{"x":1}`))
+	assert.Nil(t, err)
+	assert.Equal(t, json.RawMessage(`{"x":1}`), msg)
+
+	UnregisterChannel(room)
+	assert.False(t, room.AllowClientPublish())
+}
@@ -5,6 +5,24 @@
 package common
 
 const (
-	LogFieldID    = "id"
-	LogFieldError = "error"
+	LogFieldID         = "id"
+	LogFieldError      = "error"
+	LogFieldUserID     = "user_id"
+	LogFieldRemoteAddr = "remote_addr"
+	LogFieldChannel    = "channel"
+)
+
+// TracerName is the instrumentation name of the Channelize tracer.
+const TracerName = "github.com/hmdsefi/channelize"
+
+// span attribute keys.
+const (
+	TraceAttrChannel      = "channelize.channel"
+	TraceAttrConnectionID = "channelize.connection_id"
+	TraceAttrTag          = "channelize.tag"
+	TraceAttrMessageSize  = "channelize.message_size"
+	TraceAttrFanoutSize   = "channelize.fanout_size"
+	TraceAttrDelivered    = "channelize.delivered"
+	TraceAttrDropped      = "channelize.dropped"
+	TraceAttrBatchSize    = "channelize.batch_size"
 )
@@ -9,22 +9,42 @@ import "fmt"
 const (
 	CodeConnectionClosed     = 1000
 	CodeOutboundBufferIsFull = 1001
+	CodeConnectionNotFound   = 1002
+	CodeRejectedByHook       = 1003
 
 	CodeFailedToUnmarshalMessage = 1500
 	CodeFailedToMarshalMessage   = 1501
+	CodeInvalidMessage           = 1502
+	CodeAlreadyReplied           = 1503
 
 	CodeAuthFuncIsMissing  = 2000
 	CodeAuthTokenIsMissing = 2001
 	CodeAuthTokenIsExpired = 2002
+	CodeAccessDenied       = 2003
+	CodeAuthUserMismatch   = 2004
+
+	CodeRateLimitExceeded    = 3000
+	CodeTooManySubscriptions = 3001
+	CodeTooManyChannels      = 3002
+	CodeFanoutQueueFull      = 3003
+
+	CodePresenceIsDisabled = 4000
+	CodeSnapshotFailed     = 4001
+	CodeNotSubscribed      = 4002
+	CodePublishRejected    = 4003
+	CodeUnsupportedChannel = 4004
 )
 
 const (
 	ErrorMsgConnectionClosed             = "websocket connection is closed"
 	ErrorMsgOutboundBufferIsFull         = "connection outbound buffer is full"
+	ErrorMsgConnectionNotFound           = "connection not found"
+	ErrorMsgRejectedByHook               = "action is rejected"
 	ErrorMsgUnmarshalInboundMessage      = "failed to unmarshal inbound message"
 	ErrorMsgMarshalOutboundMessage       = "failed to marshal outbound message"
 	ErrorMsgUnsupportedMessageType       = "message type is not supported"
 	ErrorMsgChannelsIsEmpty              = "channels list is empty, minimum size is 1"
+	ErrorMsgTokenIsEmpty                 = "token is empty" // nolint
 	ErrorMsgUnsupportedChannel           = "channel is not supported"
 	ErrorMsgInvalidChannelType           = "channel should be either private or public"
 	ErrorMsgAuthTokenIsMissing           = "auth token is missing for the private channel" // nolint
@@ -33,17 +53,46 @@ const (
 	ErrorMsgAuthFuncIsMissing            = "authentication function to validate private auth token"
 	ErrorMsgConnectionAuthTokenIsMissing = "connection auth token is nil"
 	ErrorMsgAuthTokenIsExpired           = "auth token is expired" // nolint
+	ErrorMsgAccessDenied                 = "access to the channel is denied"
+	ErrorMsgAuthUserMismatch             = "token belongs to another user" // nolint
+	ErrorMsgInvalidMessage               = "inbound message is invalid"
+	ErrorMsgAlreadyReplied               = "inbound message is already replied"
+	ErrorMsgRateLimitExceeded            = "inbound message rate limit exceeded"
+	ErrorMsgTooManySubscriptions         = "maximum number of subscriptions per connection exceeded"
+	ErrorMsgTooManyChannels              = "maximum number of channels per request exceeded"
+	ErrorMsgFanoutQueueFull              = "fan-out queue is full"
+	ErrorMsgPresenceIsDisabled           = "presence is not enabled for the channel"
+	ErrorMsgSnapshotFailed               = "failed to get the channel snapshot"
+	ErrorMsgChannelIsEmpty               = "channel is empty"
+	ErrorMsgClientPublishNotAllowed      = "client publish is not allowed for the channel"
+	ErrorMsgNotSubscribed                = "connection is not subscribed to the channel"
+	ErrorMsgPublishRejected              = "message is rejected"
 )
 
 var (
 	code2ErrMsg = map[int]string{
 		CodeConnectionClosed:         ErrorMsgConnectionClosed,
 		CodeOutboundBufferIsFull:     ErrorMsgOutboundBufferIsFull,
+		CodeConnectionNotFound:       ErrorMsgConnectionNotFound,
+		CodeRejectedByHook:           ErrorMsgRejectedByHook,
 		CodeFailedToUnmarshalMessage: ErrorMsgUnmarshalInboundMessage,
 		CodeFailedToMarshalMessage:   ErrorMsgMarshalOutboundMessage,
+		CodeInvalidMessage:           ErrorMsgInvalidMessage,
+		CodeAlreadyReplied:           ErrorMsgAlreadyReplied,
 		CodeAuthFuncIsMissing:        ErrorMsgAuthFuncIsMissing,
 		CodeAuthTokenIsMissing:       ErrorMsgConnectionAuthTokenIsMissing,
 		CodeAuthTokenIsExpired:       ErrorMsgAuthTokenIsExpired,
+		CodeAccessDenied:             ErrorMsgAccessDenied,
+		CodeAuthUserMismatch:         ErrorMsgAuthUserMismatch,
+		CodeRateLimitExceeded:        ErrorMsgRateLimitExceeded,
+		CodeTooManySubscriptions:     ErrorMsgTooManySubscriptions,
+		CodeTooManyChannels:          ErrorMsgTooManyChannels,
+		CodeFanoutQueueFull:          ErrorMsgFanoutQueueFull,
+		CodePresenceIsDisabled:       ErrorMsgPresenceIsDisabled,
+		CodeSnapshotFailed:           ErrorMsgSnapshotFailed,
+		CodeNotSubscribed:            ErrorMsgNotSubscribed,
+		CodePublishRejected:          ErrorMsgPublishRejected,
+		CodeUnsupportedChannel:       ErrorMsgUnsupportedChannel,
 	}
 )
 
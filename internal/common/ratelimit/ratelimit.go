@@ -0,0 +1,76 @@
+/**
+ * Copyright © 2022 Hamed Yousefi <hdyousefi@gmail.com>.
+ */
+
+package ratelimit
+
+import (
+	"sync"
+	"time"
+
+	"github.com/hmdsefi/channelize/internal/common/utils"
+)
+
+// TokenBucket is a thread-safe token bucket rate limiter. The bucket refills
+// with a constant rate of tokens per second and can hold at most burst tokens.
+//
+// Each call to the Allow method consumes one token. If the bucket is empty
+// the call is not allowed.
+type TokenBucket struct {
+	mu sync.Mutex
+
+	// rate represents the number of tokens that are added to the bucket per second.
+	rate float64
+
+	// burst represents the capacity of the bucket.
+	burst float64
+
+	// tokens represents the number of available tokens.
+	tokens float64
+
+	// last represents the last time that tokens has been refilled.
+	last time.Time
+
+	now func() time.Time
+}
+
+// NewTokenBucket creates a new instance of TokenBucket that is full. The rate
+// is number of allowed events per second and burst is the maximum number of
+// events that can happen at once. The burst values less than one are treated
+// as one, otherwise the bucket would reject all the events.
+func NewTokenBucket(rate float64, burst int) *TokenBucket {
+	if burst < 1 {
+		burst = 1
+	}
+
+	return &TokenBucket{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   utils.Now(),
+		now:    utils.Now,
+	}
+}
+
+// Allow reports whether an event may happen now. It consumes a token if the
+// event is allowed.
+func (b *TokenBucket) Allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.now()
+	if elapsed := now.Sub(b.last); elapsed > 0 {
+		b.tokens += elapsed.Seconds() * b.rate
+		if b.tokens > b.burst {
+			b.tokens = b.burst
+		}
+	}
+	b.last = now
+
+	if b.tokens < 1 {
+		return false
+	}
+
+	b.tokens--
+	return true
+}
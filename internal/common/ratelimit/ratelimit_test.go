@@ -0,0 +1,80 @@
+/**
+ * Copyright © 2022 Hamed Yousefi <hdyousefi@gmail.com>.
+ */
+
+package ratelimit
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/hmdsefi/channelize/internal/common/utils"
+)
+
+func TestTokenBucket_Allow(t *testing.T) {
+	t.Run("consume burst", func(t *testing.T) {
+		now := utils.Now()
+		bucket := NewTokenBucket(1, 3)
+		bucket.now = func() time.Time { return now }
+
+		for i := 0; i < 3; i++ {
+			assert.True(t, bucket.Allow())
+		}
+		assert.False(t, bucket.Allow())
+	})
+
+	t.Run("zero burst", func(t *testing.T) {
+		now := utils.Now()
+		bucket := NewTokenBucket(1, 0)
+		bucket.now = func() time.Time { return now }
+
+		assert.True(t, bucket.Allow())
+		assert.False(t, bucket.Allow())
+	})
+
+	t.Run("refill tokens", func(t *testing.T) {
+		now := utils.Now()
+		bucket := NewTokenBucket(2, 2)
+		bucket.now = func() time.Time { return now }
+
+		assert.True(t, bucket.Allow())
+		assert.True(t, bucket.Allow())
+		assert.False(t, bucket.Allow())
+
+		now = now.Add(500 * time.Millisecond)
+		assert.True(t, bucket.Allow())
+		assert.False(t, bucket.Allow())
+
+		// refill should not exceed the burst size.
+		now = now.Add(time.Hour)
+		assert.True(t, bucket.Allow())
+		assert.True(t, bucket.Allow())
+		assert.False(t, bucket.Allow())
+	})
+
+	t.Run("parallel allow", func(t *testing.T) {
+		now := utils.Now()
+		bucket := NewTokenBucket(1, 10)
+		bucket.now = func() time.Time { return now }
+
+		var allowed int32
+		wg := new(sync.WaitGroup)
+		n := 100
+		wg.Add(n)
+		for i := 0; i < n; i++ {
+			go func() {
+				defer wg.Done()
+				if bucket.Allow() {
+					atomic.AddInt32(&allowed, 1)
+				}
+			}()
+		}
+
+		wg.Wait()
+		assert.Equal(t, int32(10), allowed)
+	})
+}
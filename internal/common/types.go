@@ -4,10 +4,39 @@
 
 package common
 
+import (
+	"context"
+	"time"
+
+	"github.com/hmdsefi/channelize/auth"
+	"github.com/hmdsefi/channelize/internal/channel"
+)
+
 // ConnectionWrapper is an interface that wraps websocket.Conn object.
 type ConnectionWrapper interface {
 	ID() string
 	UserID() *string
-	Authenticate() error
+	Token() *auth.Token
+	Authenticate(ctx context.Context) error
 	SendMessage([]byte) error
+	SendMessageContext(ctx context.Context, message []byte) error
+	RevokeToken()
+	CloseWithReason(code int, reason string) error
+	Info() ConnectionInfo
+	HasTag(tag string) bool
+	AddTags(tags ...string)
+	RemoveTags(tags ...string)
+}
+
+// ConnectionInfo represents the connection metadata.
+type ConnectionInfo struct {
+	ID          string            `json:"id"`
+	UserID      string            `json:"user_id,omitempty"`
+	RemoteAddr  string            `json:"remote_addr"`
+	ConnectedAt time.Time         `json:"connected_at"`
+	BytesSent   uint64            `json:"bytes_sent"`
+	BufferLen   int               `json:"buffer_len"`
+	BufferCap   int               `json:"buffer_cap"`
+	Tags        []string          `json:"tags,omitempty"`
+	Channels    []channel.Channel `json:"channels"`
 }
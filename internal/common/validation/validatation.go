@@ -11,6 +11,7 @@ const (
 const (
 	FieldType     = "type"
 	FieldChannels = "channels"
+	FieldChannel  = "channel"
 	FieldToken    = "token"
 )
 
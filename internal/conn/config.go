@@ -8,6 +8,10 @@ import (
 	"fmt"
 	"time"
 
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/hmdsefi/channelize/auth"
+	"github.com/hmdsefi/channelize/internal/common"
 	"github.com/hmdsefi/channelize/internal/common/utils"
 )
 
@@ -24,6 +28,10 @@ const (
 
 type PingMessageFunc func() []byte
 
+// TagsFunc is a function type that returns the tags of a connection from its
+// auth token, e.g. from the token claims.
+type TagsFunc func(token *auth.Token) []string
+
 // Config represents the configuration that is needed to create a new Connection.
 type Config struct {
 	// outboundBufferSize represents the buffer size of the outbound channel.
@@ -38,7 +46,44 @@ type Config struct {
 	// pingMessageFunc is a function that create ping messages.
 	pingMessageFunc PingMessageFunc
 
+	// readLimit represents the maximum size in bytes for an inbound message.
+	// Zero means there is no limit.
+	readLimit int64
+
+	// inboundRate represents the number of inbound messages per second that
+	// are allowed. Zero means there is no limit.
+	inboundRate float64
+
+	// inboundBurst represents the maximum number of inbound messages that can
+	// be received at once.
+	inboundBurst int
+
+	// maxRateLimitViolations represents the number of consecutive rate limited
+	// messages before closing the connection with the policy violation code.
+	// Zero means the connection won't be closed.
+	maxRateLimitViolations int
+
+	// token represents the auth token details of an already authenticated
+	// client, e.g. authenticated during the websocket handshake.
+	token *auth.Token
+
+	// tokenExpiryNotice represents the duration before the token expiration
+	// that the client is notified to refresh the token. Zero means the notice
+	// is disabled.
+	tokenExpiryNotice time.Duration
+
+	// tagsFunc returns the tags that are added to the connection when its
+	// token is stored. It is nil if the tags are not set from the tokens.
+	tagsFunc TagsFunc
+
+	// bufferOccupancy enables observing the outbound buffer occupancy on each
+	// outbound message.
+	bufferOccupancy bool
+
 	collector collector
+
+	// tracer records the write spans of the traced outbound messages.
+	tracer trace.Tracer
 }
 
 func newDefaultConfig() *Config {
@@ -48,6 +93,7 @@ func newDefaultConfig() *Config {
 		pingPeriod:         defaultPingPeriod,
 		pingMessageFunc:    defaultPingMessageFunc,
 		collector:          newNoopCollector(),
+		tracer:             trace.NewNoopTracerProvider().Tracer(common.TracerName),
 	}
 }
 
@@ -93,6 +139,107 @@ func WithPingMessageFunc(messageFunc PingMessageFunc) Option {
 	}
 }
 
+// WithReadLimit sets the maximum size in bytes for an inbound message. If a
+// message exceeds the limit, the connection will be closed with the message
+// too big close code.
+func WithReadLimit(limit int64) Option {
+	return func(config *Config) {
+		if config == nil {
+			return
+		}
+
+		config.readLimit = limit
+	}
+}
+
+// WithInboundRateLimit sets a token bucket rate limiter for the inbound
+// messages. The rate is the number of messages per second, and burst is the
+// maximum number of messages that can be received at once.
+func WithInboundRateLimit(rate float64, burst int) Option {
+	return func(config *Config) {
+		if config == nil {
+			return
+		}
+
+		config.inboundRate = rate
+		config.inboundBurst = burst
+	}
+}
+
+// WithMaxRateLimitViolations sets the number of consecutive rate limited
+// messages that closes the connection with the policy violation code.
+func WithMaxRateLimitViolations(n int) Option {
+	return func(config *Config) {
+		if config == nil {
+			return
+		}
+
+		config.maxRateLimitViolations = n
+	}
+}
+
+// WithToken sets the auth token details of a client that has been already
+// authenticated. The connection starts bound to the token userID.
+func WithToken(token *auth.Token) Option {
+	return func(config *Config) {
+		if config == nil {
+			return
+		}
+
+		config.token = token
+	}
+}
+
+// WithTokenExpiryNotice sets the duration before the token expiration that
+// the client is notified to refresh the token.
+func WithTokenExpiryNotice(duration time.Duration) Option {
+	return func(config *Config) {
+		if config == nil {
+			return
+		}
+
+		config.tokenExpiryNotice = duration
+	}
+}
+
+// WithTagsFunc sets the function that returns the connection tags from the
+// auth token. The tags are added to the connection each time that a token
+// is stored, e.g. after the authentication and the token refresh. They replace
+// the tags of the previous token, and are removed when the token is revoked.
+func WithTagsFunc(tagsFunc TagsFunc) Option {
+	return func(config *Config) {
+		if config == nil {
+			return
+		}
+
+		config.tagsFunc = tagsFunc
+	}
+}
+
+// WithBufferOccupancy enables observing the outbound buffer occupancy ratio
+// on each outbound message.
+func WithBufferOccupancy(enabled bool) Option {
+	return func(config *Config) {
+		if config == nil {
+			return
+		}
+
+		config.bufferOccupancy = enabled
+	}
+}
+
+// WithTracer sets the tracer that records writing the traced outbound
+// messages to the peer.
+func WithTracer(tracer trace.Tracer) Option {
+	return func(config *Config) {
+		if config == nil || tracer == nil {
+			return
+		}
+
+		config.tracer = tracer
+	}
+}
+
 func WithCollector(in collector) Option {
 	return func(config *Config) {
 		if config == nil {
@@ -119,3 +266,15 @@ func (n *noopCollector) OpenConnectionsInc() {
 
 func (n *noopCollector) OpenConnectionsDec() {
 }
+
+func (n *noopCollector) BufferFullInc() {
+}
+
+func (n *noopCollector) QueueLatencyObserve(time.Duration) {
+}
+
+func (n *noopCollector) WriteDurationObserve(time.Duration) {
+}
+
+func (n *noopCollector) BufferOccupancyObserve(float64) {
+}
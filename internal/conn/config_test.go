@@ -1,11 +1,16 @@
 package conn
 
 import (
+	"sync"
 	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+
+	"github.com/hmdsefi/channelize/auth"
 )
 
 func TestWithOutboundBufferSize(t *testing.T) {
@@ -55,6 +60,77 @@ func TestWithPingMessageFunc(t *testing.T) {
 	assert.Equal(t, string(expectedPingMessage), string(cfg.pingMessageFunc()))
 }
 
+func TestWithReadLimit(t *testing.T) {
+	expectedReadLimit := int64(512)
+	option := WithReadLimit(expectedReadLimit)
+	option(nil)
+
+	cfg := newDefaultConfig()
+	option(cfg)
+
+	assert.Equal(t, expectedReadLimit, cfg.readLimit)
+}
+
+func TestWithInboundRateLimit(t *testing.T) {
+	expectedRate := 10.0
+	expectedBurst := 20
+	option := WithInboundRateLimit(expectedRate, expectedBurst)
+	option(nil)
+
+	cfg := newDefaultConfig()
+	option(cfg)
+
+	assert.Equal(t, expectedRate, cfg.inboundRate)
+	assert.Equal(t, expectedBurst, cfg.inboundBurst)
+}
+
+func TestWithMaxRateLimitViolations(t *testing.T) {
+	expectedViolations := 5
+	option := WithMaxRateLimitViolations(expectedViolations)
+	option(nil)
+
+	cfg := newDefaultConfig()
+	option(cfg)
+
+	assert.Equal(t, expectedViolations, cfg.maxRateLimitViolations)
+}
+
+func TestWithToken(t *testing.T) {
+	expectedToken := &auth.Token{UserID: "test-user-id"}
+	option := WithToken(expectedToken)
+	option(nil)
+
+	cfg := newDefaultConfig()
+	option(cfg)
+
+	assert.Equal(t, expectedToken, cfg.token)
+}
+
+func TestWithTokenExpiryNotice(t *testing.T) {
+	expectedNotice := time.Minute
+	option := WithTokenExpiryNotice(expectedNotice)
+	option(nil)
+
+	cfg := newDefaultConfig()
+	option(cfg)
+
+	assert.Equal(t, expectedNotice, cfg.tokenExpiryNotice)
+}
+
+func TestWithTagsFunc(t *testing.T) {
+	option := WithTagsFunc(func(token *auth.Token) []string {
+		return []string{"org:" + token.UserID}
+	})
+	option(nil)
+
+	cfg := newDefaultConfig()
+	assert.Nil(t, cfg.tagsFunc)
+	option(cfg)
+
+	require.NotNil(t, cfg.tagsFunc)
+	assert.Equal(t, []string{"org:acme"}, cfg.tagsFunc(&auth.Token{UserID: "acme"}))
+}
+
 func TestWithCollector(t *testing.T) {
 	c := newMockCollector()
 	option := WithCollector(c)
@@ -70,8 +146,37 @@ func TestWithCollector(t *testing.T) {
 	assert.Equal(t, int32(0), c.openConnections)
 }
 
+func TestWithTracer(t *testing.T) {
+	tracer := sdktrace.NewTracerProvider().Tracer("test")
+	option := WithTracer(tracer)
+	option(nil)
+
+	cfg := newDefaultConfig()
+	assert.NotNil(t, cfg.tracer)
+	option(cfg)
+
+	assert.Equal(t, tracer, cfg.tracer)
+}
+
+func TestWithBufferOccupancy(t *testing.T) {
+	option := WithBufferOccupancy(true)
+	option(nil)
+
+	cfg := newDefaultConfig()
+	assert.False(t, cfg.bufferOccupancy)
+	option(cfg)
+
+	assert.True(t, cfg.bufferOccupancy)
+}
+
 type mockCollector struct {
 	openConnections int32
+	bufferFull      int32
+	queueLatencies  int32
+	writeDurations  int32
+
+	mu          sync.Mutex
+	occupancies []float64
 }
 
 func newMockCollector() *mockCollector {
@@ -85,3 +190,29 @@ func (n *mockCollector) OpenConnectionsInc() {
 func (n *mockCollector) OpenConnectionsDec() {
 	atomic.AddInt32(&n.openConnections, -1)
 }
+
+func (n *mockCollector) BufferFullInc() {
+	atomic.AddInt32(&n.bufferFull, 1)
+}
+
+func (n *mockCollector) QueueLatencyObserve(time.Duration) {
+	atomic.AddInt32(&n.queueLatencies, 1)
+}
+
+func (n *mockCollector) WriteDurationObserve(time.Duration) {
+	atomic.AddInt32(&n.writeDurations, 1)
+}
+
+func (n *mockCollector) BufferOccupancyObserve(ratio float64) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	n.occupancies = append(n.occupancies, ratio)
+}
+
+func (n *mockCollector) Occupancies() []float64 {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	return append([]float64(nil), n.occupancies...)
+}
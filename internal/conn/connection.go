@@ -7,24 +7,56 @@ package conn
 import (
 	"context"
 	"errors"
+	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gorilla/websocket"
 	uuid "github.com/satori/go.uuid"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 
 	"github.com/hmdsefi/channelize/auth"
 	"github.com/hmdsefi/channelize/internal/common"
 	"github.com/hmdsefi/channelize/internal/common/errorx"
+	"github.com/hmdsefi/channelize/internal/common/ratelimit"
 	"github.com/hmdsefi/channelize/internal/common/utils"
 	"github.com/hmdsefi/channelize/log"
 )
 
+const (
+	// closeMessageWait is the time allowed to write the close message to the peer.
+	closeMessageWait = time.Second
+
+	// spanNameWrite is the name of the span that writes a traced outbound
+	// message to the peer.
+	spanNameWrite = "channelize.write"
+)
+
 // helper connects connection to the storage.
 type helper interface {
+	// Register adds the connection to the storage before starting the read and
+	// write goroutines, so the connection can be found by its ID or userID
+	// even if it has no subscriptions. It returns error if the connection is
+	// rejected.
+	Register(ctx context.Context, conn *Connection) error
+
+	// ApproveToken is called after validating a token and before storing it
+	// in the connection. It returns error if the token is rejected.
+	ApproveToken(ctx context.Context, conn *Connection, token *auth.Token) error
+
 	ParseMessage(ctx context.Context, conn *Connection, message []byte)
 	Remove(ctx context.Context, connID string, userID *string)
+
+	// SendError sends the input error to the error channel of the connection.
+	SendError(conn *Connection, err error)
+
+	// NotifyTokenExpiring notifies the client that the connection token is
+	// about to expire.
+	NotifyTokenExpiring(conn *Connection)
 }
 
 // collector is an interface for collecting the connection metrics.
@@ -34,21 +66,61 @@ type collector interface {
 
 	// OpenConnectionsDec decreases the total number of open connections.
 	OpenConnectionsDec()
+
+	// BufferFullInc increases the total number of outbound messages that have
+	// been rejected because of the full outbound buffer.
+	BufferFullInc()
+
+	// QueueLatencyObserve observes the time that an outbound message waited
+	// in the outbound buffer before it has been written to the peer.
+	QueueLatencyObserve(d time.Duration)
+
+	// WriteDurationObserve observes the time of writing an outbound message
+	// to the websocket connection.
+	WriteDurationObserve(d time.Duration)
+
+	// BufferOccupancyObserve observes the ratio of the used outbound buffer
+	// capacity when a message is enqueued.
+	BufferOccupancyObserve(ratio float64)
+}
+
+// outboundMessage represents a message in the outbound buffer.
+type outboundMessage struct {
+	data []byte
+
+	// enqueuedAt represents the time that the message has been sent to the
+	// outbound buffer.
+	enqueuedAt time.Time
+
+	// spanContext represents the span of the publisher. It is invalid if the
+	// message is not traced.
+	spanContext trace.SpanContext
 }
 
 // Connection wraps the websocket connection and add more functionalities to it.
 // Each client that connected to the websocket server has a Connection.
 type Connection struct {
+	// bytesSent represents the number of bytes that have been written to the
+	// peer. It is the first field to keep the 64-bit alignment for the atomic
+	// operations on 32-bit platforms.
+	bytesSent uint64
+
 	// id represents connectionID
 	id string
 
+	// remoteAddr represents the network address of the peer.
+	remoteAddr string
+
+	// connectedAt represents the connection creation time.
+	connectedAt time.Time
+
 	// conn represents websocket connection. It is the handshake
 	// between the client and the server. Server uses conn to send
 	// and receive messages from the client.
 	conn *websocket.Conn
 
 	// send is a buffered channel for the outbound messages.
-	send chan []byte
+	send chan outboundMessage
 
 	// cancel can close the websocket connection and stop listening
 	// and sending messages.
@@ -65,20 +137,58 @@ type Connection struct {
 	// is open. Otherwise, it is false.
 	connected bool
 
+	// registered is true if the connection has been added to the storage. It
+	// is set before starting the read and write goroutines.
+	registered bool
+
 	// config represents connection configuration.
 	config Config
 
 	// token represents the client auth token details.
 	token *auth.Token
 
+	// tokenMu protects the token and expiryTimer, since the token can be
+	// refreshed by the client while other goroutines are authenticating it.
+	tokenMu sync.RWMutex
+
+	// expiryTimer notifies the client before the token expiration. It is nil
+	// if there is no token or the notice is disabled.
+	expiryTimer *time.Timer
+
+	// tags groups the connections, e.g. by the organization of the user. The
+	// messages can be sent to all the connections with a tag. They are set by
+	// the server and kept until the server removes them.
+	tags map[string]struct{}
+
+	// tokenTags are the tags that have been added by the TagsFunc for the
+	// current token. They are kept separately from the server tags, so they
+	// can be replaced or revoked with the token without removing a server tag.
+	tokenTags map[string]struct{}
+
+	// tagsMu protects the tags and tokenTags, since the server can tag the connection while
+	// the messages are dispatched.
+	tagsMu sync.RWMutex
+
 	// helper is a middleware to connect connection to the storage to parse
 	// the inbound messages and subscribe, unsubscribe, and remove the connection
 	// from the storage.
 	helper helper
 
-	authFunc auth.AuthenticateFunc
+	// authenticator validates the client auth tokens.
+	authenticator auth.Authenticator
+
+	// limiter limits the rate of the inbound messages. It is nil if the
+	// rate limit is not configured.
+	limiter *ratelimit.TokenBucket
+
+	// violations represents the number of consecutive inbound messages that
+	// have been dropped by the limiter. Only the read goroutine uses it.
+	violations int
 
-	ctx    context.Context
+	ctx context.Context
+
+	// logger is a child logger that adds the connection ID and the remote
+	// address to all the messages.
 	logger log.Logger
 }
 
@@ -97,7 +207,7 @@ func NewConnection(
 	ctx context.Context,
 	conn *websocket.Conn,
 	helper helper,
-	authFunc auth.AuthenticateFunc,
+	authenticator auth.Authenticator,
 	logger log.Logger,
 	options ...Option,
 ) *Connection {
@@ -111,21 +221,41 @@ func NewConnection(
 	// wrap the application context with cancellation
 	ctx, cancel := context.WithCancel(ctx)
 
+	id := uuid.NewV4().String()
+	remoteAddr := conn.RemoteAddr().String()
+
 	connWrapper := &Connection{
-		id:        uuid.NewV4().String(),
-		conn:      conn,
-		connected: true,
-		cancel:    cancel,
-		send:      make(chan []byte, config.outboundBufferSize),
-		config:    *config,
-		helper:    helper,
-		authFunc:  authFunc,
-		ctx:       ctx,
-		logger:    logger,
+		id:            id,
+		remoteAddr:    remoteAddr,
+		connectedAt:   utils.Now(),
+		conn:          conn,
+		connected:     true,
+		cancel:        cancel,
+		send:          make(chan outboundMessage, config.outboundBufferSize),
+		config:        *config,
+		helper:        helper,
+		authenticator: authenticator,
+		ctx:           ctx,
+		logger:        log.With(logger, common.LogFieldID, id, common.LogFieldRemoteAddr, remoteAddr),
+	}
+
+	if config.inboundRate > 0 {
+		connWrapper.limiter = ratelimit.NewTokenBucket(config.inboundRate, config.inboundBurst)
+	}
+
+	if config.token != nil {
+		connWrapper.storeToken(config.token)
 	}
 
 	connWrapper.config.collector.OpenConnectionsInc()
 
+	if err := helper.Register(ctx, connWrapper); err != nil {
+		connWrapper.reject(err)
+		return connWrapper
+	}
+
+	connWrapper.registered = true
+
 	go connWrapper.read(ctx)
 	go connWrapper.write(ctx)
 
@@ -137,77 +267,336 @@ func (c *Connection) ID() string {
 	return c.id
 }
 
+// Info returns the connection metadata. The channels are not filled, since
+// the connection doesn't store its subscriptions.
+func (c *Connection) Info() common.ConnectionInfo {
+	info := common.ConnectionInfo{
+		ID:          c.id,
+		RemoteAddr:  c.remoteAddr,
+		ConnectedAt: c.connectedAt,
+		BytesSent:   atomic.LoadUint64(&c.bytesSent),
+		BufferLen:   len(c.send),
+		BufferCap:   cap(c.send),
+		Tags:        c.Tags(),
+	}
+
+	if userID := c.UserID(); userID != nil {
+		info.UserID = *userID
+	}
+
+	return info
+}
+
+// Tags returns the sorted list of the connection tags, including the tags
+// of the server and the token.
+func (c *Connection) Tags() []string {
+	c.tagsMu.RLock()
+	defer c.tagsMu.RUnlock()
+
+	if len(c.tags) == 0 && len(c.tokenTags) == 0 {
+		return nil
+	}
+
+	tags := make([]string, 0, len(c.tags)+len(c.tokenTags))
+	for tag := range c.tags {
+		tags = append(tags, tag)
+	}
+
+	for tag := range c.tokenTags {
+		if _, ok := c.tags[tag]; !ok {
+			tags = append(tags, tag)
+		}
+	}
+	sort.Strings(tags)
+
+	return tags
+}
+
+// HasTag returns true if the connection has the input tag, either from the
+// server or from the token.
+func (c *Connection) HasTag(tag string) bool {
+	c.tagsMu.RLock()
+	defer c.tagsMu.RUnlock()
+
+	if _, ok := c.tags[tag]; ok {
+		return true
+	}
+
+	_, ok := c.tokenTags[tag]
+	return ok
+}
+
+// AddTags adds the input tags to the connection. The empty tags are ignored.
+func (c *Connection) AddTags(tags ...string) {
+	c.tagsMu.Lock()
+	defer c.tagsMu.Unlock()
+
+	for _, tag := range tags {
+		if tag == "" {
+			continue
+		}
+
+		if c.tags == nil {
+			c.tags = make(map[string]struct{})
+		}
+
+		c.tags[tag] = struct{}{}
+	}
+}
+
+// setTokenTags replaces the tags of the previous token with the input tags.
+// The server tags are not changed, even if the previous token had the same
+// tags.
+func (c *Connection) setTokenTags(tags ...string) {
+	c.tagsMu.Lock()
+	defer c.tagsMu.Unlock()
+
+	c.tokenTags = nil
+	for _, tag := range tags {
+		if tag == "" {
+			continue
+		}
+
+		if c.tokenTags == nil {
+			c.tokenTags = make(map[string]struct{})
+		}
+
+		c.tokenTags[tag] = struct{}{}
+	}
+}
+
+// RemoveTags removes the input tags from the connection. The tags of the
+// current token are removed too, but they are added again when the token is
+// refreshed.
+func (c *Connection) RemoveTags(tags ...string) {
+	c.tagsMu.Lock()
+	defer c.tagsMu.Unlock()
+
+	for _, tag := range tags {
+		delete(c.tags, tag)
+		delete(c.tokenTags, tag)
+	}
+}
+
+// Logger returns the connection-scoped logger. It adds the connection ID, the
+// remote address, and the user ID of the authenticated connections to all the
+// messages.
+func (c *Connection) Logger() log.Logger {
+	if userID := c.UserID(); userID != nil {
+		return log.With(c.logger, common.LogFieldUserID, *userID)
+	}
+
+	return c.logger
+}
+
+// Done returns a channel that is closed when the connection is closed.
+func (c *Connection) Done() <-chan struct{} {
+	return c.ctx.Done()
+}
+
 // UserID return the token userID if token is not nil and userID is not empty.
 func (c *Connection) UserID() *string {
-	if c.token != nil && strings.TrimSpace(c.token.UserID) != "" {
-		userID := c.token.UserID
+	token := c.Token()
+	if token != nil && strings.TrimSpace(token.UserID) != "" {
+		userID := token.UserID
 		return &userID
 	}
 
 	return nil
 }
 
-// AuthenticateAndStore validates the input token by calling the auth function
+// Token returns the auth token details of the connection. It returns nil if
+// the connection is not authenticated.
+func (c *Connection) Token() *auth.Token {
+	c.tokenMu.RLock()
+	defer c.tokenMu.RUnlock()
+
+	return c.token
+}
+
+// storeToken replaces the connection token and schedules the token expiration
+// notice if it is enabled. It replaces the tags of the previous token with the
+// tags of the input token if the TagsFunc is set.
+func (c *Connection) storeToken(token *auth.Token) {
+	if c.config.tagsFunc != nil {
+		c.setTokenTags(c.config.tagsFunc(token)...)
+	}
+
+	c.tokenMu.Lock()
+	defer c.tokenMu.Unlock()
+
+	c.token = token
+
+	if c.expiryTimer != nil {
+		c.expiryTimer.Stop()
+		c.expiryTimer = nil
+	}
+
+	if c.config.tokenExpiryNotice <= 0 || c.helper == nil {
+		return
+	}
+
+	// notify the client immediately if the token is already in the notice window.
+	noticeAt := time.Unix(token.ExpiresAt, 0).Add(-c.config.tokenExpiryNotice)
+	wait := noticeAt.Sub(utils.Now())
+	if wait < 0 {
+		wait = 0
+	}
+
+	c.expiryTimer = time.AfterFunc(wait, func() {
+		if c.isConnected() {
+			c.helper.NotifyTokenExpiring(c)
+		}
+	})
+}
+
+// RevokeToken removes the auth token of the connection and the tags that have
+// been added for the token. The connection stays open, but it needs a new token
+// to subscribe to the private channels.
+func (c *Connection) RevokeToken() {
+	c.setTokenTags()
+
+	c.tokenMu.Lock()
+	defer c.tokenMu.Unlock()
+
+	c.token = nil
+
+	if c.expiryTimer != nil {
+		c.expiryTimer.Stop()
+		c.expiryTimer = nil
+	}
+}
+
+// AuthenticateAndStore validates the input token by calling the authenticator
 // that client already implemented. Stores the token details in the receiver if
 // it is valid. Otherwise, returns err.
-func (c *Connection) AuthenticateAndStore(token string) error {
-	if c.authFunc == nil {
-		return errorx.NewChannelizeError(errorx.CodeAuthFuncIsMissing)
+func (c *Connection) AuthenticateAndStore(ctx context.Context, token string) error {
+	authToken, err := ValidateToken(ctx, c.authenticator, token)
+	if err != nil {
+		return err
 	}
 
-	var err error
-	c.token, err = c.authFunc(token)
+	if err = c.approveToken(ctx, authToken); err != nil {
+		return err
+	}
+
+	c.storeToken(authToken)
+
+	return nil
+}
+
+// approveToken asks the helper to approve the validated token before storing it.
+func (c *Connection) approveToken(ctx context.Context, token *auth.Token) error {
+	if c.helper == nil {
+		return nil
+	}
+
+	return c.helper.ApproveToken(ctx, c, token)
+}
+
+// RefreshToken validates the input token and replaces the connection token
+// without changing the connection subscriptions. If the connection is already
+// authenticated, the new token must belong to the same user.
+func (c *Connection) RefreshToken(ctx context.Context, token string) error {
+	authToken, err := ValidateToken(ctx, c.authenticator, token)
 	if err != nil {
 		return err
 	}
 
-	if utils.Now().Unix() > c.token.ExpiresAt {
-		return errorx.NewChannelizeError(errorx.CodeAuthTokenIsExpired)
+	if current := c.Token(); current != nil && current.UserID != authToken.UserID {
+		return errorx.NewChannelizeError(errorx.CodeAuthUserMismatch)
 	}
 
+	if err = c.approveToken(ctx, authToken); err != nil {
+		return err
+	}
+
+	c.storeToken(authToken)
+
 	return nil
 }
 
+// ValidateToken validates the input token by calling the input authenticator.
+// It returns the token details if the token is valid and not expired.
+func ValidateToken(ctx context.Context, authenticator auth.Authenticator, token string) (*auth.Token, error) {
+	if authenticator == nil {
+		return nil, errorx.NewChannelizeError(errorx.CodeAuthFuncIsMissing)
+	}
+
+	authToken, err := authenticator.Authenticate(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+
+	if utils.Now().Unix() > authToken.ExpiresAt {
+		return nil, errorx.NewChannelizeError(errorx.CodeAuthTokenIsExpired)
+	}
+
+	return authToken, nil
+}
+
+// IsAuthenticated returns true if the connection has a token that is not
+// expired. Unlike Authenticate, it doesn't validate the expired token again,
+// so it is cheap enough to be called for each inbound message.
+func (c *Connection) IsAuthenticated() bool {
+	token := c.Token()
+	return token != nil && utils.Now().Unix() < token.ExpiresAt
+}
+
 // Authenticate validates the existing token and update the connection token
 // if the token has been updated.
-func (c *Connection) Authenticate() error {
-	if c.token == nil {
+func (c *Connection) Authenticate(ctx context.Context) error {
+	token := c.Token()
+	if token == nil {
 		return errorx.NewChannelizeError(errorx.CodeAuthTokenIsMissing)
 	}
 
 	// check if current timestamp is less than token expires_at timestamp then the
 	// validated token is still valid.
-	if utils.Now().Unix() < c.token.ExpiresAt {
+	if utils.Now().Unix() < token.ExpiresAt {
 		return nil
 	}
 
 	// if current timestamp passed the token expires_at timestamp, validate token
 	// again. It is possible that the token lifetime has been extended.
-	return c.AuthenticateAndStore(c.token.Token)
+	return c.AuthenticateAndStore(ctx, token.Token)
+}
+
+// SendMessage sends the input message to the outbound channel. It is the same
+// as SendMessageContext with the background context.
+func (c *Connection) SendMessage(message []byte) error {
+	return c.SendMessageContext(context.Background(), message)
 }
 
-// SendMessage sends the input message to the outbound channel.
+// SendMessageContext sends the input message to the outbound channel.
 // Connection.write method will receive this message and writes it to the
 // client.
 //
 // Before sending the input message, it checks if the connection is still
-// open or not. If it is closed, closes the outbound channel and return error.
+// open or not. If it is closed, returns error. The outbound channel is not
+// closed, since multiple goroutines might send messages to a closed connection.
+//
+// If the input context carries a span, the span context is queued with the
+// message, and writing the message to the peer is recorded as its child span.
 //
 // Returns error if outbound buffer is full.
-func (c *Connection) SendMessage(message []byte) error {
-	// check if the connection is already closed, close the outbound
-	// channel and return error.
+func (c *Connection) SendMessageContext(ctx context.Context, message []byte) error {
+	// check if the connection is already closed and return error.
 	if !c.isConnected() {
-		close(c.send)
 		return errorx.NewChannelizeError(errorx.CodeConnectionClosed)
 	}
 
 	select {
-	case c.send <- message:
+	case c.send <- outboundMessage{data: message, enqueuedAt: time.Now(), spanContext: trace.SpanContextFromContext(ctx)}:
+		if c.config.bufferOccupancy {
+			c.config.collector.BufferOccupancyObserve(float64(len(c.send)) / float64(cap(c.send)))
+		}
+
 		return nil
 	default:
 		// it happens when Config.outboundBufferSize is too small and load on
 		// Connection.SendMessage method is too high.
+		c.config.collector.BufferFullInc()
 		return errorx.NewChannelizeError(errorx.CodeOutboundBufferIsFull)
 	}
 }
@@ -235,10 +624,19 @@ func (c *Connection) Close() error {
 
 		c.config.collector.OpenConnectionsDec()
 
+		// stop the token expiration notice.
+		c.tokenMu.Lock()
+		if c.expiryTimer != nil {
+			c.expiryTimer.Stop()
+		}
+		c.tokenMu.Unlock()
+
 		// NOTE: do not close the outbound channel here. It can cause panic.
 
 		// remove connection from the storage
-		c.helper.Remove(c.ctx, c.id, c.UserID())
+		if c.registered {
+			c.helper.Remove(c.ctx, c.id, c.UserID())
+		}
 
 		// cancel the context to exist from read and write goroutines
 		c.cancel()
@@ -254,6 +652,68 @@ func (c *Connection) Close() error {
 	return nil
 }
 
+// CloseWithReason writes a close message with the input close code and
+// reason to the peer, then closes the connection.
+func (c *Connection) CloseWithReason(code int, reason string) error {
+	if c.isConnected() {
+		err := c.conn.WriteControl(
+			websocket.CloseMessage,
+			websocket.FormatCloseMessage(code, reason),
+			utils.Now().Add(closeMessageWait),
+		)
+		if err != nil {
+			c.Logger().Warn("failed to write close message", common.LogFieldError, err.Error())
+		}
+	}
+
+	return c.Close()
+}
+
+// reject sends the input error to the error channel and closes the connection
+// with the policy violation code. It is called when the connection has been
+// rejected by the helper, before starting the read and write goroutines.
+func (c *Connection) reject(err error) {
+	c.helper.SendError(c, err)
+
+	// write the queued error message, since the write goroutine is not running.
+	select {
+	case message := <-c.send:
+		if err := c.writeMessage(websocket.TextMessage, message.data); err != nil {
+			c.logWriteError("failed to write message", err)
+		}
+	default:
+	}
+
+	if err := c.CloseWithReason(websocket.ClosePolicyViolation, errorx.ErrorMsgRejectedByHook); err != nil {
+		c.Logger().Error(errorx.ErrorMsgFailedToCloseConnection, common.LogFieldError, err)
+	}
+}
+
+// allowInbound checks the inbound rate limit. It returns false if the message
+// should be dropped.
+//
+// It sends the rate limit error to the error channel for each dropped message,
+// and closes the connection with the policy violation code if the number of
+// consecutive dropped messages reaches the Config.maxRateLimitViolations.
+func (c *Connection) allowInbound() bool {
+	if c.limiter == nil || c.limiter.Allow() {
+		c.violations = 0
+		return true
+	}
+
+	c.violations++
+	if c.config.maxRateLimitViolations > 0 && c.violations >= c.config.maxRateLimitViolations {
+		if err := c.CloseWithReason(websocket.ClosePolicyViolation, errorx.ErrorMsgRateLimitExceeded); err != nil {
+			c.Logger().Error(errorx.ErrorMsgFailedToCloseConnection, common.LogFieldError, err)
+		}
+		return false
+	}
+
+	c.helper.SendError(c, errorx.NewChannelizeError(errorx.CodeRateLimitExceeded))
+
+	return false
+}
+
 // read sets the pong handler and read deadline and listen to the
 // websocket connection to read the client messages.
 //
@@ -266,13 +726,19 @@ func (c *Connection) read(ctx context.Context) {
 	defer func() {
 		err := c.Close()
 		if err != nil {
-			c.logger.Error(errorx.ErrorMsgFailedToCloseConnection, common.LogFieldID, c.id, common.LogFieldError, err)
+			c.Logger().Error(errorx.ErrorMsgFailedToCloseConnection, common.LogFieldError, err)
 		}
 	}()
 
+	// set maximum size of the inbound messages. The websocket connection
+	// will be closed with the message too big code if a message exceeds it.
+	if c.config.readLimit > 0 {
+		c.conn.SetReadLimit(c.config.readLimit)
+	}
+
 	// set pong message expiration time.
 	if err := c.conn.SetReadDeadline(utils.Now().Add(c.config.pongWait)); err != nil {
-		c.logger.Error(errorx.ErrorMsgFailedToSetReadDeadline, "id", c.id, "error", err.Error())
+		c.Logger().Error(errorx.ErrorMsgFailedToSetReadDeadline, common.LogFieldError, err.Error())
 		return
 	}
 
@@ -280,7 +746,7 @@ func (c *Connection) read(ctx context.Context) {
 	c.conn.SetPongHandler(func(in string) error {
 		// update pong message expiration time
 		if err := c.conn.SetReadDeadline(utils.Now().Add(c.config.pongWait)); err != nil {
-			c.logger.Error(errorx.ErrorMsgFailedToSetReadDeadline, common.LogFieldID, c.id, common.LogFieldError, err)
+			c.Logger().Error(errorx.ErrorMsgFailedToSetReadDeadline, common.LogFieldError, err)
 			return err
 		}
 
@@ -306,7 +772,12 @@ func (c *Connection) read(ctx context.Context) {
 				return
 			}
 
-			c.logger.Error("failed to read message", "id", c.id, "error", err.Error())
+			if errors.Is(err, websocket.ErrReadLimit) {
+				c.Logger().Warn("inbound message exceeded read limit")
+				return
+			}
+
+			c.Logger().Error("failed to read message", common.LogFieldError, err.Error())
 			return
 		}
 
@@ -320,6 +791,11 @@ func (c *Connection) read(ctx context.Context) {
 			continue
 		}
 
+		// drop the message if the connection exceeded the inbound rate limit.
+		if !c.allowInbound() {
+			continue
+		}
+
 		c.helper.ParseMessage(ctx, c, message)
 	}
 }
@@ -348,7 +824,7 @@ func (c *Connection) write(ctx context.Context) {
 		pingTicker.Stop()
 		err := c.Close()
 		if err != nil {
-			c.logger.Error(errorx.ErrorMsgFailedToCloseConnection, common.LogFieldID, c.id, common.LogFieldError, err)
+			c.Logger().Error(errorx.ErrorMsgFailedToCloseConnection, common.LogFieldError, err)
 		}
 	}()
 
@@ -357,31 +833,72 @@ func (c *Connection) write(ctx context.Context) {
 		case <-ctx.Done():
 			return
 		case <-pingTicker.C:
-			c.mu.RLock()
-			// return if the connection is already closed.
-			if !c.isConnected() {
-				return
-			}
-
 			// write the ping message to the peer.
-			if err := c.conn.WriteMessage(websocket.PingMessage, c.config.pingMessageFunc()); err != nil {
-				c.logger.Error("failed to write ping message", "id", c.id, "error", err.Error())
+			if err := c.writeMessage(websocket.PingMessage, c.config.pingMessageFunc()); err != nil {
+				c.logWriteError("failed to write ping message", err)
 				return
 			}
-			c.mu.RUnlock()
 		case message := <-c.send:
-			c.mu.RLock()
-			// return if the connection is already closed.
-			if !c.isConnected() {
-				return
-			}
-
 			// write the message to the peer.
-			if err := c.conn.WriteMessage(websocket.TextMessage, message); err != nil {
-				c.logger.Error("failed to write message", "id", c.id, "error", err.Error())
+			if err := c.writeOutbound(message); err != nil {
+				c.logWriteError("failed to write message", err)
 				return
 			}
-			c.mu.RUnlock()
 		}
 	}
 }
+
+// writeOutbound writes the input outbound message to the peer and observes
+// the write metrics. If the message is traced, it records the write as a
+// child span of the publisher span. Otherwise, it uses a no-op span, so the
+// errors aren't recorded in a span of the connection context.
+func (c *Connection) writeOutbound(message outboundMessage) error {
+	span := trace.SpanFromContext(context.Background())
+	if message.spanContext.IsValid() {
+		_, span = c.config.tracer.Start(
+			trace.ContextWithSpanContext(c.ctx, message.spanContext),
+			spanNameWrite,
+			trace.WithAttributes(
+				attribute.String(common.TraceAttrConnectionID, c.id),
+				attribute.Int(common.TraceAttrMessageSize, len(message.data)),
+			),
+		)
+		defer span.End()
+	}
+
+	startedAt := time.Now()
+	if err := c.writeMessage(websocket.TextMessage, message.data); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+
+	c.config.collector.WriteDurationObserve(time.Since(startedAt))
+	c.config.collector.QueueLatencyObserve(time.Since(message.enqueuedAt))
+	atomic.AddUint64(&c.bytesSent, uint64(len(message.data)))
+
+	return nil
+}
+
+// writeMessage writes the input message to the peer. It returns error if the
+// connection is already closed.
+func (c *Connection) writeMessage(messageType int, data []byte) error {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if !c.connected {
+		return errorx.NewChannelizeError(errorx.CodeConnectionClosed)
+	}
+
+	return c.conn.WriteMessage(messageType, data)
+}
+
+// logWriteError logs the write errors, except the closed connection error.
+func (c *Connection) logWriteError(msg string, err error) {
+	var chanErr *errorx.ChannelizeError
+	if errors.As(err, &chanErr) && chanErr.Code == errorx.CodeConnectionClosed {
+		return
+	}
+
+	c.Logger().Error(msg, common.LogFieldError, err.Error())
+}
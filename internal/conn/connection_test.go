@@ -5,23 +5,31 @@
 package conn
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/gorilla/websocket"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
 
 	"github.com/hmdsefi/channelize/auth"
+	"github.com/hmdsefi/channelize/internal/common"
 	"github.com/hmdsefi/channelize/internal/common/errorx"
-	"github.com/hmdsefi/channelize/internal/common/log"
 	"github.com/hmdsefi/channelize/internal/common/utils"
+	"github.com/hmdsefi/channelize/log"
 )
 
 const (
@@ -40,15 +48,39 @@ var (
 )
 
 type MockMessageProcessor struct {
-	receive chan<- string
+	receive  chan<- string
+	errs     chan error
+	expiring chan *Connection
+
+	// registerErr and approveErr are returned by Register and ApproveToken.
+	registerErr error
+	approveErr  error
 }
 
 func newMockHelper(receive chan<- string) *MockMessageProcessor {
 	return &MockMessageProcessor{
-		receive: receive,
+		receive:  receive,
+		errs:     make(chan error, 10),
+		expiring: make(chan *Connection, 10),
 	}
 }
 
+func (m MockMessageProcessor) NotifyTokenExpiring(conn *Connection) {
+	m.expiring <- conn
+}
+
+func (m MockMessageProcessor) SendError(_ *Connection, err error) {
+	m.errs <- err
+}
+
+func (m MockMessageProcessor) Register(_ context.Context, _ *Connection) error {
+	return m.registerErr
+}
+
+func (m MockMessageProcessor) ApproveToken(_ context.Context, _ *Connection, _ *auth.Token) error {
+	return m.approveErr
+}
+
 func (m MockMessageProcessor) Remove(_ context.Context, _ string, _ *string) {
 }
 
@@ -129,7 +161,7 @@ func (s *Handler) makeWebsocketHandler(t *testing.T) http.HandlerFunc {
 		s.connStore.add(NewConnection(
 			s.ctx, conn,
 			s.mockMsgProcessor,
-			testAuthenticateFunc,
+			auth.AuthenticateFunc(testAuthenticateFunc),
 			log.NewDefaultLogger(),
 			s.options...,
 		))
@@ -142,7 +174,8 @@ func TestNewConnection(t *testing.T) {
 	mockMsgProcessor := newMockHelper(receiver)
 	defer mockMsgProcessor.close()
 
-	handler := newHandler(t, mockMsgProcessor, WithPingPeriod(time.Microsecond))
+	collector := newMockCollector()
+	handler := newHandler(t, mockMsgProcessor, WithPingPeriod(time.Microsecond), WithCollector(collector))
 	server := httptest.NewServer(handler)
 	defer server.Close()
 
@@ -189,6 +222,23 @@ func TestNewConnection(t *testing.T) {
 
 		actualServerMsg := string(msg)
 		assert.Equal(t, expectedServerMsg, actualServerMsg)
+
+		assert.Eventually(t, func() bool {
+			return atomic.LoadInt32(&collector.queueLatencies) == 1 &&
+				atomic.LoadInt32(&collector.writeDurations) == 1
+		}, time.Second, 10*time.Millisecond)
+	})
+
+	t.Run("Test connection info", func(t *testing.T) {
+		conn := handler.connStore.get(0)
+		info := conn.Info()
+		assert.Equal(t, conn.ID(), info.ID)
+		assert.Equal(t, ws.LocalAddr().String(), info.RemoteAddr)
+		assert.False(t, info.ConnectedAt.IsZero())
+		assert.Equal(t, defaultOutboundBufferSize, info.BufferCap)
+		assert.Eventually(t, func() bool {
+			return conn.Info().BytesSent == uint64(len("test write message"))
+		}, time.Second, 10*time.Millisecond)
 	})
 
 	_ = handler.Close()
@@ -225,7 +275,7 @@ func TestConnection_AuthenticateAndStore(t *testing.T) {
 	t.Run("nil authFunc", func(t *testing.T) {
 		t.Parallel()
 		conn := Connection{}
-		err := conn.AuthenticateAndStore(testAuthToken)
+		err := conn.AuthenticateAndStore(context.Background(), testAuthToken)
 		require.NotNil(t, err)
 		var chanErr *errorx.ChannelizeError
 		require.True(t, errors.As(err, &chanErr))
@@ -239,8 +289,8 @@ func TestConnection_AuthenticateAndStore(t *testing.T) {
 		authFunc := func(_ string) (*auth.Token, error) {
 			return nil, errors.New(errMsg)
 		}
-		conn := Connection{authFunc: authFunc}
-		err := conn.AuthenticateAndStore(testAuthToken)
+		conn := Connection{authenticator: auth.AuthenticateFunc(authFunc)}
+		err := conn.AuthenticateAndStore(context.Background(), testAuthToken)
 		require.NotNil(t, err)
 		assert.Equal(t, errMsg, err.Error())
 	})
@@ -252,8 +302,8 @@ func TestConnection_AuthenticateAndStore(t *testing.T) {
 				ExpiresAt: utils.Now().Add(-1 * time.Minute).Unix(),
 			}, nil
 		}
-		conn := Connection{authFunc: authFunc}
-		err := conn.AuthenticateAndStore(testAuthToken)
+		conn := Connection{authenticator: auth.AuthenticateFunc(authFunc)}
+		err := conn.AuthenticateAndStore(context.Background(), testAuthToken)
 		require.NotNil(t, err)
 		var chanErr *errorx.ChannelizeError
 		require.True(t, errors.As(err, &chanErr))
@@ -271,8 +321,8 @@ func TestConnection_AuthenticateAndStore(t *testing.T) {
 			out := token
 			return &out, nil
 		}
-		conn := Connection{authFunc: authFunc}
-		err := conn.AuthenticateAndStore(testAuthToken)
+		conn := Connection{authenticator: auth.AuthenticateFunc(authFunc)}
+		err := conn.AuthenticateAndStore(context.Background(), testAuthToken)
 		require.Nil(t, err)
 		assert.Equal(t, token, *conn.token)
 	})
@@ -282,7 +332,7 @@ func TestConnection_Authenticate(t *testing.T) {
 	t.Run("nil authFunc", func(t *testing.T) {
 		t.Parallel()
 		conn := Connection{}
-		err := conn.Authenticate()
+		err := conn.Authenticate(context.Background())
 		require.NotNil(t, err)
 		var chanErr *errorx.ChannelizeError
 		require.True(t, errors.As(err, &chanErr))
@@ -301,8 +351,8 @@ func TestConnection_Authenticate(t *testing.T) {
 			return &out, nil
 		}
 
-		conn := Connection{authFunc: authFunc, token: &token}
-		err := conn.Authenticate()
+		conn := Connection{authenticator: auth.AuthenticateFunc(authFunc), token: &token}
+		err := conn.Authenticate(context.Background())
 		require.NotNil(t, err)
 		var chanErr *errorx.ChannelizeError
 		require.True(t, errors.As(err, &chanErr))
@@ -321,8 +371,8 @@ func TestConnection_Authenticate(t *testing.T) {
 			return &out, nil
 		}
 
-		conn := Connection{authFunc: authFunc, token: &token}
-		err := conn.Authenticate()
+		conn := Connection{authenticator: auth.AuthenticateFunc(authFunc), token: &token}
+		err := conn.Authenticate(context.Background())
 		assert.Nil(t, err)
 	})
 
@@ -341,19 +391,231 @@ func TestConnection_Authenticate(t *testing.T) {
 			return &out, nil
 		}
 
-		conn := Connection{authFunc: authFunc, token: &token}
-		err := conn.Authenticate()
+		conn := Connection{authenticator: auth.AuthenticateFunc(authFunc), token: &token}
+		err := conn.Authenticate(context.Background())
 		assert.Nil(t, err)
 		assert.Equal(t, extendedToken, *conn.token)
 	})
 }
 
+func TestConnection_RefreshToken(t *testing.T) {
+	const userID = "test-user-id"
+
+	newAuthFunc := func(userID string) auth.AuthenticateFunc {
+		return func(token string) (*auth.Token, error) {
+			if token != testAuthToken {
+				return nil, errors.New("invalid token")
+			}
+
+			return &auth.Token{
+				Token:     token,
+				UserID:    userID,
+				ExpiresAt: utils.Now().Add(time.Hour).Unix(),
+			}, nil
+		}
+	}
+
+	currentToken := func() *auth.Token {
+		return &auth.Token{UserID: userID, ExpiresAt: utils.Now().Add(time.Minute).Unix()}
+	}
+
+	t.Run("refresh token of the same user", func(t *testing.T) {
+		t.Parallel()
+		conn := Connection{authenticator: newAuthFunc(userID), token: currentToken()}
+		err := conn.RefreshToken(context.Background(), testAuthToken)
+		require.Nil(t, err)
+		assert.Equal(t, testAuthToken, conn.Token().Token)
+		assert.Equal(t, userID, *conn.UserID())
+	})
+
+	t.Run("refresh token of another user", func(t *testing.T) {
+		t.Parallel()
+		token := currentToken()
+		conn := Connection{authenticator: newAuthFunc("another-user-id"), token: token}
+		err := conn.RefreshToken(context.Background(), testAuthToken)
+		require.NotNil(t, err)
+		var chanErr *errorx.ChannelizeError
+		require.True(t, errors.As(err, &chanErr))
+		assert.Equal(t, errorx.CodeAuthUserMismatch, chanErr.Code)
+		assert.Equal(t, token, conn.Token())
+	})
+
+	t.Run("invalid token", func(t *testing.T) {
+		t.Parallel()
+		token := currentToken()
+		conn := Connection{authenticator: newAuthFunc(userID), token: token}
+		err := conn.RefreshToken(context.Background(), "invalid-token")
+		require.NotNil(t, err)
+		assert.Equal(t, token, conn.Token())
+	})
+
+	t.Run("refresh anonymous connection", func(t *testing.T) {
+		t.Parallel()
+		conn := Connection{authenticator: newAuthFunc(userID)}
+		err := conn.RefreshToken(context.Background(), testAuthToken)
+		require.Nil(t, err)
+		assert.Equal(t, userID, *conn.UserID())
+	})
+}
+
+func TestConnection_ApproveToken(t *testing.T) {
+	mockHelper := newMockHelper(make(chan string))
+	mockHelper.approveErr = errors.New("token is rejected")
+	conn := &Connection{
+		connected: true,
+		helper:    mockHelper,
+		authenticator: auth.AuthenticateFunc(func(token string) (*auth.Token, error) {
+			return &auth.Token{Token: token, ExpiresAt: utils.Now().Add(time.Hour).Unix()}, nil
+		}),
+	}
+
+	err := conn.AuthenticateAndStore(context.Background(), "token")
+	assert.Equal(t, mockHelper.approveErr, err)
+	assert.Nil(t, conn.Token())
+
+	err = conn.RefreshToken(context.Background(), "token")
+	assert.Equal(t, mockHelper.approveErr, err)
+	assert.Nil(t, conn.Token())
+}
+
+func TestConnection_Tags(t *testing.T) {
+	conn := &Connection{
+		connected: true,
+		config: Config{tagsFunc: func(token *auth.Token) []string {
+			return []string{"org:" + token.Claims["org"].(string), ""}
+		}},
+	}
+
+	assert.Nil(t, conn.Tags())
+	assert.False(t, conn.HasTag("vip"))
+
+	conn.AddTags("vip", "", "beta")
+	assert.Equal(t, []string{"beta", "vip"}, conn.Tags())
+	assert.True(t, conn.HasTag("vip"))
+
+	// the tags of the token are added when the token is stored.
+	conn.storeToken(&auth.Token{UserID: "user-1", Claims: map[string]interface{}{"org": "acme"}})
+	assert.Equal(t, []string{"beta", "org:acme", "vip"}, conn.Tags())
+
+	conn.RemoveTags("beta", "unknown")
+	assert.Equal(t, []string{"org:acme", "vip"}, conn.Tags())
+	assert.False(t, conn.HasTag("beta"))
+}
+
+func TestConnection_TokenExpiryNotice(t *testing.T) {
+	mockHelper := newMockHelper(make(chan string))
+	conn := &Connection{
+		connected: true,
+		helper:    mockHelper,
+		config:    Config{tokenExpiryNotice: time.Hour},
+	}
+
+	// the token expires in the notice window, so the client is notified immediately.
+	conn.storeToken(&auth.Token{ExpiresAt: utils.Now().Add(time.Minute).Unix()})
+	select {
+	case actual := <-mockHelper.expiring:
+		assert.Equal(t, conn, actual)
+	case <-time.After(time.Second):
+		t.Fatal("token expiry notice is not sent")
+	}
+
+	// replacing the token reschedules the notice.
+	conn.storeToken(&auth.Token{ExpiresAt: utils.Now().Add(2 * time.Hour).Unix()})
+	select {
+	case <-mockHelper.expiring:
+		t.Fatal("token expiry notice is sent before the notice window")
+	case <-time.After(50 * time.Millisecond):
+	}
+	conn.expiryTimer.Stop()
+}
+
+func TestConnection_Logger(t *testing.T) {
+	var buf bytes.Buffer
+	conn := &Connection{
+		logger: log.With(
+			log.NewDefaultLogger(log.WithOutput(&buf), log.WithJSON(true)),
+			common.LogFieldID, "test-conn-id",
+			common.LogFieldRemoteAddr, "127.0.0.1:1234",
+		),
+	}
+
+	conn.Logger().Info("anonymous")
+	assert.NotContains(t, buf.String(), common.LogFieldUserID)
+
+	buf.Reset()
+	conn.storeToken(&auth.Token{UserID: "test-user-id", ExpiresAt: utils.Now().Add(time.Hour).Unix()})
+	conn.Logger().Info("authenticated")
+
+	var out map[string]interface{}
+	require.Nil(t, json.Unmarshal(buf.Bytes(), &out))
+	assert.Equal(t, "test-conn-id", out[common.LogFieldID])
+	assert.Equal(t, "127.0.0.1:1234", out[common.LogFieldRemoteAddr])
+	assert.Equal(t, "test-user-id", out[common.LogFieldUserID])
+}
+
+func TestConnection_IsAuthenticated(t *testing.T) {
+	var calls int
+	authFunc := func(_ string) (*auth.Token, error) {
+		calls++
+		return &auth.Token{ExpiresAt: utils.Now().Add(time.Minute).Unix()}, nil
+	}
+
+	conn := Connection{authenticator: auth.AuthenticateFunc(authFunc)}
+	assert.False(t, conn.IsAuthenticated())
+
+	conn.token = &auth.Token{ExpiresAt: utils.Now().Add(time.Minute).Unix()}
+	assert.True(t, conn.IsAuthenticated())
+
+	// the expired token is not validated again.
+	conn.token = &auth.Token{ExpiresAt: utils.Now().Add(-1 * time.Minute).Unix()}
+	assert.False(t, conn.IsAuthenticated())
+	assert.Zero(t, calls)
+}
+
+func TestConnection_RevokeToken(t *testing.T) {
+	mockHelper := newMockHelper(make(chan string))
+	conn := &Connection{
+		connected: true,
+		helper:    mockHelper,
+		config: Config{
+			tokenExpiryNotice: time.Minute,
+			tagsFunc: func(token *auth.Token) []string {
+				return []string{"org:" + token.Claims["org"].(string)}
+			},
+		},
+	}
+
+	// the server tag is the same as the tag of the first token.
+	conn.AddTags("vip", "org:acme")
+	conn.storeToken(&auth.Token{
+		UserID:    "test-user-id",
+		ExpiresAt: utils.Now().Add(time.Hour).Unix(),
+		Claims:    map[string]interface{}{"org": "acme"},
+	})
+
+	// the tags of the previous token are replaced, but the server tags are kept.
+	conn.storeToken(&auth.Token{
+		UserID:    "test-user-id",
+		ExpiresAt: utils.Now().Add(time.Hour).Unix(),
+		Claims:    map[string]interface{}{"org": "globex"},
+	})
+	assert.Equal(t, []string{"org:acme", "org:globex", "vip"}, conn.Tags())
+
+	conn.RevokeToken()
+
+	assert.Nil(t, conn.Token())
+	assert.Nil(t, conn.UserID())
+	assert.Nil(t, conn.expiryTimer)
+	assert.Equal(t, []string{"org:acme", "vip"}, conn.Tags())
+	assert.False(t, conn.HasTag("org:globex"))
+}
+
 func TestConnection_SendMessage(t *testing.T) {
 	testMessage := []byte("test")
 
 	t.Run("send message to a closed connection", func(t *testing.T) {
 		t.Parallel()
-		conn := &Connection{send: make(chan []byte, 1), connected: false}
+		conn := &Connection{send: make(chan outboundMessage, 1), connected: false}
 		err := conn.SendMessage(testMessage)
 		require.NotNil(t, err)
 		var chanErr *errorx.ChannelizeError
@@ -364,7 +626,8 @@ func TestConnection_SendMessage(t *testing.T) {
 
 	t.Run("inbound buffer is full", func(t *testing.T) {
 		t.Parallel()
-		conn := &Connection{send: make(chan []byte, 1), connected: true}
+		collector := newMockCollector()
+		conn := &Connection{send: make(chan outboundMessage, 1), connected: true, config: Config{collector: collector}}
 		err := conn.SendMessage(testMessage)
 		require.Nil(t, err)
 		err = conn.SendMessage(testMessage)
@@ -373,13 +636,198 @@ func TestConnection_SendMessage(t *testing.T) {
 		require.True(t, errors.As(err, &chanErr))
 		assert.Equal(t, errorx.CodeOutboundBufferIsFull, chanErr.Code)
 		assert.Equal(t, errorx.ErrorMsgOutboundBufferIsFull, chanErr.Error())
+		assert.Equal(t, int32(1), collector.bufferFull)
 	})
 
 	t.Run("send message", func(t *testing.T) {
 		t.Parallel()
-		conn := &Connection{send: make(chan []byte, 1), connected: true}
+		conn := &Connection{send: make(chan outboundMessage, 1), connected: true}
 		err := conn.SendMessage(testMessage)
 		require.Nil(t, err)
-		assert.Equal(t, testMessage, <-conn.send)
+		assert.Equal(t, testMessage, (<-conn.send).data)
+	})
+
+	t.Run("observe buffer occupancy", func(t *testing.T) {
+		t.Parallel()
+		collector := newMockCollector()
+		conn := &Connection{
+			send:      make(chan outboundMessage, 2),
+			connected: true,
+			config:    Config{collector: collector, bufferOccupancy: true},
+		}
+		require.Nil(t, conn.SendMessage(testMessage))
+		require.Nil(t, conn.SendMessage(testMessage))
+		assert.Equal(t, []float64{0.5, 1}, collector.Occupancies())
 	})
 }
+
+// TestConnection_InboundRateLimit sends more messages than the rate limit allows
+// and expects rate limit error and closing the connection with policy violation.
+func TestConnection_InboundRateLimit(t *testing.T) {
+	receiver := make(chan string, 10)
+	mockMsgProcessor := newMockHelper(receiver)
+
+	handler := newHandler(
+		t, mockMsgProcessor,
+		WithInboundRateLimit(0.001, 1),
+		WithMaxRateLimitViolations(2),
+	)
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	defer func() { _ = handler.Close() }()
+
+	wsURL := protocolWS + strings.TrimPrefix(server.URL, protocolHTTP) + wsPath
+
+	ws, resp, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	require.Nil(t, err)
+	defer func() {
+		_ = resp.Body.Close()
+		_ = ws.Close()
+	}()
+
+	expectedClientMsg := "test rate limit"
+	for i := 0; i < 3; i++ {
+		require.Nil(t, ws.WriteMessage(websocket.TextMessage, []byte(expectedClientMsg)))
+	}
+
+	assert.Equal(t, expectedClientMsg, <-receiver)
+
+	err = <-mockMsgProcessor.errs
+	var chanErr *errorx.ChannelizeError
+	require.True(t, errors.As(err, &chanErr))
+	assert.Equal(t, errorx.CodeRateLimitExceeded, chanErr.Code)
+
+	_, _, err = ws.ReadMessage()
+	var closeErr *websocket.CloseError
+	require.True(t, errors.As(err, &closeErr))
+	assert.Equal(t, websocket.ClosePolicyViolation, closeErr.Code)
+	assert.Equal(t, errorx.ErrorMsgRateLimitExceeded, closeErr.Text)
+}
+
+// TestConnection_ReadLimit sends a message that is bigger than the read limit
+// and expects closing the connection with message too big code.
+func TestConnection_ReadLimit(t *testing.T) {
+	receiver := make(chan string, 1)
+	mockMsgProcessor := newMockHelper(receiver)
+
+	handler := newHandler(t, mockMsgProcessor, WithReadLimit(8))
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	defer func() { _ = handler.Close() }()
+
+	wsURL := protocolWS + strings.TrimPrefix(server.URL, protocolHTTP) + wsPath
+
+	ws, resp, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	require.Nil(t, err)
+	defer func() {
+		_ = resp.Body.Close()
+		_ = ws.Close()
+	}()
+
+	require.Nil(t, ws.WriteMessage(websocket.TextMessage, []byte("message bigger than read limit")))
+
+	_, _, err = ws.ReadMessage()
+	var closeErr *websocket.CloseError
+	require.True(t, errors.As(err, &closeErr))
+	assert.Equal(t, websocket.CloseMessageTooBig, closeErr.Code)
+}
+
+// TestConnection_WriteSpan sends a traced message and expects a write span
+// that is the child of the publisher span.
+func TestConnection_WriteSpan(t *testing.T) {
+	receiver := make(chan string, 1)
+	mockMsgProcessor := newMockHelper(receiver)
+
+	recorder := tracetest.NewSpanRecorder()
+	tracer := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)).Tracer("test")
+
+	handler := newHandler(t, mockMsgProcessor, WithTracer(tracer))
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	defer func() { _ = handler.Close() }()
+
+	wsURL := protocolWS + strings.TrimPrefix(server.URL, protocolHTTP) + wsPath
+
+	ws, resp, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	require.Nil(t, err)
+	defer func() {
+		_ = resp.Body.Close()
+		_ = ws.Close()
+	}()
+
+	require.Eventually(t, func() bool { return handler.connStore.len() == 1 }, time.Second, 10*time.Millisecond)
+	conn := handler.connStore.get(0)
+
+	// untraced messages don't have write span.
+	require.Nil(t, conn.SendMessage([]byte("untraced")))
+	_, _, err = ws.ReadMessage()
+	require.Nil(t, err)
+
+	ctx, span := tracer.Start(context.Background(), "publish")
+	require.Nil(t, conn.SendMessageContext(ctx, []byte("traced")))
+	span.End()
+
+	_, msg, err := ws.ReadMessage()
+	require.Nil(t, err)
+	assert.Equal(t, "traced", string(msg))
+
+	require.Eventually(t, func() bool { return len(recorder.Ended()) == 2 }, time.Second, 10*time.Millisecond)
+
+	var writeSpan sdktrace.ReadOnlySpan
+	for _, s := range recorder.Ended() {
+		if s.Name() == spanNameWrite {
+			writeSpan = s
+		}
+	}
+
+	require.NotNil(t, writeSpan)
+	assert.Equal(t, span.SpanContext().SpanID(), writeSpan.Parent().SpanID())
+	assert.Contains(t, writeSpan.Attributes(), attribute.String(common.TraceAttrConnectionID, conn.ID()))
+}
+
+// TestConnection_WriteOutbound_Untraced writes an untraced message to a
+// closed connection and expects that the error isn't recorded in the span of
+// the connection context.
+func TestConnection_WriteOutbound_Untraced(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	tracer := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)).Tracer("test")
+
+	ctx, span := tracer.Start(context.Background(), "server")
+	conn := &Connection{ctx: ctx, connected: false, config: Config{tracer: tracer}}
+
+	require.NotNil(t, conn.writeOutbound(outboundMessage{data: []byte("untraced")}))
+	span.End()
+
+	require.Len(t, recorder.Ended(), 1)
+	assert.Empty(t, recorder.Ended()[0].Events())
+	assert.Equal(t, codes.Unset, recorder.Ended()[0].Status().Code)
+}
+
+// TestConnection_Rejected expects closing the connection with the policy
+// violation code if the helper rejects the connection.
+func TestConnection_Rejected(t *testing.T) {
+	mockMsgProcessor := newMockHelper(make(chan string))
+	mockMsgProcessor.registerErr = errors.New("connection is rejected")
+
+	handler := newHandler(t, mockMsgProcessor)
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	defer func() { _ = handler.Close() }()
+
+	wsURL := protocolWS + strings.TrimPrefix(server.URL, protocolHTTP) + wsPath
+
+	ws, resp, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	require.Nil(t, err)
+	defer func() {
+		_ = resp.Body.Close()
+		_ = ws.Close()
+	}()
+
+	assert.Equal(t, mockMsgProcessor.registerErr, <-mockMsgProcessor.errs)
+
+	_, _, err = ws.ReadMessage()
+	var closeErr *websocket.CloseError
+	require.True(t, errors.As(err, &closeErr))
+	assert.Equal(t, websocket.ClosePolicyViolation, closeErr.Code)
+	assert.Equal(t, errorx.ErrorMsgRejectedByHook, closeErr.Text)
+}
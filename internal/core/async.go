@@ -0,0 +1,110 @@
+/**
+ * Copyright © 2022 Hamed Yousefi <hdyousefi@gmail.com>.
+ */
+
+package core
+
+import (
+	"context"
+	"sync"
+
+	"github.com/hmdsefi/channelize/internal/channel"
+)
+
+// defaultAsyncQueueSize is the default maximum number of the messages that
+// wait to be sent by SendPublicMessageAsync if the fan-out pool is disabled.
+const defaultAsyncQueueSize = 256
+
+// asyncTask represents a message of SendPublicMessageAsync that waits in the
+// async queue.
+type asyncTask struct {
+	ctx      context.Context
+	ch       channel.Channel
+	message  interface{}
+	callback func(*DeliveryResult, error)
+}
+
+// asyncQueue sends the messages of SendPublicMessageAsync by a single worker
+// in the queue order, so the messages of a channel are delivered in the
+// publish order. The worker starts with the first message.
+type asyncQueue struct {
+	queue chan *asyncTask
+	send  func(*asyncTask)
+
+	startOnce sync.Once
+	wg        sync.WaitGroup
+
+	// mu prevents sending a task to the closed queue.
+	mu     sync.RWMutex
+	closed bool
+
+	// done is closed when the queue is closing. It unblocks the publishers
+	// that wait for the full queue while holding the read lock of mu.
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// newAsyncQueue creates a new asyncQueue with the input size. The worker
+// sends the queued tasks by the input send function.
+func newAsyncQueue(size int, send func(*asyncTask)) *asyncQueue {
+	return &asyncQueue{
+		queue: make(chan *asyncTask, size),
+		send:  send,
+		done:  make(chan struct{}),
+	}
+}
+
+// submit queues the input task. If the queue is full, it blocks until the
+// worker takes a task or the task context is done, and returns the context
+// error. It returns false if the queue is closed.
+func (q *asyncQueue) submit(task *asyncTask) (bool, error) {
+	q.startOnce.Do(func() {
+		q.wg.Add(1)
+		go q.work()
+	})
+
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
+	if q.closed {
+		return false, nil
+	}
+
+	select {
+	case q.queue <- task:
+		return true, nil
+	case <-task.ctx.Done():
+		return true, task.ctx.Err()
+	case <-q.done:
+		return false, nil
+	}
+}
+
+// work sends the queued tasks until the queue is closed.
+func (q *asyncQueue) work() {
+	defer q.wg.Done()
+
+	for task := range q.queue {
+		q.send(task)
+	}
+}
+
+// close stops accepting new tasks, and waits until the worker sends the
+// queued tasks.
+func (q *asyncQueue) close() {
+	q.closeOnce.Do(func() {
+		// the worker shouldn't start after closing the queue.
+		q.startOnce.Do(func() {})
+
+		// the blocked publishers hold the read lock, so they should be
+		// released before taking the lock.
+		close(q.done)
+
+		q.mu.Lock()
+		q.closed = true
+		close(q.queue)
+		q.mu.Unlock()
+
+		q.wg.Wait()
+	})
+}
@@ -0,0 +1,326 @@
+/**
+ * Copyright © 2022 Hamed Yousefi <hdyousefi@gmail.com>.
+ */
+
+package core
+
+import (
+	"bytes"
+	"context"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/hmdsefi/channelize/internal/channel"
+	"github.com/hmdsefi/channelize/internal/common"
+	"github.com/hmdsefi/channelize/log"
+)
+
+// Envelope represents a message of a batch publish and its channel.
+type Envelope struct {
+	Channel channel.Channel
+	Message interface{}
+}
+
+// EnvelopeResult represents the result of publishing an Envelope.
+type EnvelopeResult struct {
+	DeliveryResult
+
+	// Err is the error of serializing the message. The message is not sent
+	// to any connection if it is not nil.
+	Err error
+}
+
+// batchTarget represents a connection and the indexes of the batch messages
+// that should be sent to it.
+type batchTarget struct {
+	conn    common.ConnectionWrapper
+	indexes []int
+}
+
+// batchGroup represents the connections that receive the same frame of a
+// batch publish, and the indexes of the batch messages in the frame.
+type batchGroup struct {
+	connections []common.ConnectionWrapper
+	frame       []byte
+	indexes     []int
+}
+
+// batchSender sends the frames of a batch publish to the connections. It
+// doesn't collect the metrics, since a frame might contain the messages of
+// multiple channels.
+type batchSender struct {
+	logger log.Logger
+}
+
+// sendAll sends the input frame to the input connections and returns the
+// delivery result.
+func (s batchSender) sendAll(
+	ctx context.Context,
+	connections []common.ConnectionWrapper,
+	_ channel.Channel,
+	frame []byte,
+) *DeliveryResult {
+	result := new(DeliveryResult)
+	for _, conn := range connections {
+		if err := conn.SendMessageContext(ctx, frame); err != nil {
+			result.addFailure(conn.ID(), err)
+			s.logger.Error(
+				"failed to send public message to the inbound buffer",
+				common.LogFieldID, conn.ID(),
+				common.LogFieldError, err.Error(),
+			)
+			continue
+		}
+
+		result.Delivered++
+	}
+
+	return result
+}
+
+// dropAll records the frame as dropped for the input connections because of
+// the input error.
+func (s batchSender) dropAll(connections []common.ConnectionWrapper, _ channel.Channel, err error) *DeliveryResult {
+	result := new(DeliveryResult)
+	for _, conn := range connections {
+		result.addFailure(conn.ID(), err)
+	}
+
+	return result
+}
+
+// SendPublicMessages sends the input messages to the available connections of
+// their channels. It takes a single snapshot of the storage for all the
+// channels, and marshals each message once. The messages are queued in the
+// input order, so each connection receives them in the same order.
+//
+// If the batch frames are enabled, the messages of each connection are sent in
+// a single frame of the batch channel. A connection that receives only one
+// message of the batch gets the message itself.
+//
+// If the fan-out pool is enabled, the frames are sent by the fan-out workers
+// like the other published messages, and it returns after all the frames are
+// sent.
+//
+// The returned results have the same order as the input envelopes.
+func (d *Dispatch) SendPublicMessages(ctx context.Context, envelopes []Envelope) []EnvelopeResult {
+	startedAt := time.Now()
+
+	ctx, span := d.config.tracer.Start(
+		ctx, spanNameBatch,
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(attribute.Int(common.TraceAttrBatchSize, len(envelopes))),
+	)
+	defer span.End()
+
+	channels := make([]channel.Channel, len(envelopes))
+	for i := range envelopes {
+		channels[i] = envelopes[i].Channel
+	}
+
+	subscribers := d.store.ConnectionsByChannels(ctx, channels)
+	defer func() {
+		for ch := range subscribers {
+			d.observeFanout(ch, startedAt)
+		}
+	}()
+
+	results := make([]EnvelopeResult, len(envelopes))
+	frames := make([][]byte, len(envelopes))
+	for i, envelope := range envelopes {
+		d.collector.MessagesPublishedInc(envelope.Channel.String())
+
+		results[i].Subscribers = len(subscribers[envelope.Channel])
+		if results[i].Subscribers == 0 {
+			continue
+		}
+
+		frames[i], results[i].Err = d.marshal(ctx, envelope.Channel, envelope.Message)
+	}
+
+	var groups []*batchGroup
+	if d.config.batchFrames {
+		groups = batchFrameGroups(envelopes, subscribers, frames)
+	} else {
+		for i, envelope := range envelopes {
+			if frames[i] == nil {
+				continue
+			}
+
+			groups = append(groups, &batchGroup{connections: subscribers[envelope.Channel], frame: frames[i], indexes: []int{i}})
+		}
+	}
+
+	d.sendBatchGroups(ctx, envelopes, groups, results)
+
+	var delivered, dropped int
+	for _, result := range results {
+		delivered += result.Delivered
+		dropped += result.Dropped
+	}
+
+	span.SetAttributes(
+		attribute.Int(common.TraceAttrDelivered, delivered),
+		attribute.Int(common.TraceAttrDropped, dropped),
+	)
+
+	return results
+}
+
+// batchFrameGroups groups the serialized messages by connection, so each
+// connection receives a single frame. The connections that receive the same
+// messages share the frame.
+func batchFrameGroups(
+	envelopes []Envelope,
+	subscribers map[channel.Channel][]common.ConnectionWrapper,
+	frames [][]byte,
+) []*batchGroup {
+	var targets []*batchTarget
+	connID2Target := make(map[string]*batchTarget)
+	for i, envelope := range envelopes {
+		if frames[i] == nil {
+			continue
+		}
+
+		for _, conn := range subscribers[envelope.Channel] {
+			target, exists := connID2Target[conn.ID()]
+			if !exists {
+				target = &batchTarget{conn: conn}
+				connID2Target[conn.ID()] = target
+				targets = append(targets, target)
+			}
+
+			target.indexes = append(target.indexes, i)
+		}
+	}
+
+	var groups []*batchGroup
+	key2Group := make(map[string]*batchGroup)
+	for _, target := range targets {
+		key := batchKey(target.indexes)
+		group, exists := key2Group[key]
+		if !exists {
+			group = &batchGroup{indexes: target.indexes}
+			if len(target.indexes) == 1 {
+				// the connection with a single message gets the message itself.
+				group.frame = frames[target.indexes[0]]
+			} else {
+				group.frame = newBatchFrame(frames, target.indexes)
+			}
+
+			key2Group[key] = group
+			groups = append(groups, group)
+		}
+
+		group.connections = append(group.connections, target.conn)
+	}
+
+	return groups
+}
+
+// sendBatchGroups sends the frame of each group to its connections, and
+// records the delivery results of the group messages. If the fan-out pool is
+// enabled, the frames are sent by the fan-out workers in the group order, so
+// each connection receives the messages in the input order. It returns after
+// all the frames are sent.
+func (d *Dispatch) sendBatchGroups(
+	ctx context.Context,
+	envelopes []Envelope,
+	groups []*batchGroup,
+	results []EnvelopeResult,
+) {
+	var (
+		wg sync.WaitGroup
+		mu sync.Mutex
+	)
+
+	sender := batchSender{logger: d.logger}
+	wg.Add(len(groups))
+	for _, group := range groups {
+		group := group
+		done := func(result *DeliveryResult) {
+			defer wg.Done()
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			d.recordBatchResult(envelopes, group.indexes, result, results)
+		}
+
+		ch := channel.BatchChannel
+		if len(group.indexes) == 1 {
+			ch = envelopes[group.indexes[0]].Channel
+		}
+
+		if d.pool != nil && d.pool.submitWith(ctx, sender, group.connections, ch, group.frame, done) {
+			continue
+		}
+
+		done(sender.sendAll(ctx, group.connections, ch, group.frame))
+	}
+
+	wg.Wait()
+}
+
+// recordBatchResult adds the delivery result of a frame to the results of the
+// messages with the input indexes, and collects the message metrics.
+func (d *Dispatch) recordBatchResult(
+	envelopes []Envelope,
+	indexes []int,
+	result *DeliveryResult,
+	results []EnvelopeResult,
+) {
+	for _, i := range indexes {
+		ch := envelopes[i].Channel.String()
+
+		results[i].Delivered += result.Delivered
+		for j := 0; j < result.Delivered; j++ {
+			d.collector.MessagesDeliveredInc(ch)
+		}
+
+		for _, failure := range result.Failures {
+			results[i].addFailure(failure.ConnectionID, failure.Err)
+			d.collector.MessagesDroppedInc(ch, dropReason(failure.Err))
+		}
+	}
+}
+
+// newBatchFrame creates a frame of the batch channel that contains the
+// serialized messages with the input indexes. The messages are not marshaled
+// again.
+func newBatchFrame(frames [][]byte, indexes []int) []byte {
+	size := len(`{"channel":"","data":[]}`) + len(channel.BatchChannel)
+	for _, i := range indexes {
+		size += len(frames[i]) + 1
+	}
+
+	buf := bytes.NewBuffer(make([]byte, 0, size))
+	buf.WriteString(`{"channel":"`)
+	buf.WriteString(channel.BatchChannel.String())
+	buf.WriteString(`","data":[`)
+	for j, i := range indexes {
+		if j > 0 {
+			buf.WriteByte(',')
+		}
+		buf.Write(frames[i])
+	}
+	buf.WriteString(`]}`)
+
+	return buf.Bytes()
+}
+
+// batchKey returns a unique key for the input indexes.
+func batchKey(indexes []int) string {
+	var sb strings.Builder
+	for _, i := range indexes {
+		sb.WriteString(strconv.Itoa(i))
+		sb.WriteByte(',')
+	}
+
+	return sb.String()
+}
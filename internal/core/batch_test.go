@@ -0,0 +1,186 @@
+/**
+ * Copyright © 2022 Hamed Yousefi <hdyousefi@gmail.com>.
+ */
+
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/hmdsefi/channelize/internal/channel"
+	"github.com/hmdsefi/channelize/internal/common/errorx"
+	"github.com/hmdsefi/channelize/internal/core/mock"
+	"github.com/hmdsefi/channelize/log"
+)
+
+// TestDispatch_SendPublicMessages sends a batch of messages to the connections
+// of their channels in the input order.
+func TestDispatch_SendPublicMessages(t *testing.T) {
+	ctx := context.Background()
+	conn1 := mock.NewConnection(testConnectionIDs[0], nil, authNoopFunc)
+	conn2 := mock.NewConnection(testConnectionIDs[1], nil, authNoopFunc)
+	fullErr := errorx.NewChannelizeError(errorx.CodeOutboundBufferIsFull)
+	full := mock.NewConnection(testConnectionIDs[2], nil, authNoopFunc).WithError(fullErr)
+
+	cache := NewCache(mock.NewCollector())
+	cache.Subscribe(ctx, conn1, "alerts", "feed")
+	cache.Subscribe(ctx, conn2, "feed")
+	cache.Subscribe(ctx, full, "alerts")
+
+	collector := mock.NewCollector()
+	dispatch := NewDispatch(cache, collector, log.NewDefaultLogger())
+
+	results := dispatch.SendPublicMessages(ctx, []Envelope{
+		{Channel: "feed", Message: "feed-1"},
+		{Channel: "alerts", Message: "alert-1"},
+		{Channel: "feed", Message: complex64(1)},
+		{Channel: "feed", Message: "feed-2"},
+		{Channel: "news", Message: "news-1"},
+	})
+
+	require.Len(t, results, 5)
+	assert.Equal(t, DeliveryResult{Subscribers: 2, Delivered: 2}, results[0].DeliveryResult)
+	assert.Equal(t, DeliveryResult{
+		Subscribers: 2,
+		Delivered:   1,
+		Dropped:     1,
+		Failures:    []DeliveryFailure{{ConnectionID: full.ID(), Err: fullErr}},
+	}, results[1].DeliveryResult)
+	var chanErr *errorx.ChannelizeError
+	require.True(t, errors.As(results[2].Err, &chanErr))
+	assert.Equal(t, errorx.CodeFailedToMarshalMessage, chanErr.Code)
+	assert.Equal(t, DeliveryResult{Subscribers: 2, Delivered: 2}, results[3].DeliveryResult)
+	assert.Equal(t, EnvelopeResult{}, results[4])
+
+	assert.Equal(t, []MessageOut{
+		*newMessageOut("feed", "feed-1"),
+		*newMessageOut("alerts", "alert-1"),
+		*newMessageOut("feed", "feed-2"),
+	}, receiveMessages(t, conn1, 3))
+	assert.Equal(t, []MessageOut{
+		*newMessageOut("feed", "feed-1"),
+		*newMessageOut("feed", "feed-2"),
+	}, receiveMessages(t, conn2, 2))
+
+	// each message of a subscribed channel is marshaled once.
+	assert.Equal(t, int32(3), collector.MarshalCount)
+}
+
+// TestDispatch_SendPublicMessages_BatchFrames sends the messages of each
+// connection in a single frame of the batch channel.
+func TestDispatch_SendPublicMessages_BatchFrames(t *testing.T) {
+	ctx := context.Background()
+	conn1 := mock.NewConnection(testConnectionIDs[0], nil, authNoopFunc)
+	conn2 := mock.NewConnection(testConnectionIDs[1], nil, authNoopFunc)
+	conn3 := mock.NewConnection(testConnectionIDs[2], nil, authNoopFunc)
+
+	cache := NewCache(mock.NewCollector())
+	cache.Subscribe(ctx, conn1, "alerts", "feed")
+	cache.Subscribe(ctx, conn2, "alerts", "feed")
+	cache.Subscribe(ctx, conn3, "alerts")
+
+	dispatch := NewDispatch(cache, mock.NewCollector(), log.NewDefaultLogger(), WithBatchFrames(true))
+
+	results := dispatch.SendPublicMessages(ctx, []Envelope{
+		{Channel: "feed", Message: "feed-1"},
+		{Channel: "alerts", Message: "alert-1"},
+	})
+	assert.Equal(t, []EnvelopeResult{
+		{DeliveryResult: DeliveryResult{Subscribers: 2, Delivered: 2}},
+		{DeliveryResult: DeliveryResult{Subscribers: 3, Delivered: 3}},
+	}, results)
+
+	for _, conn := range []*mock.Connection{conn1, conn2} {
+		require.Len(t, conn.Message(), 1)
+
+		var frame struct {
+			Channel channel.Channel `json:"channel"`
+			Data    []MessageOut    `json:"data"`
+		}
+		require.Nil(t, json.Unmarshal(<-conn.Message(), &frame))
+		assert.Equal(t, channel.BatchChannel, frame.Channel)
+		assert.Equal(t, []MessageOut{
+			*newMessageOut("feed", "feed-1"),
+			*newMessageOut("alerts", "alert-1"),
+		}, frame.Data)
+	}
+
+	// the connection with a single message gets the message itself.
+	assert.Equal(t, []MessageOut{*newMessageOut("alerts", "alert-1")}, receiveMessages(t, conn3, 1))
+}
+
+// TestDispatch_SendPublicMessages_FanoutPool sends the batch messages by using
+// the fan-out workers.
+func TestDispatch_SendPublicMessages_FanoutPool(t *testing.T) {
+	ctx := context.Background()
+
+	for _, batchFrames := range []bool{false, true} {
+		conn1 := mock.NewConnection(testConnectionIDs[0], nil, authNoopFunc)
+		conn2 := mock.NewConnection(testConnectionIDs[1], nil, authNoopFunc)
+		fullErr := errorx.NewChannelizeError(errorx.CodeOutboundBufferIsFull)
+		full := mock.NewConnection(testConnectionIDs[2], nil, authNoopFunc).WithError(fullErr)
+
+		cache := NewCache(mock.NewCollector())
+		cache.Subscribe(ctx, conn1, "alerts", "feed")
+		cache.Subscribe(ctx, conn2, "feed")
+		cache.Subscribe(ctx, full, "alerts")
+
+		collector := mock.NewCollector()
+		dispatch := NewDispatch(
+			cache, collector, log.NewDefaultLogger(),
+			WithBatchFrames(batchFrames), WithFanoutPool(WithFanoutWorkers(2)),
+		)
+
+		results := dispatch.SendPublicMessages(ctx, []Envelope{
+			{Channel: "feed", Message: "feed-1"},
+			{Channel: "alerts", Message: "alert-1"},
+			{Channel: "feed", Message: "feed-2"},
+		})
+		dispatch.Close()
+
+		assert.Equal(t, []EnvelopeResult{
+			{DeliveryResult: DeliveryResult{Subscribers: 2, Delivered: 2}},
+			{DeliveryResult: DeliveryResult{
+				Subscribers: 2,
+				Delivered:   1,
+				Dropped:     1,
+				Failures:    []DeliveryFailure{{ConnectionID: full.ID(), Err: fullErr}},
+			}},
+			{DeliveryResult: DeliveryResult{Subscribers: 2, Delivered: 2}},
+		}, results)
+		assert.NotZero(t, collector.FanoutQueueLatencyCount)
+
+		if batchFrames {
+			require.Len(t, conn1.Message(), 1)
+			require.Len(t, conn2.Message(), 1)
+			continue
+		}
+
+		assert.Equal(t, []MessageOut{
+			*newMessageOut("feed", "feed-1"),
+			*newMessageOut("alerts", "alert-1"),
+			*newMessageOut("feed", "feed-2"),
+		}, receiveMessages(t, conn1, 3))
+		assert.Equal(t, []MessageOut{
+			*newMessageOut("feed", "feed-1"),
+			*newMessageOut("feed", "feed-2"),
+		}, receiveMessages(t, conn2, 2))
+	}
+}
+
+func receiveMessages(t *testing.T, conn *mock.Connection, n int) []MessageOut {
+	require.Len(t, conn.Message(), n)
+
+	messages := make([]MessageOut, n)
+	for i := range messages {
+		require.Nil(t, json.Unmarshal(<-conn.Message(), &messages[i]))
+	}
+
+	return messages
+}
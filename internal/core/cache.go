@@ -18,6 +18,8 @@ type collector interface {
 	SubscribedChannels(float64)
 	PrivateConnections(float64)
 	OpenConnections(float64)
+	SubscriptionsInc(ch string)
+	UnsubscriptionsInc(ch string)
 }
 
 // Cache is an in-memory storage to store available channels and connections.
@@ -40,6 +42,16 @@ type Cache struct {
 	// map[userID]connectionID
 	userID2ConnectionID map[string]string
 
+	// connectionID2UserID stores the userID of every authenticated connection.
+	// A user might have multiple connections, while userID2ConnectionID only
+	// maps the latest one.
+	// map[connID]userID
+	connectionID2UserID map[string]string
+
+	// connections stores the subscribed connections by their ID.
+	// map[connID]connection
+	connections map[string]common.ConnectionWrapper
+
 	collector collector
 
 	sync.RWMutex
@@ -52,9 +64,23 @@ func NewCache(col collector) *Cache {
 		connectionID2Channels: make(map[string]map[channel.Channel]struct{}),
 		channel2Connections:   make(map[channel.Channel]map[string]common.ConnectionWrapper),
 		userID2ConnectionID:   make(map[string]string),
+		connectionID2UserID:   make(map[string]string),
+		connections:           make(map[string]common.ConnectionWrapper),
 	}
 }
 
+// Add stores the input connection without any subscription. It makes the
+// connection available to Connection and ConnectionsByUserID methods.
+//
+// This function is thread-safe and multiple goroutines can add connections
+// to the in-memory storage.
+func (c *Cache) Add(_ context.Context, conn common.ConnectionWrapper) {
+	c.Lock()
+	defer c.Unlock()
+
+	c.connections[conn.ID()] = conn
+}
+
 // Subscribe stores the subscription for the input connection and list
 // of the channels into the internal maps.
 //
@@ -70,11 +96,19 @@ func (c *Cache) Subscribe(_ context.Context, conn common.ConnectionWrapper, chan
 		c.connectionID2Channels[conn.ID()] = make(map[channel.Channel]struct{})
 	}
 
-	// check if connection has userID, add it to the map.
+	c.connections[conn.ID()] = conn
+
+	// check if connection has userID, add it to the map. The private
+	// connections metric is increased only for a new userID mapping, since
+	// the same connection might subscribe multiple times.
 	userID := conn.UserID()
 	if userID != nil {
+		if _, exists := c.userID2ConnectionID[*userID]; !exists {
+			c.collector.PrivateConnectionsInc()
+		}
+
 		c.userID2ConnectionID[*userID] = conn.ID()
-		c.collector.PrivateConnectionsInc()
+		c.connectionID2UserID[conn.ID()] = *userID
 	}
 
 	// iterate over the input channel and store the subscription.
@@ -83,6 +117,10 @@ func (c *Cache) Subscribe(_ context.Context, conn common.ConnectionWrapper, chan
 			c.channel2Connections[ch] = make(map[string]common.ConnectionWrapper)
 		}
 
+		if _, exists := c.connectionID2Channels[conn.ID()][ch]; !exists {
+			c.collector.SubscriptionsInc(ch.String())
+		}
+
 		c.connectionID2Channels[conn.ID()][ch] = struct{}{}
 		c.channel2Connections[ch][conn.ID()] = conn
 	}
@@ -92,6 +130,27 @@ func (c *Cache) Subscribe(_ context.Context, conn common.ConnectionWrapper, chan
 	c.collector.PrivateConnections(float64(len(c.userID2ConnectionID)))
 }
 
+// Replace replaces the stored connection that has the same ID as the input
+// connection, including its subscriptions. It does nothing if the connection
+// doesn't exist. The main usage of this function is storing the connection
+// instead of its SnapshotGate after the gate is released.
+//
+// This function is thread-safe and multiple goroutines can replace
+// connections concurrently.
+func (c *Cache) Replace(_ context.Context, conn common.ConnectionWrapper) {
+	c.Lock()
+	defer c.Unlock()
+
+	if _, exists := c.connections[conn.ID()]; !exists {
+		return
+	}
+
+	c.connections[conn.ID()] = conn
+	for ch := range c.connectionID2Channels[conn.ID()] {
+		c.channel2Connections[ch][conn.ID()] = conn
+	}
+}
+
 // Unsubscribe removes the input channels subscription from the internal maps.
 //
 // This function is thread-safe and multiple goroutines can unsubscribe
@@ -101,8 +160,7 @@ func (c *Cache) Unsubscribe(_ context.Context, connID string, channels ...channe
 	defer c.Unlock()
 
 	for _, ch := range channels {
-		delete(c.connectionID2Channels[connID], ch)
-		delete(c.channel2Connections[ch], connID)
+		c.unsubscribe(connID, ch)
 	}
 
 	c.collector.SubscribedChannels(float64(len(c.channel2Connections)))
@@ -126,14 +184,62 @@ func (c *Cache) UnsubscribeUserID(_ context.Context, connID string, userID strin
 		c.collector.PrivateConnectionsDec()
 	}
 
-	delete(c.connectionID2Channels[connID], ch)
-	delete(c.channel2Connections[ch], connID)
+	delete(c.connectionID2UserID, connID)
+	c.unsubscribe(connID, ch)
+
+	c.collector.SubscribedChannels(float64(len(c.channel2Connections)))
+	c.collector.OpenConnections(float64(len(c.connectionID2Channels)))
+	c.collector.PrivateConnections(float64(len(c.userID2ConnectionID)))
+}
+
+// UnsubscribePrivateChannels removes all the private channel subscriptions of
+// the input connection, and removes the userID and connID mapping.
+//
+// The main usage of this function is when the auth token of the connection is
+// expired and can't be re-authenticated. The public channel subscriptions are
+// not changed.
+func (c *Cache) UnsubscribePrivateChannels(_ context.Context, connID string, userID string) {
+	c.Lock()
+	defer c.Unlock()
+
+	if mappedConnID, exists := c.userID2ConnectionID[userID]; exists && mappedConnID == connID {
+		delete(c.userID2ConnectionID, userID)
+		c.collector.PrivateConnectionsDec()
+	}
+
+	delete(c.connectionID2UserID, connID)
+
+	for ch := range c.connectionID2Channels[connID] {
+		if !ch.IsSupportedPrivateChannel() {
+			continue
+		}
+
+		c.unsubscribe(connID, ch)
+	}
 
 	c.collector.SubscribedChannels(float64(len(c.channel2Connections)))
 	c.collector.OpenConnections(float64(len(c.connectionID2Channels)))
 	c.collector.PrivateConnections(float64(len(c.userID2ConnectionID)))
 }
 
+// RemoveChannel removes all the subscriptions of the input channel. The main
+// usage of this function is when the channel is unregistered.
+//
+// This function is thread-safe and multiple goroutines can remove channels
+// concurrently.
+func (c *Cache) RemoveChannel(_ context.Context, ch channel.Channel) {
+	c.Lock()
+	defer c.Unlock()
+
+	for connID := range c.channel2Connections[ch] {
+		c.unsubscribe(connID, ch)
+	}
+
+	delete(c.channel2Connections, ch)
+
+	c.collector.SubscribedChannels(float64(len(c.channel2Connections)))
+}
+
 // Remove removes all subscriptions of the input connection id. Removing
 // all subscription means removing connection from the storage.
 //
@@ -144,10 +250,12 @@ func (c *Cache) Remove(_ context.Context, connID string, userID *string) {
 	defer c.Unlock()
 
 	for ch := range c.connectionID2Channels[connID] {
-		delete(c.channel2Connections[ch], connID)
+		c.unsubscribe(connID, ch)
 	}
 
 	delete(c.connectionID2Channels, connID)
+	delete(c.connectionID2UserID, connID)
+	delete(c.connections, connID)
 
 	if userID != nil {
 		_, exists := c.userID2ConnectionID[*userID]
@@ -162,6 +270,18 @@ func (c *Cache) Remove(_ context.Context, connID string, userID *string) {
 	c.collector.PrivateConnections(float64(len(c.userID2ConnectionID)))
 }
 
+// unsubscribe removes the subscription of the input connection and channel.
+// The caller must hold the lock.
+func (c *Cache) unsubscribe(connID string, ch channel.Channel) {
+	if _, exists := c.connectionID2Channels[connID][ch]; !exists {
+		return
+	}
+
+	delete(c.connectionID2Channels[connID], ch)
+	delete(c.channel2Connections[ch], connID)
+	c.collector.UnsubscriptionsInc(ch.String())
+}
+
 // Connections returns a list of connections that already subscribed
 // to the input channel.
 //
@@ -179,6 +299,32 @@ func (c *Cache) Connections(_ context.Context, ch channel.Channel) []common.Conn
 	return connections
 }
 
+// ConnectionsByChannels returns the connections that already subscribed to
+// the input channels per channel. It takes a single snapshot of the storage
+// for all the channels.
+//
+// This function is thread-safe and multiple goroutines can get the
+// list of subscribed connection concurrently.
+func (c *Cache) ConnectionsByChannels(_ context.Context, channels []channel.Channel) map[channel.Channel][]common.ConnectionWrapper {
+	c.RLock()
+	defer c.RUnlock()
+
+	out := make(map[channel.Channel][]common.ConnectionWrapper, len(channels))
+	for _, ch := range channels {
+		if _, exists := out[ch]; exists {
+			continue
+		}
+
+		connections := make([]common.ConnectionWrapper, 0, len(c.channel2Connections[ch]))
+		for _, conn := range c.channel2Connections[ch] {
+			connections = append(connections, conn)
+		}
+		out[ch] = connections
+	}
+
+	return out
+}
+
 // ConnectionByUserID return the connection if there is a connection
 // for the input userID, and the that connection already subscribed
 // to the input channel. Otherwise, returns nil.
@@ -198,3 +344,122 @@ func (c *Cache) ConnectionByUserID(_ context.Context, ch channel.Channel, userID
 
 	return connID2Connections[connID]
 }
+
+// Channels returns a list of channels that the input connection already
+// subscribed to them.
+//
+// This function is thread-safe and multiple goroutines can get the
+// list of subscribed channels concurrently.
+func (c *Cache) Channels(_ context.Context, connID string) []channel.Channel {
+	c.RLock()
+	defer c.RUnlock()
+
+	channels := make([]channel.Channel, 0, len(c.connectionID2Channels[connID]))
+	for ch := range c.connectionID2Channels[connID] {
+		channels = append(channels, ch)
+	}
+
+	return channels
+}
+
+// Connection returns the connection with the input connID. It returns nil if
+// the connection doesn't exist.
+func (c *Cache) Connection(_ context.Context, connID string) common.ConnectionWrapper {
+	c.RLock()
+	defer c.RUnlock()
+
+	conn, exists := c.connections[connID]
+	if !exists {
+		return nil
+	}
+
+	return conn
+}
+
+// AllConnections returns all the stored connections.
+//
+// This function is thread-safe and multiple goroutines can get the list of
+// connections concurrently.
+func (c *Cache) AllConnections(_ context.Context) []common.ConnectionWrapper {
+	c.RLock()
+	defer c.RUnlock()
+
+	connections := make([]common.ConnectionWrapper, 0, len(c.connections))
+	for _, conn := range c.connections {
+		connections = append(connections, conn)
+	}
+
+	return connections
+}
+
+// ConnectionsByUserID returns all the connections that are authenticated
+// with the input userID.
+//
+// This function is thread-safe and multiple goroutines can get the list of
+// user connections concurrently.
+func (c *Cache) ConnectionsByUserID(_ context.Context, userID string) []common.ConnectionWrapper {
+	c.RLock()
+	defer c.RUnlock()
+
+	var connections []common.ConnectionWrapper
+	for _, conn := range c.connections {
+		if connUserID := conn.UserID(); connUserID != nil && *connUserID == userID {
+			connections = append(connections, conn)
+		}
+	}
+
+	return connections
+}
+
+// ConnectionInfo returns the metadata of the connection with the input connID
+// and the channels that it subscribed. It returns nil if the connection doesn't
+// exist.
+func (c *Cache) ConnectionInfo(ctx context.Context, connID string) *common.ConnectionInfo {
+	conn := c.Connection(ctx, connID)
+	if conn == nil {
+		return nil
+	}
+
+	info := conn.Info()
+	info.Channels = c.Channels(ctx, connID)
+
+	return &info
+}
+
+// SubscriberCounts returns the number of subscribed connections per channel.
+// The channels without any subscriber are not included.
+//
+// This function is thread-safe and multiple goroutines can get the subscriber
+// counts concurrently.
+func (c *Cache) SubscriberCounts(_ context.Context) map[channel.Channel]int {
+	c.RLock()
+	defer c.RUnlock()
+
+	counts := make(map[channel.Channel]int, len(c.channel2Connections))
+	for ch, connections := range c.channel2Connections {
+		if len(connections) > 0 {
+			counts[ch] = len(connections)
+		}
+	}
+
+	return counts
+}
+
+// PrivateConnections returns a list of connections that are mapped to a userID,
+// including all the connections of the users with multiple connections.
+//
+// This function is thread-safe and multiple goroutines can get the
+// list of private connections concurrently.
+func (c *Cache) PrivateConnections(_ context.Context) []common.ConnectionWrapper {
+	c.RLock()
+	defer c.RUnlock()
+
+	connections := make([]common.ConnectionWrapper, 0, len(c.connectionID2UserID))
+	for connID := range c.connectionID2UserID {
+		if conn, exists := c.connections[connID]; exists {
+			connections = append(connections, conn)
+		}
+	}
+
+	return connections
+}
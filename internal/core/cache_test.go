@@ -77,6 +77,19 @@ func TestCache_Subscribe(t *testing.T) {
 		assert.Equal(t, expectedConn.ID(), cache.userID2ConnectionID[userID])
 		assert.Equal(t, int32(1), mockCollector.PrivateConnectionsGauge)
 	})
+
+	t.Run("subscribe private channels multiple times", func(t *testing.T) {
+		mockCollector := mock.NewCollector()
+		cache := NewCache(mockCollector)
+		userID := uuid.NewV4().String()
+		conn := mock.NewConnection(testConnID, &userID, authNoopFunc)
+		cache.Subscribe(ctx, conn, testChannels[2])
+		cache.Subscribe(ctx, conn, testChannels[3])
+		assert.Equal(t, int32(1), mockCollector.PrivateConnectionsGauge)
+
+		cache.Remove(ctx, conn.ID(), conn.UserID())
+		assert.Equal(t, int32(0), mockCollector.PrivateConnectionsGauge)
+	})
 }
 
 // TestCache_Unsubscribe unsubscribes from a connection from multiple
@@ -235,14 +248,32 @@ func TestCache_Connections(t *testing.T) {
 	}
 }
 
+func TestCache_ConnectionsByChannels(t *testing.T) {
+	ctx := context.Background()
+	conn1 := mock.NewConnection(testConnectionIDs[0], nil, authNoopFunc)
+	conn2 := mock.NewConnection(testConnectionIDs[1], nil, authNoopFunc)
+
+	cache := NewCache(mock.NewCollector())
+	cache.Subscribe(ctx, conn1, "alerts", "feed")
+	cache.Subscribe(ctx, conn2, "feed")
+
+	connections := cache.ConnectionsByChannels(ctx, []channel.Channel{"alerts", "feed", "alerts", "unknown"})
+	require.Len(t, connections, 3)
+	assert.Equal(t, []common.ConnectionWrapper{conn1}, connections["alerts"])
+	assert.ElementsMatch(t, []common.ConnectionWrapper{conn1, conn2}, connections["feed"])
+	assert.Empty(t, connections["unknown"])
+}
+
 func initCache(coll collector, connections ...common.ConnectionWrapper) *Cache {
 	cache := NewCache(coll)
 	for i := range connections {
 		cache.connectionID2Channels[connections[i].ID()] = make(map[channel.Channel]struct{})
+		cache.connections[connections[i].ID()] = connections[i]
 
 		userID := connections[i].UserID()
 		if userID != nil {
 			cache.userID2ConnectionID[*userID] = connections[i].ID()
+			cache.connectionID2UserID[connections[i].ID()] = *userID
 			coll.PrivateConnectionsInc()
 		}
 
@@ -303,3 +334,171 @@ func TestCache_ConnectionByUserID(t *testing.T) {
 		assert.Nil(t, actualConn)
 	})
 }
+
+// TestCache_Channels returns the list of subscribed channels per connection
+// concurrently.
+func TestCache_Channels(t *testing.T) {
+	ctx := context.Background()
+	var connections []common.ConnectionWrapper
+	for _, id := range testConnectionIDs {
+		connections = append(connections, mock.NewConnection(id, nil, authNoopFunc))
+	}
+
+	cache := initCache(mock.NewCollector(), connections...)
+
+	for _, conn := range connections {
+		connID := conn.ID()
+		t.Run("parallel get channels", func(t *testing.T) {
+			t.Parallel()
+			assert.ElementsMatch(t, testChannels, cache.Channels(ctx, connID))
+		})
+	}
+
+	t.Run("connection doesn't exist", func(t *testing.T) {
+		t.Parallel()
+		assert.Empty(t, cache.Channels(ctx, uuid.NewV4().String()))
+	})
+}
+
+// TestCache_UnsubscribePrivateChannels removes the private channels of a
+// connection and keeps the public ones.
+func TestCache_UnsubscribePrivateChannels(t *testing.T) {
+	ctx := context.Background()
+	privateChannel := channel.RegisterPrivateChannel("cache-private-channel")
+	publicChannel := channel.RegisterPublicChannel("cache-public-channel")
+	userID := uuid.NewV4().String()
+
+	mockCollector := mock.NewCollector()
+	cache := NewCache(mockCollector)
+	conn := mock.NewConnection(testConnID, &userID, authNoopFunc)
+	cache.Subscribe(ctx, conn, privateChannel, publicChannel)
+	require.Equal(t, int32(1), mockCollector.PrivateConnectionsGauge)
+
+	cache.UnsubscribePrivateChannels(ctx, conn.ID(), userID)
+
+	assert.Nil(t, cache.ConnectionByUserID(ctx, privateChannel, userID))
+	assert.Empty(t, cache.Connections(ctx, privateChannel))
+	assert.Equal(t, []channel.Channel{publicChannel}, cache.Channels(ctx, conn.ID()))
+	assert.Equal(t, int32(0), mockCollector.PrivateConnectionsGauge)
+	assert.Equal(t, 0, int(mockCollector.PrivateConnectionsCount.Value()))
+}
+
+// TestCache_PrivateConnections returns the connections that are mapped to a userID.
+func TestCache_PrivateConnections(t *testing.T) {
+	ctx := context.Background()
+	userID := uuid.NewV4().String()
+	privateConn := mock.NewConnection(testConnectionIDs[0], &userID, authNoopFunc)
+	publicConn := mock.NewConnection(testConnectionIDs[1], nil, authNoopFunc)
+
+	cache := initCache(mock.NewCollector(), privateConn, publicConn)
+
+	assert.Equal(t, []common.ConnectionWrapper{privateConn}, cache.PrivateConnections(ctx))
+}
+
+// TestCache_Add stores a connection without subscriptions.
+func TestCache_Add(t *testing.T) {
+	ctx := context.Background()
+	userID := uuid.NewV4().String()
+	conn := mock.NewConnection(testConnID, &userID, authNoopFunc)
+
+	cache := NewCache(mock.NewCollector())
+	cache.Add(ctx, conn)
+
+	assert.Equal(t, conn, cache.Connection(ctx, conn.ID()))
+	assert.Equal(t, []common.ConnectionWrapper{conn}, cache.ConnectionsByUserID(ctx, userID))
+	assert.Empty(t, cache.Channels(ctx, conn.ID()))
+
+	cache.Remove(ctx, conn.ID(), conn.UserID())
+	assert.Nil(t, cache.Connection(ctx, conn.ID()))
+}
+
+// TestCache_ConnectionsByUserID returns all the connections of a user.
+func TestCache_ConnectionsByUserID(t *testing.T) {
+	ctx := context.Background()
+	userID := uuid.NewV4().String()
+	otherUserID := uuid.NewV4().String()
+
+	cache := initCache(
+		mock.NewCollector(),
+		mock.NewConnection(testConnectionIDs[0], &userID, authNoopFunc),
+		mock.NewConnection(testConnectionIDs[1], &userID, authNoopFunc),
+		mock.NewConnection(testConnectionIDs[2], &otherUserID, authNoopFunc),
+		mock.NewConnection(testConnectionIDs[3], nil, authNoopFunc),
+	)
+
+	var connIDs []string
+	for _, conn := range cache.ConnectionsByUserID(ctx, userID) {
+		connIDs = append(connIDs, conn.ID())
+	}
+
+	assert.ElementsMatch(t, testConnectionIDs[:2], connIDs)
+	assert.Empty(t, cache.ConnectionsByUserID(ctx, "unknown-user-id"))
+}
+
+// TestCache_ConnectionInfo returns the connection metadata with its channels.
+func TestCache_ConnectionInfo(t *testing.T) {
+	ctx := context.Background()
+	userID := uuid.NewV4().String()
+	conn := mock.NewConnection(testConnID, &userID, authNoopFunc)
+
+	cache := NewCache(mock.NewCollector())
+	cache.Subscribe(ctx, conn, testChannels[1])
+
+	info := cache.ConnectionInfo(ctx, conn.ID())
+	require.NotNil(t, info)
+	assert.Equal(t, conn.ID(), info.ID)
+	assert.Equal(t, userID, info.UserID)
+	assert.Equal(t, []channel.Channel{testChannels[1]}, info.Channels)
+
+	assert.Nil(t, cache.ConnectionInfo(ctx, "unknown-conn-id"))
+}
+
+// TestCache_SubscriberCounts returns the number of subscribers per channel.
+func TestCache_SubscriberCounts(t *testing.T) {
+	ctx := context.Background()
+	cache := NewCache(mock.NewCollector())
+	conn1 := mock.NewConnection(testConnectionIDs[0], nil, authNoopFunc)
+	conn2 := mock.NewConnection(testConnectionIDs[1], nil, authNoopFunc)
+	cache.Subscribe(ctx, conn1, testChannels[0], testChannels[1])
+	cache.Subscribe(ctx, conn2, testChannels[1], testChannels[2])
+	cache.Unsubscribe(ctx, conn2.ID(), testChannels[2])
+
+	assert.Equal(t, map[channel.Channel]int{
+		testChannels[0]: 1,
+		testChannels[1]: 2,
+	}, cache.SubscriberCounts(ctx))
+}
+
+// TestCache_RemoveChannel removes all the subscriptions of a channel.
+func TestCache_RemoveChannel(t *testing.T) {
+	ctx := context.Background()
+	conn1 := mock.NewConnection(testConnectionIDs[0], nil, authNoopFunc)
+	conn2 := mock.NewConnection(testConnectionIDs[1], nil, authNoopFunc)
+	cache := initCache(mock.NewCollector(), conn1, conn2)
+
+	cache.RemoveChannel(ctx, testChannels[0])
+
+	assert.Empty(t, cache.Connections(ctx, testChannels[0]))
+	assert.NotContains(t, cache.Channels(ctx, conn1.ID()), testChannels[0])
+	assert.NotContains(t, cache.Channels(ctx, conn2.ID()), testChannels[0])
+	assert.Equal(t, 2, len(cache.Connections(ctx, testChannels[1])))
+	assert.Equal(t, 2, len(cache.AllConnections(ctx)))
+}
+
+// TestCache_SubscriptionMetrics counts the added and removed subscriptions.
+func TestCache_SubscriptionMetrics(t *testing.T) {
+	ctx := context.Background()
+	mockCollector := mock.NewCollector()
+	cache := NewCache(mockCollector)
+	conn := mock.NewConnection(testConnID, nil, authNoopFunc)
+
+	cache.Subscribe(ctx, conn, testChannels[0], testChannels[1])
+	cache.Subscribe(ctx, conn, testChannels[1], testChannels[2])
+	assert.Equal(t, int32(3), mockCollector.SubscriptionsCount)
+
+	cache.Unsubscribe(ctx, conn.ID(), testChannels[0], testChannels[3])
+	assert.Equal(t, int32(1), mockCollector.UnsubscriptionsCount)
+
+	cache.Remove(ctx, conn.ID(), nil)
+	assert.Equal(t, int32(3), mockCollector.UnsubscriptionsCount)
+}
@@ -8,11 +8,17 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 
 	"github.com/hmdsefi/channelize/internal/channel"
 	"github.com/hmdsefi/channelize/internal/common"
 	"github.com/hmdsefi/channelize/internal/common/errorx"
 	"github.com/hmdsefi/channelize/log"
+	"github.com/hmdsefi/channelize/metrics"
 )
 
 // store stores connections per channel.
@@ -26,21 +32,224 @@ type store interface {
 
 	// ConnectionByUserID returns a connection that mapped with input userID and channel.
 	ConnectionByUserID(ctx context.Context, ch channel.Channel, userID string) common.ConnectionWrapper
+
+	// AllConnections returns all the available connections.
+	AllConnections(ctx context.Context) []common.ConnectionWrapper
+
+	// Connection returns the connection with the input ID. It returns nil if
+	// the connection doesn't exist.
+	Connection(ctx context.Context, connID string) common.ConnectionWrapper
+
+	// ConnectionsByChannels returns the available connections of the input
+	// channels per channel.
+	ConnectionsByChannels(ctx context.Context, channels []channel.Channel) map[channel.Channel][]common.ConnectionWrapper
+}
+
+// dispatchCollector is an interface for collecting the message delivery metrics.
+type dispatchCollector interface {
+	MessagesPublishedInc(ch string)
+	MessagesDeliveredInc(ch string)
+	MessagesDroppedInc(ch string, reason string)
+	AuthFailuresInc()
+
+	// MarshalDurationObserve observes the time of serializing an outbound
+	// message of the input channel.
+	MarshalDurationObserve(ch string, d time.Duration)
+
+	// FanoutDurationObserve observes the time of sending a published message
+	// of the input channel to all its connections.
+	FanoutDurationObserve(ch string, d time.Duration)
+
+	fanoutCollector
+}
+
+// span names of the dispatch methods.
+const (
+	spanNamePublish        = "channelize.publish"
+	spanNamePublishPrivate = "channelize.publish_private"
+	spanNameBroadcast      = "channelize.broadcast"
+	spanNameClientPublish  = "channelize.client_publish"
+	spanNameConnection     = "channelize.publish_connection"
+	spanNameTag            = "channelize.publish_tag"
+	spanNameBatch          = "channelize.publish_batch"
+)
+
+// DispatchConfig represents the Dispatch configuration.
+type DispatchConfig struct {
+	// tracer starts a span per published message. The default value is the
+	// noop tracer.
+	tracer trace.Tracer
+
+	// injectTraceID adds the trace ID of the publisher span to the outbound
+	// messages metadata if it is true.
+	injectTraceID bool
+
+	// batchFrames sends the messages of a batch publish that belong to a
+	// connection in a single frame if it is true.
+	batchFrames bool
+
+	// fanoutPool sends the published messages by using a pool of workers
+	// instead of the publisher goroutine if it is true.
+	fanoutPool bool
+
+	// fanoutOptions represents the fan-out pool configuration.
+	fanoutOptions []FanoutOption
+
+	// asyncQueueSize represents the maximum number of the messages that wait
+	// to be sent by SendPublicMessageAsync if the fan-out pool is disabled.
+	asyncQueueSize int
+}
+
+type DispatchOption func(*DispatchConfig)
+
+// WithTracer sets the tracer of the published messages.
+func WithTracer(tracer trace.Tracer) DispatchOption {
+	return func(config *DispatchConfig) {
+		if config == nil || tracer == nil {
+			return
+		}
+
+		config.tracer = tracer
+	}
+}
+
+// WithTraceIDInjection adds the trace ID of the publisher span to the
+// outbound messages metadata.
+func WithTraceIDInjection(enabled bool) DispatchOption {
+	return func(config *DispatchConfig) {
+		if config == nil {
+			return
+		}
+
+		config.injectTraceID = enabled
+	}
+}
+
+// WithBatchFrames sends the messages of a batch publish that belong to the
+// same connection in a single frame of the batch channel.
+func WithBatchFrames(enabled bool) DispatchOption {
+	return func(config *DispatchConfig) {
+		if config == nil {
+			return
+		}
+
+		config.batchFrames = enabled
+	}
+}
+
+// WithFanoutPool sends the published messages to the connections by using a
+// bounded pool of workers. The publisher only marshals the message and queues
+// it for the workers.
+func WithFanoutPool(options ...FanoutOption) DispatchOption {
+	return func(config *DispatchConfig) {
+		if config == nil {
+			return
+		}
+
+		config.fanoutPool = true
+		config.fanoutOptions = options
+	}
+}
+
+// WithAsyncQueueSize sets the maximum number of the messages that wait to be
+// sent by SendPublicMessageAsync if the fan-out pool is disabled. It ignores
+// the values less than one.
+func WithAsyncQueueSize(size int) DispatchOption {
+	return func(config *DispatchConfig) {
+		if config == nil || size < 1 {
+			return
+		}
+
+		config.asyncQueueSize = size
+	}
 }
 
 // Dispatch is a mechanism to send the public and private messages to the
 // available connection per channel. It uses a storage to get the connections.
 type Dispatch struct {
-	store  store
-	logger log.Logger
+	store     store
+	collector dispatchCollector
+	logger    log.Logger
+	config    DispatchConfig
+
+	// pool sends the published messages if the fan-out pool is enabled.
+	pool *fanoutPool
+
+	// async sends the async messages in the publish order if the fan-out
+	// pool is disabled.
+	async *asyncQueue
 }
 
 // NewDispatch creates a new instance of Dispatch struct.
-func NewDispatch(store store, logger log.Logger) *Dispatch {
-	return &Dispatch{
-		store:  store,
-		logger: logger,
+func NewDispatch(store store, collector dispatchCollector, logger log.Logger, options ...DispatchOption) *Dispatch {
+	config := DispatchConfig{
+		tracer:         trace.NewNoopTracerProvider().Tracer(common.TracerName),
+		asyncQueueSize: defaultAsyncQueueSize,
+	}
+	for _, option := range options {
+		option(&config)
+	}
+
+	d := &Dispatch{
+		store:     store,
+		collector: collector,
+		logger:    logger,
+		config:    config,
 	}
+
+	if config.fanoutPool {
+		d.pool = newFanoutPool(d, collector, logger, config.fanoutOptions...)
+	} else {
+		d.async = newAsyncQueue(config.asyncQueueSize, d.sendAsyncTask)
+	}
+
+	return d
+}
+
+// Close stops the fan-out workers, or the async worker if the fan-out pool
+// is disabled, after they send the queued messages. The next messages are
+// sent by the publisher goroutine.
+func (d *Dispatch) Close() {
+	if d.pool != nil {
+		d.pool.close()
+	}
+
+	if d.async != nil {
+		d.async.close()
+	}
+}
+
+// DeliveryFailure represents a connection that a message couldn't be queued
+// for, and the reason.
+type DeliveryFailure struct {
+	ConnectionID string
+	Err          error
+}
+
+// DeliveryResult represents the result of sending a message to the
+// subscribers of a channel.
+type DeliveryResult struct {
+	// Subscribers is the number of connections that the message has been
+	// sent to.
+	Subscribers int
+
+	// Delivered is the number of connections that the message has been
+	// queued for.
+	Delivered int
+
+	// Dropped is the number of connections that the message couldn't be
+	// queued for, e.g. because of the full outbound buffer.
+	Dropped int
+
+	// Failures contains the connections that the message has been dropped
+	// for, and the errors.
+	Failures []DeliveryFailure
+}
+
+// addFailure records a dropped message of the input connection.
+func (r *DeliveryResult) addFailure(connID string, err error) {
+	r.Dropped++
+	r.Failures = append(r.Failures, DeliveryFailure{ConnectionID: connID, Err: err})
 }
 
 // SendPublicMessage sends the input message to the available connections of
@@ -48,31 +257,304 @@ func NewDispatch(store store, logger log.Logger) *Dispatch {
 //
 // This process is thread safe if the store.Connections be thread safe.
 //
+// If the fan-out pool is enabled, it returns after queueing the message for
+// the fan-out workers.
+//
 // SendPublicMessage might return json marshal error.
 func (d *Dispatch) SendPublicMessage(ctx context.Context, ch channel.Channel, message interface{}) error {
+	return d.sendPublicMessage(ctx, ch, message, nil)
+}
+
+// SendPublicMessageWithResult sends the input message to the available
+// connections of input channel, and returns the delivery result. The result
+// is nil if it returns json marshal error.
+func (d *Dispatch) SendPublicMessageWithResult(
+	ctx context.Context,
+	ch channel.Channel,
+	message interface{},
+) (*DeliveryResult, error) {
+	defer d.observeFanout(ch, time.Now())
+
+	ctx, span := d.startSpan(ctx, spanNamePublish, ch)
+	result, err := d.publish(ctx, d.store.Connections(ctx, ch), ch, message)
+	endSpan(span, err)
+
+	return result, err
+}
+
+// SendPublicMessageAsync sends the input message to the available connections
+// of input channel in another goroutine, and calls the input callback with
+// the delivery result, e.g. to apply backpressure to the upstream consumer.
+// The callback can be nil.
+//
+// If the fan-out pool is disabled, the messages are queued and a single
+// worker sends them in the publish order, and calls the callback, so the
+// callback shouldn't block. If the queue is full, the caller blocks until the
+// worker takes a message or the input context is done.
+//
+// If the fan-out pool is enabled, the message is marshaled by the caller
+// goroutine and the callback is called by the fan-out worker that sends the
+// last partition, so the callback shouldn't block. Each connection receives
+// the messages in the publish order.
+func (d *Dispatch) SendPublicMessageAsync(
+	ctx context.Context,
+	ch channel.Channel,
+	message interface{},
+	callback func(*DeliveryResult, error),
+) {
+	if d.pool == nil {
+		task := &asyncTask{ctx: ctx, ch: ch, message: message, callback: callback}
+
+		queued, err := d.async.submit(task)
+		switch {
+		case err != nil:
+			if callback != nil {
+				callback(nil, err)
+			}
+		case !queued:
+			d.sendAsyncTask(task)
+		}
+
+		return
+	}
+
+	var done func(*DeliveryResult)
+	if callback != nil {
+		done = func(result *DeliveryResult) { callback(result, nil) }
+	}
+
+	if err := d.sendPublicMessage(ctx, ch, message, done); err != nil && callback != nil {
+		callback(nil, err)
+	}
+}
+
+// sendAsyncTask sends the message of the input async task, and calls its
+// callback with the delivery result.
+func (d *Dispatch) sendAsyncTask(task *asyncTask) {
+	result, err := d.SendPublicMessageWithResult(task.ctx, task.ch, task.message)
+	if task.callback != nil {
+		task.callback(result, err)
+	}
+}
+
+// sendPublicMessage sends the input message to the available connections of
+// input channel without waiting for the fan-out workers. The span ends and
+// the input done function is called after the message is sent to all the
+// connections. The done function can be nil.
+func (d *Dispatch) sendPublicMessage(
+	ctx context.Context,
+	ch channel.Channel,
+	message interface{},
+	done func(*DeliveryResult),
+) error {
+	startedAt := time.Now()
+
+	ctx, span := d.startSpan(ctx, spanNamePublish, ch)
+	err := d.publishAsync(ctx, d.store.Connections(ctx, ch), ch, message, func(result *DeliveryResult) {
+		d.observeFanout(ch, startedAt)
+		endSpan(span, nil)
+
+		if done != nil {
+			done(result)
+		}
+	})
+	if err != nil {
+		d.observeFanout(ch, startedAt)
+		endSpan(span, err)
+	}
+
+	return err
+}
+
+// SendClientMessage sends the message that a client has published to the
+// available connections of the input channel. If excludeConnID is not empty,
+// the message is not sent to that connection, e.g. to suppress the echo of
+// the publisher.
+//
+// SendClientMessage might return json marshal error.
+func (d *Dispatch) SendClientMessage(ctx context.Context, ch channel.Channel, message interface{}, excludeConnID string) error {
+	defer d.observeFanout(ch, time.Now())
+
+	ctx, span := d.startSpan(ctx, spanNameClientPublish, ch)
+
 	connections := d.store.Connections(ctx, ch)
+	if excludeConnID != "" {
+		span.SetAttributes(attribute.String(common.TraceAttrConnectionID, excludeConnID))
+
+		filtered := make([]common.ConnectionWrapper, 0, len(connections))
+		for _, conn := range connections {
+			if conn.ID() != excludeConnID {
+				filtered = append(filtered, conn)
+			}
+		}
+		connections = filtered
+	}
+
+	_, err := d.publish(ctx, connections, ch, message)
+	endSpan(span, err)
+
+	return err
+}
+
+// SendToTag sends the input message to the connections of the input channel
+// that have the input tag. The message is marshaled once for all the tagged
+// connections. If the channel is private, the tokens of the connections are
+// validated like SendPrivateMessage, and the unauthenticated connections are
+// skipped.
+//
+// SendToTag might return json marshal error.
+func (d *Dispatch) SendToTag(ctx context.Context, ch channel.Channel, tag string, message interface{}) error {
+	defer d.observeFanout(ch, time.Now())
+
+	ctx, span := d.startSpan(ctx, spanNameTag, ch)
+	span.SetAttributes(attribute.String(common.TraceAttrTag, tag))
+
+	private := ch.IsSupportedPrivateChannel()
+
+	var tagged []common.ConnectionWrapper
+	for _, conn := range d.store.Connections(ctx, ch) {
+		if !conn.HasTag(tag) {
+			continue
+		}
+
+		if private {
+			if err := d.authenticate(ctx, conn, ch); err != nil {
+				if userID := conn.UserID(); userID != nil && isTokenError(err) {
+					d.store.UnsubscribeUserID(ctx, conn.ID(), *userID, ch)
+				}
+				continue
+			}
+		}
+
+		tagged = append(tagged, conn)
+	}
+
+	_, err := d.publish(ctx, tagged, ch, message)
+	endSpan(span, err)
+
+	return err
+}
+
+// Broadcast sends the input message to all the available connections in the
+// announcement channel, regardless of their subscriptions.
+//
+// Broadcast might return json marshal error.
+func (d *Dispatch) Broadcast(ctx context.Context, message interface{}) error {
+	defer d.observeFanout(channel.AnnouncementChannel, time.Now())
+
+	ctx, span := d.startSpan(ctx, spanNameBroadcast, channel.AnnouncementChannel)
+	_, err := d.publish(ctx, d.store.AllConnections(ctx), channel.AnnouncementChannel, message)
+	endSpan(span, err)
+
+	return err
+}
+
+// publish marshals the input message once and sends it to the input connections.
+// It records the fan-out size and the number of delivered and dropped messages
+// in the context span, and returns them as the delivery result. If the fan-out
+// pool is enabled, it waits until the workers send the message.
+func (d *Dispatch) publish(
+	ctx context.Context,
+	connections []common.ConnectionWrapper,
+	ch channel.Channel,
+	message interface{},
+) (*DeliveryResult, error) {
+	done := make(chan *DeliveryResult, 1)
+	err := d.publishAsync(ctx, connections, ch, message, func(result *DeliveryResult) {
+		done <- result
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return <-done, nil
+}
+
+// publishAsync marshals the input message once and sends it to the input
+// connections. If the fan-out pool is enabled, the fan-out workers send the
+// message. Otherwise, it is sent by the caller goroutine. The input done
+// function is called with the delivery result after the message is sent to
+// all the connections. It isn't called if publishAsync returns error.
+func (d *Dispatch) publishAsync(
+	ctx context.Context,
+	connections []common.ConnectionWrapper,
+	ch channel.Channel,
+	message interface{},
+	done func(*DeliveryResult),
+) error {
+	d.collector.MessagesPublishedInc(ch.String())
+
+	span := trace.SpanFromContext(ctx)
+	span.SetAttributes(attribute.Int(common.TraceAttrFanoutSize, len(connections)))
 
 	if len(connections) == 0 {
+		done(&DeliveryResult{})
 		return nil
 	}
 
-	msgOut := newMessageOut(ch, message)
-	msgOutBytes, err := json.Marshal(msgOut)
+	msgOutBytes, err := d.marshal(ctx, ch, message)
 	if err != nil {
-		return errorx.NewChannelizeErrorWithErr(errorx.CodeFailedToMarshalMessage, err)
+		return err
+	}
+
+	finish := func(result *DeliveryResult) {
+		span.SetAttributes(
+			attribute.Int(common.TraceAttrDelivered, result.Delivered),
+			attribute.Int(common.TraceAttrDropped, result.Dropped),
+		)
+		done(result)
+	}
+
+	if d.pool != nil && d.pool.submit(ctx, connections, ch, msgOutBytes, finish) {
+		return nil
 	}
 
+	result := d.sendAll(ctx, connections, ch, msgOutBytes)
+	result.Subscribers = len(connections)
+	finish(result)
+
+	return nil
+}
+
+// sendAll sends the input serialized message to the input connections, and
+// returns the number of delivered and dropped messages.
+func (d *Dispatch) sendAll(
+	ctx context.Context,
+	connections []common.ConnectionWrapper,
+	ch channel.Channel,
+	msgOutBytes []byte,
+) *DeliveryResult {
+	result := new(DeliveryResult)
 	for _, conn := range connections {
-		if err := conn.SendMessage(msgOutBytes); err != nil {
+		if err := conn.SendMessageContext(ctx, msgOutBytes); err != nil {
+			result.addFailure(conn.ID(), err)
+			d.collector.MessagesDroppedInc(ch.String(), dropReason(err))
 			d.logger.Error(
 				"failed to send public message to the inbound buffer",
 				common.LogFieldID, conn.ID(),
 				common.LogFieldError, err.Error(),
 			)
+			continue
 		}
+
+		result.Delivered++
+		d.collector.MessagesDeliveredInc(ch.String())
 	}
 
-	return nil
+	return result
+}
+
+// dropAll records the message of the input channel as dropped for the input
+// connections because of the input error.
+func (d *Dispatch) dropAll(connections []common.ConnectionWrapper, ch channel.Channel, err error) *DeliveryResult {
+	result := new(DeliveryResult)
+	reason := dropReason(err)
+	for _, conn := range connections {
+		result.addFailure(conn.ID(), err)
+		d.collector.MessagesDroppedInc(ch.String(), reason)
+	}
+
+	return result
 }
 
 // SendPrivateMessage sends the input message to the input channel if the client
@@ -82,43 +564,265 @@ func (d *Dispatch) SendPublicMessage(ctx context.Context, ch channel.Channel, me
 //
 // SendPrivateMessage might return token expiration or json marshal errors.
 func (d *Dispatch) SendPrivateMessage(ctx context.Context, ch channel.Channel, userID string, message interface{}) error {
+	defer d.observeFanout(ch, time.Now())
+
+	ctx, span := d.startSpan(ctx, spanNamePublishPrivate, ch)
+	err := d.sendPrivateMessage(ctx, ch, userID, message)
+	endSpan(span, err)
+
+	return err
+}
+
+// sendPrivateMessage sends the input message to the connection of the input
+// userID. It records the fan-out size and the number of delivered and dropped
+// messages in the context span.
+func (d *Dispatch) sendPrivateMessage(ctx context.Context, ch channel.Channel, userID string, message interface{}) error {
+	d.collector.MessagesPublishedInc(ch.String())
+	span := trace.SpanFromContext(ctx)
+
 	conn := d.store.ConnectionByUserID(ctx, ch, userID)
 	if conn == nil {
+		span.SetAttributes(attribute.Int(common.TraceAttrFanoutSize, 0))
 		return nil
 	}
 
+	span.SetAttributes(attribute.Int(common.TraceAttrFanoutSize, 1))
+
 	// validate auth token before sending the message.
-	err := conn.Authenticate()
-	var authErr *errorx.ChannelizeError
-	switch {
-	case err == nil:
-	case errors.As(err, &authErr):
-		if authErr.Code == errorx.CodeAuthTokenIsMissing ||
-			authErr.Code == errorx.CodeAuthFuncIsMissing ||
-			authErr.Code == errorx.CodeAuthTokenIsExpired {
+	if err := d.authenticate(ctx, conn, ch); err != nil {
+		span.SetAttributes(attribute.Int(common.TraceAttrDropped, 1))
+		if isTokenError(err) {
 			d.store.UnsubscribeUserID(ctx, conn.ID(), userID, ch)
 		}
 		// TODO write error to the connection
 		return err
-	default:
+	}
+
+	msgOutBytes, err := d.marshal(ctx, ch, message)
+	if err != nil {
 		return err
 	}
 
-	msgOut := newMessageOut(ch, message)
-	msgOutBytes, err := json.Marshal(msgOut)
+	return d.deliver(ctx, conn, ch, msgOutBytes, "failed to send private message to the inbound buffer")
+}
+
+// SendToConnection sends the input message to the connection with the input
+// connID in the input channel, regardless of its user and subscriptions, e.g.
+// to notify an anonymous connection. The channel must be registered, and if
+// it is private, the connection token is validated like SendPrivateMessage.
+//
+// SendToConnection might return unsupported channel, connection not found,
+// token, json marshal, or the connection SendMessage errors.
+func (d *Dispatch) SendToConnection(ctx context.Context, connID string, ch channel.Channel, message interface{}) error {
+	defer d.observeFanout(ch, time.Now())
+
+	ctx, span := d.startSpan(ctx, spanNameConnection, ch)
+	span.SetAttributes(attribute.String(common.TraceAttrConnectionID, connID))
+	err := d.sendToConnection(ctx, connID, ch, message)
+	endSpan(span, err)
+
+	return err
+}
+
+// sendToConnection sends the input message to the connection with the input
+// connID. It records the fan-out size and the delivery result in the context
+// span.
+func (d *Dispatch) sendToConnection(ctx context.Context, connID string, ch channel.Channel, message interface{}) error {
+	if !ch.IsSupportedChannel() {
+		return errorx.NewChannelizeError(errorx.CodeUnsupportedChannel)
+	}
+
+	d.collector.MessagesPublishedInc(ch.String())
+	span := trace.SpanFromContext(ctx)
+
+	conn := d.store.Connection(ctx, connID)
+	if conn == nil {
+		span.SetAttributes(attribute.Int(common.TraceAttrFanoutSize, 0))
+		return errorx.NewChannelizeError(errorx.CodeConnectionNotFound)
+	}
+
+	span.SetAttributes(attribute.Int(common.TraceAttrFanoutSize, 1))
+
+	if ch.IsSupportedPrivateChannel() {
+		if err := d.authenticate(ctx, conn, ch); err != nil {
+			span.SetAttributes(attribute.Int(common.TraceAttrDropped, 1))
+			return err
+		}
+	}
+
+	msgOutBytes, err := d.marshal(ctx, ch, message)
 	if err != nil {
-		return errorx.NewChannelizeErrorWithErr(errorx.CodeFailedToMarshalMessage, err)
+		return err
 	}
 
-	if err = conn.SendMessage(msgOutBytes); err != nil {
-		d.logger.Error(
-			"failed to send private message to the inbound buffer",
-			common.LogFieldID, conn.ID(),
-			common.LogFieldError, err.Error(),
-		)
+	return d.deliver(ctx, conn, ch, msgOutBytes, "failed to send direct message to the inbound buffer")
+}
 
+// authenticate validates the token of the input connection before sending
+// a message of the input private channel. The failures are recorded as the
+// auth failures and the unauthenticated drops of the channel.
+func (d *Dispatch) authenticate(ctx context.Context, conn common.ConnectionWrapper, ch channel.Channel) error {
+	if err := conn.Authenticate(ctx); err != nil {
+		d.collector.AuthFailuresInc()
+		d.collector.MessagesDroppedInc(ch.String(), metrics.DropReasonUnauthenticated)
 		return err
 	}
 
 	return nil
 }
+
+// isTokenError returns true if the input authentication error is caused by
+// the connection token, i.e. the token is missing, expired, or it can't be
+// validated without the auth function.
+func isTokenError(err error) bool {
+	var authErr *errorx.ChannelizeError
+	if !errors.As(err, &authErr) {
+		return false
+	}
+
+	return authErr.Code == errorx.CodeAuthTokenIsMissing ||
+		authErr.Code == errorx.CodeAuthFuncIsMissing ||
+		authErr.Code == errorx.CodeAuthTokenIsExpired
+}
+
+// deliver sends the serialized message to a single connection, and records
+// the delivery result in the metrics and the context span. The input logMsg
+// is logged if sending the message fails.
+//
+// If the fan-out pool is enabled, the message is queued in the partition of
+// the connection, so it doesn't overtake the queued public messages of the
+// connection. It waits until the worker sends the message.
+func (d *Dispatch) deliver(
+	ctx context.Context,
+	conn common.ConnectionWrapper,
+	ch channel.Channel,
+	msgOutBytes []byte,
+	logMsg string,
+) error {
+	span := trace.SpanFromContext(ctx)
+	sender := directSender{dispatch: d, logMsg: logMsg}
+	connections := []common.ConnectionWrapper{conn}
+
+	var result *DeliveryResult
+	if d.pool != nil {
+		done := make(chan *DeliveryResult, 1)
+		if d.pool.submitWith(ctx, sender, connections, ch, msgOutBytes, func(r *DeliveryResult) { done <- r }) {
+			result = <-done
+		}
+	}
+
+	if result == nil {
+		result = sender.sendAll(ctx, connections, ch, msgOutBytes)
+	}
+
+	if len(result.Failures) != 0 {
+		span.SetAttributes(attribute.Int(common.TraceAttrDropped, 1))
+		return result.Failures[0].Err
+	}
+
+	span.SetAttributes(attribute.Int(common.TraceAttrDelivered, 1))
+
+	return nil
+}
+
+// directSender sends the messages of a single connection, e.g. the private
+// messages. It works like the Dispatch sender, but it logs the failures with
+// its own message.
+type directSender struct {
+	dispatch *Dispatch
+	logMsg   string
+}
+
+// sendAll sends the input message to the input connections and returns the
+// delivery result.
+func (s directSender) sendAll(
+	ctx context.Context,
+	connections []common.ConnectionWrapper,
+	ch channel.Channel,
+	msgOutBytes []byte,
+) *DeliveryResult {
+	result := new(DeliveryResult)
+	for _, conn := range connections {
+		if err := conn.SendMessageContext(ctx, msgOutBytes); err != nil {
+			result.addFailure(conn.ID(), err)
+			s.dispatch.collector.MessagesDroppedInc(ch.String(), dropReason(err))
+			s.dispatch.logger.Error(s.logMsg, common.LogFieldID, conn.ID(), common.LogFieldError, err.Error())
+			continue
+		}
+
+		result.Delivered++
+		s.dispatch.collector.MessagesDeliveredInc(ch.String())
+	}
+
+	return result
+}
+
+// dropAll records the input message as dropped for the input connections.
+func (s directSender) dropAll(connections []common.ConnectionWrapper, ch channel.Channel, err error) *DeliveryResult {
+	return s.dispatch.dropAll(connections, ch, err)
+}
+
+// marshal serializes the outbound message of the input channel and observes
+// the marshal duration. It adds the trace ID of the context span to the
+// message metadata if the trace ID injection is enabled.
+func (d *Dispatch) marshal(ctx context.Context, ch channel.Channel, message interface{}) ([]byte, error) {
+	startedAt := time.Now()
+
+	msgOut := newMessageOut(ch, message)
+	if sc := trace.SpanContextFromContext(ctx); d.config.injectTraceID && sc.IsValid() {
+		msgOut.Metadata = &MessageMetadata{TraceID: sc.TraceID().String()}
+	}
+
+	msgOutBytes, err := json.Marshal(msgOut)
+	if err != nil {
+		return nil, errorx.NewChannelizeErrorWithErr(errorx.CodeFailedToMarshalMessage, err)
+	}
+
+	d.collector.MarshalDurationObserve(ch.String(), time.Since(startedAt))
+
+	return msgOutBytes, nil
+}
+
+// startSpan starts a new span for publishing a message to the input channel.
+func (d *Dispatch) startSpan(ctx context.Context, name string, ch channel.Channel) (context.Context, trace.Span) {
+	return d.config.tracer.Start(
+		ctx, name,
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(attribute.String(common.TraceAttrChannel, ch.String())),
+	)
+}
+
+// endSpan records the input error in the span, if any, and ends the span.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+
+	span.End()
+}
+
+// observeFanout observes the fan-out duration of the input channel since the
+// input start time.
+func (d *Dispatch) observeFanout(ch channel.Channel, startedAt time.Time) {
+	d.collector.FanoutDurationObserve(ch.String(), time.Since(startedAt))
+}
+
+// dropReason returns the metrics reason of the input SendMessage error.
+func dropReason(err error) string {
+	var chanErr *errorx.ChannelizeError
+	if !errors.As(err, &chanErr) {
+		return metrics.DropReasonError
+	}
+
+	switch chanErr.Code {
+	case errorx.CodeOutboundBufferIsFull:
+		return metrics.DropReasonBufferFull
+	case errorx.CodeConnectionClosed:
+		return metrics.DropReasonConnectionClosed
+	case errorx.CodeFanoutQueueFull:
+		return metrics.DropReasonFanoutQueueFull
+	default:
+		return metrics.DropReasonError
+	}
+}
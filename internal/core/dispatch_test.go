@@ -9,17 +9,23 @@ import (
 	"encoding/json"
 	"errors"
 	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	uuid "github.com/satori/go.uuid"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
 
 	"github.com/hmdsefi/channelize/internal/channel"
 	"github.com/hmdsefi/channelize/internal/common"
 	"github.com/hmdsefi/channelize/internal/common/errorx"
-	"github.com/hmdsefi/channelize/internal/common/log"
 	"github.com/hmdsefi/channelize/internal/core/mock"
+	"github.com/hmdsefi/channelize/log"
+	"github.com/hmdsefi/channelize/metrics"
 )
 
 var (
@@ -47,7 +53,7 @@ func TestDispatch_SendPublicMessage(t *testing.T) {
 	ctx := context.Background()
 
 	t.Run("send message to not existing channel", func(t *testing.T) {
-		dispatch := NewDispatch(mock.NewStore(map[string]common.ConnectionWrapper{}), log.NewDefaultLogger())
+		dispatch := NewDispatch(mock.NewStore(map[string]common.ConnectionWrapper{}), mock.NewCollector(), log.NewDefaultLogger())
 		err := dispatch.SendPublicMessage(ctx, "myChannel", expectedData)
 		assert.Nil(t, err)
 	})
@@ -65,7 +71,7 @@ func TestDispatch_SendPublicMessage(t *testing.T) {
 		dispatch := NewDispatch(
 			mock.NewStore(map[string]common.ConnectionWrapper{
 				uuid.NewV4().String(): conn.WithError(expectedErr),
-			}), logger)
+			}), mock.NewCollector(), logger)
 		err := dispatch.SendPublicMessage(ctx, testChannel, expectedData)
 		assert.Nil(t, err)
 	})
@@ -73,6 +79,7 @@ func TestDispatch_SendPublicMessage(t *testing.T) {
 	conn := mock.NewConnection(connID, nil, authNoopFunc)
 	dispatch := NewDispatch(
 		mock.NewStore(map[string]common.ConnectionWrapper{uuid.NewV4().String(): conn}),
+		mock.NewCollector(),
 		log.NewDefaultLogger(),
 	)
 
@@ -102,6 +109,350 @@ func TestDispatch_SendPublicMessage(t *testing.T) {
 	})
 }
 
+// TestDispatch_SendPublicMessageWithResult returns the number of subscribers,
+// delivered and dropped messages, and the failed connections.
+func TestDispatch_SendPublicMessageWithResult(t *testing.T) {
+	const testChannel = channel.Channel("testChannel")
+
+	ctx := context.Background()
+	fullErr := errorx.NewChannelizeError(errorx.CodeOutboundBufferIsFull)
+	conn := mock.NewConnection(testConnectionIDs[0], nil, authNoopFunc)
+	full := mock.NewConnection(testConnectionIDs[1], nil, authNoopFunc).WithError(fullErr)
+	dispatch := NewDispatch(
+		mock.NewStore(map[string]common.ConnectionWrapper{
+			uuid.NewV4().String(): conn,
+			uuid.NewV4().String(): full,
+		}),
+		mock.NewCollector(),
+		log.NewDefaultLogger(),
+	)
+
+	expectedResult := &DeliveryResult{
+		Subscribers: 2,
+		Delivered:   1,
+		Dropped:     1,
+		Failures:    []DeliveryFailure{{ConnectionID: full.ID(), Err: fullErr}},
+	}
+
+	t.Run("sync", func(t *testing.T) {
+		result, err := dispatch.SendPublicMessageWithResult(ctx, testChannel, expectedData)
+		require.Nil(t, err)
+		assert.Equal(t, expectedResult, result)
+		assert.Len(t, conn.Message(), 1)
+		<-conn.Message()
+	})
+
+	t.Run("async", func(t *testing.T) {
+		done := make(chan *DeliveryResult, 1)
+		dispatch.SendPublicMessageAsync(ctx, testChannel, expectedData, func(result *DeliveryResult, err error) {
+			assert.Nil(t, err)
+			done <- result
+		})
+
+		select {
+		case result := <-done:
+			assert.Equal(t, expectedResult, result)
+		case <-time.After(time.Second):
+			t.Fatal("callback is not called")
+		}
+		assert.Len(t, conn.Message(), 1)
+		<-conn.Message()
+	})
+
+	t.Run("async queue is full", func(t *testing.T) {
+		conn := mock.NewConnection(testConnectionIDs[0], nil, authNoopFunc)
+		dispatch := NewDispatch(
+			mock.NewStore(map[string]common.ConnectionWrapper{uuid.NewV4().String(): conn}),
+			mock.NewCollector(),
+			log.NewDefaultLogger(),
+			WithAsyncQueueSize(1),
+		)
+		defer dispatch.Close()
+
+		// block the worker with the first message, and fill the queue with the
+		// second one, so the caller blocks until the context is done.
+		release := make(chan struct{})
+		taken := make(chan struct{})
+		dispatch.SendPublicMessageAsync(ctx, testChannel, expectedData, func(*DeliveryResult, error) {
+			close(taken)
+			<-release
+		})
+		<-taken
+		dispatch.SendPublicMessageAsync(ctx, testChannel, expectedData, nil)
+
+		cancelled, cancel := context.WithCancel(ctx)
+		cancel()
+
+		errs := make(chan error, 1)
+		dispatch.SendPublicMessageAsync(cancelled, testChannel, expectedData, func(result *DeliveryResult, err error) {
+			assert.Nil(t, result)
+			errs <- err
+		})
+		assert.ErrorIs(t, <-errs, context.Canceled)
+
+		close(release)
+		dispatch.Close()
+		assert.Len(t, conn.Message(), 2)
+	})
+
+	t.Run("async order", func(t *testing.T) {
+		conn := mock.NewConnection(testConnectionIDs[0], nil, authNoopFunc)
+		dispatch := NewDispatch(
+			mock.NewStore(map[string]common.ConnectionWrapper{uuid.NewV4().String(): conn}),
+			mock.NewCollector(),
+			log.NewDefaultLogger(),
+		)
+
+		const messages = 100
+		for i := 0; i < messages; i++ {
+			dispatch.SendPublicMessageAsync(ctx, testChannel, i, nil)
+		}
+		dispatch.Close()
+
+		for i := 0; i < messages; i++ {
+			var msgOut struct {
+				Data int `json:"data"`
+			}
+			require.Nil(t, json.Unmarshal(<-conn.Message(), &msgOut))
+			assert.Equal(t, i, msgOut.Data)
+		}
+	})
+
+	t.Run("async after close", func(t *testing.T) {
+		conn := mock.NewConnection(testConnectionIDs[0], nil, authNoopFunc)
+		dispatch := NewDispatch(
+			mock.NewStore(map[string]common.ConnectionWrapper{uuid.NewV4().String(): conn}),
+			mock.NewCollector(),
+			log.NewDefaultLogger(),
+		)
+		dispatch.Close()
+
+		// the message is sent by the caller goroutine.
+		var called bool
+		dispatch.SendPublicMessageAsync(ctx, testChannel, expectedData, func(result *DeliveryResult, err error) {
+			require.Nil(t, err)
+			assert.Equal(t, 1, result.Delivered)
+			called = true
+		})
+		assert.True(t, called)
+		assert.Len(t, conn.Message(), 1)
+	})
+
+	t.Run("marshal error", func(t *testing.T) {
+		result, err := dispatch.SendPublicMessageWithResult(ctx, testChannel, complex64(1))
+		assert.Nil(t, result)
+		var chanErr *errorx.ChannelizeError
+		require.True(t, errors.As(err, &chanErr))
+		assert.Equal(t, errorx.CodeFailedToMarshalMessage, chanErr.Code)
+	})
+
+	t.Run("no subscribers", func(t *testing.T) {
+		dispatch := NewDispatch(mock.NewStore(map[string]common.ConnectionWrapper{}), mock.NewCollector(), log.NewDefaultLogger())
+		result, err := dispatch.SendPublicMessageWithResult(ctx, testChannel, expectedData)
+		require.Nil(t, err)
+		assert.Equal(t, &DeliveryResult{}, result)
+	})
+}
+
+// TestDispatch_SendClientMessage sends a client message to the connections of
+// a channel except the publisher connection.
+func TestDispatch_SendClientMessage(t *testing.T) {
+	const testChannel = channel.Channel("testChannel")
+
+	ctx := context.Background()
+	publisher := mock.NewConnection(testConnectionIDs[0], nil, authNoopFunc)
+	subscriber := mock.NewConnection(testConnectionIDs[1], nil, authNoopFunc)
+	dispatch := NewDispatch(
+		mock.NewStore(map[string]common.ConnectionWrapper{
+			uuid.NewV4().String(): publisher,
+			uuid.NewV4().String(): subscriber,
+		}),
+		mock.NewCollector(),
+		log.NewDefaultLogger(),
+	)
+
+	require.Nil(t, dispatch.SendClientMessage(ctx, testChannel, expectedData, publisher.ID()))
+	assert.Len(t, publisher.Message(), 0)
+
+	var msgOut testMessageOut
+	require.Nil(t, json.Unmarshal(<-subscriber.Message(), &msgOut))
+	assert.Equal(t, testChannel, msgOut.Channel)
+	assert.Equal(t, expectedData, msgOut.Data)
+
+	// the publisher receives its own message without echo suppression.
+	require.Nil(t, dispatch.SendClientMessage(ctx, testChannel, expectedData, ""))
+	assert.Len(t, publisher.Message(), 1)
+	assert.Len(t, subscriber.Message(), 1)
+}
+
+// TestDispatch_SendToTag sends a message to the tagged connections of a
+// channel.
+func TestDispatch_SendToTag(t *testing.T) {
+	const testChannel = channel.Channel("testChannel")
+
+	ctx := context.Background()
+	vip1 := mock.NewConnection(testConnectionIDs[0], nil, authNoopFunc)
+	vip2 := mock.NewConnection(testConnectionIDs[1], nil, authNoopFunc)
+	other := mock.NewConnection(testConnectionIDs[2], nil, authNoopFunc)
+	vip1.AddTags("vip")
+	vip2.AddTags("vip", "org:acme")
+	other.AddTags("org:acme")
+
+	collector := mock.NewCollector()
+	dispatch := NewDispatch(
+		mock.NewStore(map[string]common.ConnectionWrapper{
+			uuid.NewV4().String(): vip1,
+			uuid.NewV4().String(): vip2,
+			uuid.NewV4().String(): other,
+		}),
+		collector,
+		log.NewDefaultLogger(),
+	)
+
+	require.Nil(t, dispatch.SendToTag(ctx, testChannel, "vip", expectedData))
+	assert.Len(t, other.Message(), 0)
+	for _, conn := range []*mock.Connection{vip1, vip2} {
+		var msgOut testMessageOut
+		require.Nil(t, json.Unmarshal(<-conn.Message(), &msgOut))
+		assert.Equal(t, testChannel, msgOut.Channel)
+		assert.Equal(t, expectedData, msgOut.Data)
+	}
+
+	// the message is marshaled once.
+	assert.Equal(t, int32(1), collector.MarshalCount)
+
+	require.Nil(t, dispatch.SendToTag(ctx, testChannel, "unknown", expectedData))
+	assert.Len(t, vip1.Message(), 0)
+	assert.Len(t, vip2.Message(), 0)
+	assert.Len(t, other.Message(), 0)
+}
+
+// TestDispatch_SendToTag_PrivateChannel sends a message to the tagged
+// connections of a private channel and expects that the unauthenticated
+// connections are skipped and unsubscribed.
+func TestDispatch_SendToTag_PrivateChannel(t *testing.T) {
+	privateChannel := channel.RegisterPrivateChannel("tag-private-channel")
+	defer channel.UnregisterChannel(privateChannel)
+
+	ctx := context.Background()
+	userID := "test_user_id"
+	authenticated := mock.NewConnection(testConnectionIDs[0], &userID, authNoopFunc)
+	expired := mock.NewConnection(testConnectionIDs[1], &userID, func() error {
+		return errorx.NewChannelizeError(errorx.CodeAuthTokenIsExpired)
+	})
+	authenticated.AddTags("vip")
+	expired.AddTags("vip")
+
+	collector := mock.NewCollector()
+	store := mock.NewStore(map[string]common.ConnectionWrapper{
+		uuid.NewV4().String(): authenticated,
+		uuid.NewV4().String(): expired,
+	})
+	dispatch := NewDispatch(store, collector, log.NewDefaultLogger())
+
+	require.Nil(t, dispatch.SendToTag(ctx, privateChannel, "vip", expectedData))
+	assert.Len(t, authenticated.Message(), 1)
+	assert.Len(t, expired.Message(), 0)
+	assert.Equal(t, privateChannel.String(), store.Receive())
+	assert.Equal(t, int32(1), atomic.LoadInt32(&collector.AuthFailuresCount))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&collector.DroppedCount))
+}
+
+// TestDispatch_Broadcast sends a message to all the connections in the
+// announcement channel.
+func TestDispatch_Broadcast(t *testing.T) {
+	ctx := context.Background()
+	conn1 := mock.NewConnection(testConnectionIDs[0], nil, authNoopFunc)
+	conn2 := mock.NewConnection(testConnectionIDs[1], nil, authNoopFunc)
+	dispatch := NewDispatch(
+		mock.NewStore(map[string]common.ConnectionWrapper{
+			uuid.NewV4().String(): conn1,
+			uuid.NewV4().String(): conn2,
+		}),
+		mock.NewCollector(),
+		log.NewDefaultLogger(),
+	)
+
+	require.Nil(t, dispatch.Broadcast(ctx, expectedData))
+
+	for _, conn := range []*mock.Connection{conn1, conn2} {
+		var msgOut testMessageOut
+		require.Nil(t, json.Unmarshal(<-conn.Message(), &msgOut))
+		assert.Equal(t, channel.AnnouncementChannel, msgOut.Channel)
+		assert.Equal(t, expectedData, msgOut.Data)
+	}
+}
+
+// TestDispatch_Metrics collects the published, delivered, dropped, and auth
+// failure metrics.
+func TestDispatch_Metrics(t *testing.T) {
+	ctx := context.Background()
+	userID := uuid.NewV4().String()
+	conn := mock.NewConnection(testConnectionIDs[0], &userID, makeAuthFunc(errorx.CodeAuthTokenIsExpired))
+	fullConn := mock.NewConnection(testConnectionIDs[1], nil, authNoopFunc).
+		WithError(errorx.NewChannelizeError(errorx.CodeOutboundBufferIsFull))
+
+	mockCollector := mock.NewCollector()
+	mockStore := mock.NewStore(map[string]common.ConnectionWrapper{userID: conn, "full": fullConn})
+	dispatch := NewDispatch(mockStore, mockCollector, log.NewDefaultLogger())
+
+	require.Nil(t, dispatch.SendPublicMessage(ctx, "metrics-channel", expectedData))
+	assert.Equal(t, int32(1), mockCollector.PublishedCount)
+	assert.Equal(t, int32(1), mockCollector.DeliveredCount)
+	assert.Equal(t, int32(1), mockCollector.DroppedCount)
+	assert.Equal(t, int32(1), mockCollector.MarshalCount)
+	assert.Equal(t, int32(1), mockCollector.FanoutCount)
+
+	require.NotNil(t, dispatch.SendPrivateMessage(ctx, "metrics-channel", userID, expectedData))
+	assert.Equal(t, "metrics-channel", mockStore.Receive())
+	assert.Equal(t, int32(2), mockCollector.PublishedCount)
+	assert.Equal(t, int32(2), mockCollector.DroppedCount)
+	assert.Equal(t, int32(1), mockCollector.AuthFailuresCount)
+	assert.Equal(t, int32(1), mockCollector.MarshalCount)
+	assert.Equal(t, int32(2), mockCollector.FanoutCount)
+}
+
+func TestDispatch_Tracing(t *testing.T) {
+	ctx := context.Background()
+	conn := mock.NewConnection(testConnectionIDs[0], nil, authNoopFunc)
+	fullConn := mock.NewConnection(testConnectionIDs[1], nil, authNoopFunc).
+		WithError(errorx.NewChannelizeError(errorx.CodeOutboundBufferIsFull))
+
+	recorder := tracetest.NewSpanRecorder()
+	tracer := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)).Tracer("test")
+	dispatch := NewDispatch(
+		mock.NewStore(map[string]common.ConnectionWrapper{"conn": conn, "full": fullConn}),
+		mock.NewCollector(),
+		log.NewDefaultLogger(),
+		WithTracer(tracer),
+		WithTraceIDInjection(true),
+	)
+
+	require.Nil(t, dispatch.SendPublicMessage(ctx, "tracing-channel", expectedData))
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 1)
+	assert.Equal(t, spanNamePublish, spans[0].Name())
+	assert.ElementsMatch(t, []attribute.KeyValue{
+		attribute.String(common.TraceAttrChannel, "tracing-channel"),
+		attribute.Int(common.TraceAttrFanoutSize, 2),
+		attribute.Int(common.TraceAttrDelivered, 1),
+		attribute.Int(common.TraceAttrDropped, 1),
+	}, spans[0].Attributes())
+
+	var msgOut MessageOut
+	require.Nil(t, json.Unmarshal(<-conn.Message(), &msgOut))
+	require.NotNil(t, msgOut.Metadata)
+	assert.Equal(t, spans[0].SpanContext().TraceID().String(), msgOut.Metadata.TraceID)
+}
+
+func TestDropReason(t *testing.T) {
+	assert.Equal(t, metrics.DropReasonBufferFull, dropReason(errorx.NewChannelizeError(errorx.CodeOutboundBufferIsFull)))
+	assert.Equal(t, metrics.DropReasonConnectionClosed, dropReason(errorx.NewChannelizeError(errorx.CodeConnectionClosed)))
+	assert.Equal(t, metrics.DropReasonFanoutQueueFull, dropReason(errorx.NewChannelizeError(errorx.CodeFanoutQueueFull)))
+	assert.Equal(t, metrics.DropReasonError, dropReason(errors.New("test error")))
+}
+
 // TestDispatch_SendPublicMessage_Concurrent creates a list of connection and
 // store them in the dispatch storage for any input channel. Sends multiple
 // public messages and reads them concurrently.
@@ -143,7 +494,7 @@ func TestDispatch_SendPublicMessage_Concurrent(t *testing.T) {
 	}
 
 	// store the created connections into the storage and create dispatch with it.
-	dispatch := NewDispatch(mock.NewStore(connMap), log.NewDefaultLogger())
+	dispatch := NewDispatch(mock.NewStore(connMap), mock.NewCollector(), log.NewDefaultLogger())
 
 	// send multiple public messages concurrently
 	parallelSendCount := 100
@@ -168,6 +519,98 @@ func TestDispatch_SendPublicMessage_Concurrent(t *testing.T) {
 	wg.Wait()
 }
 
+// TestDispatch_SendToConnection sends a message to an anonymous connection by
+// its ID.
+func TestDispatch_SendToConnection(t *testing.T) {
+	testChannel := channel.RegisterPublicChannel("onboarding")
+	privateChannel := channel.RegisterPrivateChannel("onboarding-private")
+	defer channel.UnregisterChannel(testChannel)
+	defer channel.UnregisterChannel(privateChannel)
+
+	ctx := context.Background()
+
+	t.Run("connection SendMessage error", func(t *testing.T) {
+		expectedErr := errors.New("invalid message")
+		conn := mock.NewConnection(testConnectionIDs[0], nil, authNoopFunc)
+		logger := mock.NewLogger(t)
+		logger.Expected(
+			log.Error,
+			"failed to send direct message to the inbound buffer",
+			common.LogFieldID, conn.ID(),
+			common.LogFieldError, expectedErr.Error(),
+		)
+		dispatch := NewDispatch(
+			mock.NewStore(map[string]common.ConnectionWrapper{
+				uuid.NewV4().String(): conn.WithError(expectedErr),
+			}), mock.NewCollector(), logger)
+		err := dispatch.SendToConnection(ctx, conn.ID(), testChannel, expectedData)
+		assert.Equal(t, expectedErr, err)
+	})
+
+	conn := mock.NewConnection(testConnectionIDs[0], nil, authNoopFunc)
+	other := mock.NewConnection(testConnectionIDs[1], nil, authNoopFunc)
+	dispatch := NewDispatch(
+		mock.NewStore(map[string]common.ConnectionWrapper{
+			uuid.NewV4().String(): conn,
+			uuid.NewV4().String(): other,
+		}),
+		mock.NewCollector(),
+		log.NewDefaultLogger(),
+	)
+
+	t.Run("send message to not existing connection", func(t *testing.T) {
+		err := dispatch.SendToConnection(ctx, uuid.NewV4().String(), testChannel, expectedData)
+		var chanErr *errorx.ChannelizeError
+		require.True(t, errors.As(err, &chanErr))
+		assert.Equal(t, errorx.CodeConnectionNotFound, chanErr.Code)
+	})
+
+	t.Run("send message to existing connection", func(t *testing.T) {
+		require.Nil(t, dispatch.SendToConnection(ctx, conn.ID(), testChannel, expectedData))
+
+		var msgOut testMessageOut
+		require.Nil(t, json.Unmarshal(<-conn.Message(), &msgOut))
+		assert.Equal(t, testChannel, msgOut.Channel)
+		assert.Equal(t, expectedData, msgOut.Data)
+		assert.Len(t, other.Message(), 0)
+	})
+
+	t.Run("send message to unregistered channel", func(t *testing.T) {
+		err := dispatch.SendToConnection(ctx, conn.ID(), channel.Channel("unregistered"), expectedData)
+		var chanErr *errorx.ChannelizeError
+		require.True(t, errors.As(err, &chanErr))
+		assert.Equal(t, errorx.CodeUnsupportedChannel, chanErr.Code)
+		assert.Len(t, conn.Message(), 0)
+	})
+
+	t.Run("send private message to unauthenticated connection", func(t *testing.T) {
+		anonymous := mock.NewConnection(testConnectionIDs[2], nil, func() error {
+			return errorx.NewChannelizeError(errorx.CodeAuthTokenIsMissing)
+		})
+		collector := mock.NewCollector()
+		dispatch := NewDispatch(
+			mock.NewStore(map[string]common.ConnectionWrapper{uuid.NewV4().String(): anonymous}),
+			collector,
+			log.NewDefaultLogger(),
+		)
+
+		err := dispatch.SendToConnection(ctx, anonymous.ID(), privateChannel, expectedData)
+		var chanErr *errorx.ChannelizeError
+		require.True(t, errors.As(err, &chanErr))
+		assert.Equal(t, errorx.CodeAuthTokenIsMissing, chanErr.Code)
+		assert.Len(t, anonymous.Message(), 0)
+		assert.Equal(t, int32(1), atomic.LoadInt32(&collector.AuthFailuresCount))
+	})
+
+	t.Run("send private message to authenticated connection", func(t *testing.T) {
+		require.Nil(t, dispatch.SendToConnection(ctx, conn.ID(), privateChannel, expectedData))
+
+		var msgOut testMessageOut
+		require.Nil(t, json.Unmarshal(<-conn.Message(), &msgOut))
+		assert.Equal(t, privateChannel, msgOut.Channel)
+	})
+}
+
 // TestDispatch_SendPrivateMessage send a private message to the client's subscribed
 // private channel.
 func TestDispatch_SendPrivateMessage(t *testing.T) {
@@ -193,7 +636,7 @@ func TestDispatch_SendPrivateMessage(t *testing.T) {
 		dispatch := NewDispatch(
 			mock.NewStore(map[string]common.ConnectionWrapper{
 				userID: conn.WithError(expectedErr),
-			}), logger)
+			}), mock.NewCollector(), logger)
 		err := dispatch.SendPrivateMessage(ctx, privateChannel, userID, expectedData)
 		assert.Equal(t, expectedErr, err)
 	})
@@ -201,6 +644,7 @@ func TestDispatch_SendPrivateMessage(t *testing.T) {
 	conn := mock.NewConnection(connID, &userID, authNoopFunc)
 	dispatch := NewDispatch(
 		mock.NewStore(map[string]common.ConnectionWrapper{userID: conn}),
+		mock.NewCollector(),
 		log.NewDefaultLogger(),
 	)
 
@@ -249,7 +693,7 @@ func TestDispatch_SendPrivateMessage_AuthError(t *testing.T) {
 
 	conn := mock.NewConnection(connID, &userID, makeAuthFunc(errorx.CodeAuthTokenIsExpired))
 	mockStore := mock.NewStore(map[string]common.ConnectionWrapper{userID: conn})
-	dispatch := NewDispatch(mockStore, log.NewDefaultLogger())
+	dispatch := NewDispatch(mockStore, mock.NewCollector(), log.NewDefaultLogger())
 
 	err := dispatch.SendPrivateMessage(ctx, privateChannel, userID, expectedData)
 	require.NotNil(t, err)
@@ -305,7 +749,7 @@ func TestDispatch_SendPrivateMessage_Concurrent(t *testing.T) {
 	}
 
 	// store the created connections into the storage and create dispatch with it.
-	dispatch := NewDispatch(mock.NewStore(userConnections), log.NewDefaultLogger())
+	dispatch := NewDispatch(mock.NewStore(userConnections), mock.NewCollector(), log.NewDefaultLogger())
 
 	// send multiple private messages concurrently
 	parallelSendCount := 100
@@ -0,0 +1,368 @@
+/**
+ * Copyright © 2022 Hamed Yousefi <hdyousefi@gmail.com>.
+ */
+
+package core
+
+import (
+	"context"
+	"hash/fnv"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/hmdsefi/channelize/internal/channel"
+	"github.com/hmdsefi/channelize/internal/common"
+	"github.com/hmdsefi/channelize/internal/common/errorx"
+	"github.com/hmdsefi/channelize/log"
+)
+
+const defaultFanoutQueueSize = 1024
+
+// OverflowPolicy specifies what the fan-out pool does with a new task when
+// the queue of its worker is full.
+type OverflowPolicy int
+
+const (
+	// OverflowBlock blocks the publisher until the queue has room, the
+	// publish context is done, or the pool is closed. The task is dropped if
+	// the context is done or the pool is closed.
+	OverflowBlock OverflowPolicy = iota
+
+	// OverflowDropNewest drops the new task and keeps the queued tasks.
+	OverflowDropNewest
+
+	// OverflowDropOldest drops the oldest queued task to make room for the
+	// new task.
+	OverflowDropOldest
+)
+
+// fanoutCollector is an interface for collecting the fan-out pool metrics.
+type fanoutCollector interface {
+	FanoutQueueLength(float64)
+	FanoutQueueLatencyObserve(d time.Duration)
+}
+
+// fanoutSender sends the messages of the fan-out tasks to the connections.
+type fanoutSender interface {
+	// sendAll sends the input data to the input connections and returns the
+	// delivery result.
+	sendAll(ctx context.Context, connections []common.ConnectionWrapper, ch channel.Channel, data []byte) *DeliveryResult
+
+	// dropAll records the input data as dropped for the input connections
+	// and returns the delivery result.
+	dropAll(connections []common.ConnectionWrapper, ch channel.Channel, err error) *DeliveryResult
+}
+
+// FanoutConfig represents the fan-out pool configuration.
+type FanoutConfig struct {
+	// workers is the number of the fan-out workers. The default value is
+	// runtime.GOMAXPROCS.
+	workers int
+
+	// queueSize is the maximum number of queued tasks per worker.
+	queueSize int
+
+	// overflowPolicy specifies what happens to a new task when the queue of
+	// its worker is full.
+	overflowPolicy OverflowPolicy
+}
+
+type FanoutOption func(*FanoutConfig)
+
+// WithFanoutWorkers sets the number of the fan-out workers. It ignores the
+// values less than one.
+func WithFanoutWorkers(workers int) FanoutOption {
+	return func(config *FanoutConfig) {
+		if config == nil || workers < 1 {
+			return
+		}
+
+		config.workers = workers
+	}
+}
+
+// WithFanoutQueueSize sets the maximum number of queued tasks per worker. It
+// ignores the values less than one.
+func WithFanoutQueueSize(size int) FanoutOption {
+	return func(config *FanoutConfig) {
+		if config == nil || size < 1 {
+			return
+		}
+
+		config.queueSize = size
+	}
+}
+
+// WithOverflowPolicy sets the policy of the full fan-out queues.
+func WithOverflowPolicy(policy OverflowPolicy) FanoutOption {
+	return func(config *FanoutConfig) {
+		if config == nil {
+			return
+		}
+
+		config.overflowPolicy = policy
+	}
+}
+
+// fanoutJob collects the delivery results of the tasks of a published
+// message, and calls the done function after the last task.
+type fanoutJob struct {
+	result  *DeliveryResult
+	pending int
+	done    func(*DeliveryResult)
+	mu      sync.Mutex
+}
+
+// finish adds the input result to the job result.
+func (j *fanoutJob) finish(result *DeliveryResult) {
+	j.mu.Lock()
+	j.result.Delivered += result.Delivered
+	j.result.Dropped += result.Dropped
+	j.result.Failures = append(j.result.Failures, result.Failures...)
+	j.pending--
+	last := j.pending == 0
+	j.mu.Unlock()
+
+	if last {
+		j.done(j.result)
+	}
+}
+
+// fanoutTask represents the connections of a partition that should receive
+// a published message.
+type fanoutTask struct {
+	ctx         context.Context
+	sender      fanoutSender
+	ch          channel.Channel
+	data        []byte
+	connections []common.ConnectionWrapper
+	job         *fanoutJob
+	enqueuedAt  time.Time
+}
+
+// fanoutPool sends the published messages to the connections by using a
+// bounded number of workers. The connections are partitioned by their IDs,
+// and each worker sends the messages of its partition in the queue order,
+// so the messages of a connection are delivered in the publish order.
+type fanoutPool struct {
+	// queued is the number of queued tasks of all the workers. It is the
+	// first field to keep the 64-bit alignment for the atomic operations on
+	// 32-bit platforms.
+	queued int64
+
+	config    FanoutConfig
+	sender    fanoutSender
+	collector fanoutCollector
+	logger    log.Logger
+
+	queues []chan *fanoutTask
+	wg     sync.WaitGroup
+
+	// mu prevents sending a task to the closed queues.
+	mu     sync.RWMutex
+	closed bool
+
+	// done is closed when the pool is closing. It unblocks the publishers that
+	// wait for a full queue while holding the read lock of mu.
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// newFanoutPool creates a new fanoutPool and starts its workers.
+func newFanoutPool(
+	sender fanoutSender,
+	collector fanoutCollector,
+	logger log.Logger,
+	options ...FanoutOption,
+) *fanoutPool {
+	config := FanoutConfig{
+		workers:        runtime.GOMAXPROCS(0),
+		queueSize:      defaultFanoutQueueSize,
+		overflowPolicy: OverflowBlock,
+	}
+	for _, option := range options {
+		option(&config)
+	}
+
+	p := &fanoutPool{
+		config:    config,
+		sender:    sender,
+		collector: collector,
+		logger:    logger,
+		queues:    make([]chan *fanoutTask, config.workers),
+		done:      make(chan struct{}),
+	}
+
+	p.wg.Add(config.workers)
+	for i := range p.queues {
+		p.queues[i] = make(chan *fanoutTask, config.queueSize)
+		go p.work(p.queues[i])
+	}
+
+	return p
+}
+
+// submit partitions the input connections and queues a task per partition.
+// It calls the done function with the delivery result after all the tasks
+// are done. It returns false if the pool is closed.
+func (p *fanoutPool) submit(
+	ctx context.Context,
+	connections []common.ConnectionWrapper,
+	ch channel.Channel,
+	data []byte,
+	done func(*DeliveryResult),
+) bool {
+	return p.submitWith(ctx, p.sender, connections, ch, data, done)
+}
+
+// submitWith works like submit, but the tasks are sent by the input sender
+// instead of the pool sender, e.g. for the frames of a batch publish.
+func (p *fanoutPool) submitWith(
+	ctx context.Context,
+	sender fanoutSender,
+	connections []common.ConnectionWrapper,
+	ch channel.Channel,
+	data []byte,
+	done func(*DeliveryResult),
+) bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if p.closed {
+		return false
+	}
+
+	partitions := make([][]common.ConnectionWrapper, len(p.queues))
+	for _, conn := range connections {
+		i := p.partition(conn.ID())
+		partitions[i] = append(partitions[i], conn)
+	}
+
+	job := &fanoutJob{result: &DeliveryResult{Subscribers: len(connections)}, done: done}
+	for _, partition := range partitions {
+		if len(partition) != 0 {
+			job.pending++
+		}
+	}
+
+	for i, partition := range partitions {
+		if len(partition) == 0 {
+			continue
+		}
+
+		p.enqueue(p.queues[i], &fanoutTask{
+			ctx:         ctx,
+			sender:      sender,
+			ch:          ch,
+			data:        data,
+			connections: partition,
+			job:         job,
+			enqueuedAt:  time.Now(),
+		})
+	}
+
+	return true
+}
+
+// enqueue sends the input task to the input queue. If the queue is full, it
+// applies the overflow policy.
+func (p *fanoutPool) enqueue(queue chan *fanoutTask, task *fanoutTask) {
+	// count the task before sending it, since the worker might take it
+	// before updating the queue length.
+	p.updateQueued(1)
+
+	select {
+	case queue <- task:
+		return
+	default:
+	}
+
+	switch p.config.overflowPolicy {
+	case OverflowDropNewest:
+		p.updateQueued(-1)
+		p.drop(task)
+	case OverflowDropOldest:
+		for {
+			select {
+			case queue <- task:
+				return
+			default:
+			}
+
+			// the worker might have taken the oldest task meanwhile.
+			select {
+			case oldest := <-queue:
+				p.updateQueued(-1)
+				p.drop(oldest)
+			default:
+			}
+		}
+	default:
+		select {
+		case queue <- task:
+		case <-task.ctx.Done():
+			p.updateQueued(-1)
+			p.drop(task)
+		case <-p.done:
+			p.updateQueued(-1)
+			p.drop(task)
+		}
+	}
+}
+
+// work sends the tasks of the input queue until the queue is closed.
+func (p *fanoutPool) work(queue chan *fanoutTask) {
+	defer p.wg.Done()
+
+	for task := range queue {
+		p.updateQueued(-1)
+		p.collector.FanoutQueueLatencyObserve(time.Since(task.enqueuedAt))
+
+		task.job.finish(task.sender.sendAll(task.ctx, task.connections, task.ch, task.data))
+	}
+}
+
+// drop records the message of the input task as dropped for all the task
+// connections.
+func (p *fanoutPool) drop(task *fanoutTask) {
+	p.logger.Warn(
+		"fan-out queue is full, message is dropped",
+		common.LogFieldChannel, task.ch.String(),
+	)
+
+	task.job.finish(task.sender.dropAll(task.connections, task.ch, errorx.NewChannelizeError(errorx.CodeFanoutQueueFull)))
+}
+
+// updateQueued adds the input delta to the number of queued tasks and sets
+// the queue length metric.
+func (p *fanoutPool) updateQueued(delta int64) {
+	p.collector.FanoutQueueLength(float64(atomic.AddInt64(&p.queued, delta)))
+}
+
+// partition returns the worker index of the input connection ID.
+func (p *fanoutPool) partition(connID string) int {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(connID))
+	return int(h.Sum32() % uint32(len(p.queues)))
+}
+
+// close stops accepting new tasks, and waits until the workers send the
+// queued tasks. The tasks that are blocked on a full queue are dropped.
+func (p *fanoutPool) close() {
+	p.closeOnce.Do(func() {
+		// the blocked publishers hold the read lock, so they should be
+		// released before taking the lock.
+		close(p.done)
+
+		p.mu.Lock()
+		p.closed = true
+		for _, queue := range p.queues {
+			close(queue)
+		}
+		p.mu.Unlock()
+
+		p.wg.Wait()
+	})
+}
@@ -0,0 +1,311 @@
+/**
+ * Copyright © 2022 Hamed Yousefi <hdyousefi@gmail.com>.
+ */
+
+package core
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/hmdsefi/channelize/internal/channel"
+	"github.com/hmdsefi/channelize/internal/common"
+	"github.com/hmdsefi/channelize/internal/common/errorx"
+	"github.com/hmdsefi/channelize/internal/core/mock"
+	"github.com/hmdsefi/channelize/log"
+)
+
+// blockingSender blocks the fan-out workers until it is released.
+type blockingSender struct {
+	started chan struct{}
+	release chan struct{}
+}
+
+func newBlockingSender() *blockingSender {
+	return &blockingSender{
+		started: make(chan struct{}, 8),
+		release: make(chan struct{}),
+	}
+}
+
+func (s *blockingSender) sendAll(
+	_ context.Context,
+	connections []common.ConnectionWrapper,
+	_ channel.Channel,
+	_ []byte,
+) *DeliveryResult {
+	s.started <- struct{}{}
+	<-s.release
+	return &DeliveryResult{Delivered: len(connections)}
+}
+
+func (s *blockingSender) dropAll(connections []common.ConnectionWrapper, _ channel.Channel, err error) *DeliveryResult {
+	result := new(DeliveryResult)
+	for _, conn := range connections {
+		result.addFailure(conn.ID(), err)
+	}
+
+	return result
+}
+
+// TestFanoutPool_Overflow applies the overflow policy to a new task when the
+// queue of its worker is full.
+func TestFanoutPool_Overflow(t *testing.T) {
+	const testChannel = channel.Channel("testChannel")
+
+	conns := []common.ConnectionWrapper{mock.NewConnection(testConnectionIDs[0], nil, authNoopFunc)}
+	queueFullErr := errorx.NewChannelizeError(errorx.CodeFanoutQueueFull)
+	dropped := &DeliveryResult{
+		Subscribers: 1,
+		Dropped:     1,
+		Failures:    []DeliveryFailure{{ConnectionID: testConnectionIDs[0], Err: queueFullErr}},
+	}
+	delivered := &DeliveryResult{Subscribers: 1, Delivered: 1}
+
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := []struct {
+		name     string
+		policy   OverflowPolicy
+		ctx      context.Context
+		expected [3]*DeliveryResult
+	}{
+		{
+			name:     "drop newest",
+			policy:   OverflowDropNewest,
+			ctx:      context.Background(),
+			expected: [3]*DeliveryResult{delivered, delivered, dropped},
+		},
+		{
+			name:     "drop oldest",
+			policy:   OverflowDropOldest,
+			ctx:      context.Background(),
+			expected: [3]*DeliveryResult{delivered, dropped, delivered},
+		},
+		{
+			name:     "block until the context is done",
+			policy:   OverflowBlock,
+			ctx:      cancelled,
+			expected: [3]*DeliveryResult{delivered, delivered, dropped},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sender := newBlockingSender()
+			collector := mock.NewCollector()
+			pool := newFanoutPool(
+				sender, collector, log.NewDefaultLogger(),
+				WithFanoutWorkers(1), WithFanoutQueueSize(1), WithOverflowPolicy(tt.policy),
+			)
+
+			var results [3]chan *DeliveryResult
+			for i := range results {
+				results[i] = make(chan *DeliveryResult, 1)
+			}
+
+			// the worker takes the first task, and the second task fills the queue.
+			require.True(t, pool.submit(context.Background(), conns, testChannel, nil, func(r *DeliveryResult) { results[0] <- r }))
+			<-sender.started
+			require.True(t, pool.submit(context.Background(), conns, testChannel, nil, func(r *DeliveryResult) { results[1] <- r }))
+			require.True(t, pool.submit(tt.ctx, conns, testChannel, nil, func(r *DeliveryResult) { results[2] <- r }))
+			assert.Equal(t, float64(1), collector.FanoutQueueLengthGauge.Value())
+
+			close(sender.release)
+			pool.close()
+
+			for i, expected := range tt.expected {
+				select {
+				case result := <-results[i]:
+					assert.Equal(t, expected, result)
+				case <-time.After(time.Second):
+					t.Fatalf("task %d is not done", i)
+				}
+			}
+			assert.Equal(t, float64(0), collector.FanoutQueueLengthGauge.Value())
+		})
+	}
+}
+
+// TestFanoutPool_CloseBlocked drops the task that is blocked on a full queue
+// when the pool is closed.
+func TestFanoutPool_CloseBlocked(t *testing.T) {
+	conns := []common.ConnectionWrapper{mock.NewConnection(testConnectionIDs[0], nil, authNoopFunc)}
+	sender := newBlockingSender()
+	collector := mock.NewCollector()
+	pool := newFanoutPool(
+		sender, collector, log.NewDefaultLogger(),
+		WithFanoutWorkers(1), WithFanoutQueueSize(1), WithOverflowPolicy(OverflowBlock),
+	)
+
+	// the worker takes the first task, the second task fills the queue, and
+	// the third task blocks.
+	require.True(t, pool.submit(context.Background(), conns, "testChannel", nil, func(*DeliveryResult) {}))
+	<-sender.started
+	require.True(t, pool.submit(context.Background(), conns, "testChannel", nil, func(*DeliveryResult) {}))
+
+	blocked := make(chan *DeliveryResult, 1)
+	go pool.submit(context.Background(), conns, "testChannel", nil, func(r *DeliveryResult) { blocked <- r })
+	require.Eventually(t, func() bool {
+		return collector.FanoutQueueLengthGauge.Value() == 2
+	}, time.Second, time.Millisecond)
+
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		pool.close()
+	}()
+
+	select {
+	case result := <-blocked:
+		assert.Equal(t, 1, result.Dropped)
+	case <-time.After(time.Second):
+		t.Fatal("blocked task is not dropped")
+	}
+
+	close(sender.release)
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		t.Fatal("pool is not closed")
+	}
+}
+
+// TestFanoutPool_Closed doesn't accept new tasks after closing.
+func TestFanoutPool_Closed(t *testing.T) {
+	pool := newFanoutPool(newBlockingSender(), mock.NewCollector(), log.NewDefaultLogger())
+	pool.close()
+	pool.close()
+
+	conns := []common.ConnectionWrapper{mock.NewConnection(testConnectionIDs[0], nil, authNoopFunc)}
+	assert.False(t, pool.submit(context.Background(), conns, "testChannel", nil, func(*DeliveryResult) {}))
+}
+
+// TestDispatch_FanoutPool sends the public messages by using the fan-out
+// workers, and preserves the message order of each connection.
+func TestDispatch_FanoutPool(t *testing.T) {
+	const (
+		testChannel = channel.Channel("testChannel")
+		count       = 50
+	)
+
+	ctx := context.Background()
+	fullErr := errorx.NewChannelizeError(errorx.CodeOutboundBufferIsFull)
+	full := mock.NewConnection(testConnectionIDs[0], nil, authNoopFunc).WithError(fullErr)
+	conns := map[string]common.ConnectionWrapper{full.ID(): full}
+	for _, id := range testConnectionIDs[1:] {
+		conns[id] = mock.NewConnection(id, nil, authNoopFunc)
+	}
+
+	collector := mock.NewCollector()
+	dispatch := NewDispatch(
+		mock.NewStore(conns), collector, log.NewDefaultLogger(),
+		WithFanoutPool(WithFanoutWorkers(3), WithFanoutQueueSize(4)),
+	)
+
+	result, err := dispatch.SendPublicMessageWithResult(ctx, testChannel, "first")
+	require.Nil(t, err)
+	assert.Equal(t, &DeliveryResult{
+		Subscribers: len(conns),
+		Delivered:   len(conns) - 1,
+		Dropped:     1,
+		Failures:    []DeliveryFailure{{ConnectionID: full.ID(), Err: fullErr}},
+	}, result)
+
+	for i := 0; i < count; i++ {
+		require.Nil(t, dispatch.SendPublicMessage(ctx, testChannel, i))
+	}
+
+	// close waits until the workers send the queued messages.
+	dispatch.Close()
+	assert.NotZero(t, collector.FanoutQueueLatencyCount)
+
+	expected := []MessageOut{*newMessageOut(testChannel, "first")}
+	for i := 0; i < count; i++ {
+		expected = append(expected, *newMessageOut(testChannel, float64(i)))
+	}
+
+	for id, conn := range conns {
+		if id == full.ID() {
+			continue
+		}
+
+		assert.Equal(t, expected, receiveMessages(t, conn.(*mock.Connection), count+1))
+	}
+
+	// the messages are sent by the publisher goroutine after closing.
+	require.Nil(t, dispatch.SendPublicMessage(ctx, testChannel, "last"))
+	conn := conns[testConnectionIDs[1]].(*mock.Connection)
+	assert.Equal(t, []MessageOut{*newMessageOut(testChannel, "last")}, receiveMessages(t, conn, 1))
+}
+
+// TestDispatch_FanoutPool_Direct sends the direct messages by using the
+// fan-out workers, so they don't overtake the queued public messages.
+func TestDispatch_FanoutPool_Direct(t *testing.T) {
+	const count = 50
+
+	testChannel := channel.RegisterPublicChannel("fanout-direct-channel")
+	defer channel.UnregisterChannel(testChannel)
+
+	ctx := context.Background()
+	conn := mock.NewConnection(testConnectionIDs[0], nil, authNoopFunc)
+	dispatch := NewDispatch(
+		mock.NewStore(map[string]common.ConnectionWrapper{conn.ID(): conn}), mock.NewCollector(), log.NewDefaultLogger(),
+		WithFanoutPool(WithFanoutWorkers(1)),
+	)
+	defer dispatch.Close()
+
+	expected := make([]MessageOut, 0, count+1)
+	for i := 0; i < count; i++ {
+		require.Nil(t, dispatch.SendPublicMessage(ctx, testChannel, i))
+		expected = append(expected, *newMessageOut(testChannel, float64(i)))
+	}
+
+	// it returns after the worker sends the message.
+	require.Nil(t, dispatch.SendToConnection(ctx, conn.ID(), testChannel, "direct"))
+	expected = append(expected, *newMessageOut(testChannel, "direct"))
+
+	assert.Len(t, conn.Message(), count+1)
+	assert.Equal(t, expected, receiveMessages(t, conn, count+1))
+}
+
+// TestDispatch_SendPublicMessageAsync_FanoutPool calls the callback after the
+// fan-out workers send the message to all the connections.
+func TestDispatch_SendPublicMessageAsync_FanoutPool(t *testing.T) {
+	ctx := context.Background()
+	conns := make(map[string]common.ConnectionWrapper)
+	for _, id := range testConnectionIDs {
+		conns[id] = mock.NewConnection(id, nil, authNoopFunc)
+	}
+
+	dispatch := NewDispatch(
+		mock.NewStore(conns), mock.NewCollector(), log.NewDefaultLogger(),
+		WithFanoutPool(WithFanoutWorkers(2)),
+	)
+	defer dispatch.Close()
+
+	done := make(chan *DeliveryResult, 1)
+	dispatch.SendPublicMessageAsync(ctx, "testChannel", expectedData, func(result *DeliveryResult, err error) {
+		assert.Nil(t, err)
+		done <- result
+	})
+
+	select {
+	case result := <-done:
+		assert.Equal(t, &DeliveryResult{Subscribers: len(conns), Delivered: len(conns)}, result)
+	case <-time.After(time.Second):
+		t.Fatal("callback is not called")
+	}
+
+	errs := make(chan error, 1)
+	dispatch.SendPublicMessageAsync(ctx, "testChannel", complex64(1), func(result *DeliveryResult, err error) {
+		assert.Nil(t, result)
+		errs <- err
+	})
+	assert.NotNil(t, <-errs)
+}
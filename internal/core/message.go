@@ -6,6 +6,7 @@ package core
 
 import (
 	"encoding/json"
+	"errors"
 	"strings"
 
 	"github.com/hmdsefi/channelize/internal/channel"
@@ -20,12 +21,39 @@ const (
 	// MessageTypeUnsubscribe unsubscribes client from the channels that has been
 	// already subscribed by the client.
 	MessageTypeUnsubscribe MessageType = "unsubscribe"
+
+	// MessageTypeRefresh replaces the connection auth token with a new token
+	// without changing the subscriptions.
+	MessageTypeRefresh MessageType = "refresh"
+
+	// MessageTypePublish publishes the client message to a channel that
+	// accepts the client messages.
+	MessageTypePublish MessageType = "publish"
+)
+
+const (
+	// AuthEventTokenRefreshed acknowledges that the connection token has been refreshed.
+	AuthEventTokenRefreshed = "token_refreshed"
+
+	// AuthEventTokenExpiring notifies the client that the connection token is
+	// about to expire and should be refreshed.
+	AuthEventTokenExpiring = "token_expiring"
+
+	// AuthEventTokenExpired notifies the client that the connection token is
+	// expired and the private channel subscriptions have been revoked.
+	AuthEventTokenExpired = "token_expired"
+
+	// AuthEventSubscriptionsRevoked notifies the client that the server has
+	// revoked the connection token and the private channel subscriptions.
+	AuthEventSubscriptionsRevoked = "subscriptions_revoked"
 )
 
 var (
 	supportedMessageTypes = map[MessageType]struct{}{
 		MessageTypeSubscribe:   {},
 		MessageTypeUnsubscribe: {},
+		MessageTypeRefresh:     {},
+		MessageTypePublish:     {},
 	}
 )
 
@@ -44,9 +72,19 @@ func (m MessageType) isSupportedMessageType() bool {
 	return ok
 }
 
+// IsBuiltinMessageType returns true if the input message type is handled by
+// Channelize itself, so it can't be used as a custom message type.
+func IsBuiltinMessageType(messageType string) bool {
+	return MessageType(messageType).isSupportedMessageType()
+}
+
 type paramIn struct {
 	Channels []channel.Channel `json:"channels"`
 	Token    *string           `json:"token"`
+
+	// Channel and Data are the params of the publish message.
+	Channel channel.Channel `json:"channel"`
+	Data    json.RawMessage `json:"data"`
 }
 
 // HasToken returns true if token field is not nil or empty string.
@@ -58,9 +96,14 @@ func (p paramIn) HasToken() bool {
 // some parameters that server needs to do the action.
 //
 // An action is a MessageType and parameters stored in paramsIn struct.
+// RawParams keeps the params object as is, e.g. for the snapshot providers
+// and the custom message handlers. ID is an optional value that is set by
+// the client to correlate the reply of a custom message.
 type messageIn struct {
-	MessageType MessageType `json:"type"`
-	Params      paramIn     `json:"params"`
+	ID          string          `json:"id,omitempty"`
+	MessageType MessageType     `json:"type"`
+	Params      paramIn         `json:"-"`
+	RawParams   json.RawMessage `json:"params"`
 }
 
 // UnmarshalMessageIn deserializes the input slice of bytes that has
@@ -71,18 +114,54 @@ func UnmarshalMessageIn(data []byte) (*messageIn, error) {
 		return nil, errorx.NewChannelizeErrorWithErr(errorx.CodeFailedToUnmarshalMessage, err)
 	}
 
+	// the params of the custom messages don't need to match the paramIn.
+	if len(msgIn.RawParams) != 0 {
+		err := json.Unmarshal(msgIn.RawParams, &msgIn.Params)
+		if err != nil && msgIn.MessageType.isSupportedMessageType() {
+			return nil, errorx.NewChannelizeErrorWithErr(errorx.CodeFailedToUnmarshalMessage, err)
+		}
+	}
+
 	return &msgIn, nil
 }
 
 // Validate validates all the fields that client sent to the server.
 // Input parameters should be matched with action.
 func (m messageIn) Validate() *validation.Result {
+	return m.validate(m.Params.HasToken())
+}
+
+// ValidateAuthenticated validates the inbound message of a connection that
+// has been already authenticated, e.g. during the websocket handshake. The
+// private channels don't need the token parameter.
+func (m messageIn) ValidateAuthenticated() *validation.Result {
+	return m.validate(true)
+}
+
+// validate validates the message fields. If authenticated is false, the
+// private channels are not allowed.
+func (m messageIn) validate(authenticated bool) *validation.Result {
 	out := new(validation.Result)
 
 	if !m.MessageType.isSupportedMessageType() {
 		out.AddFieldError(validation.FieldType, errorx.ErrorMsgUnsupportedMessageType)
 	}
 
+	// refresh message only needs the token.
+	if m.MessageType == MessageTypeRefresh {
+		if !m.Params.HasToken() {
+			out.AddFieldError(validation.FieldToken, errorx.ErrorMsgTokenIsEmpty)
+		}
+
+		return out
+	}
+
+	// publish message needs a channel that accepts the client messages.
+	if m.MessageType == MessageTypePublish {
+		m.validatePublish(out, authenticated)
+		return out
+	}
+
 	if len(m.Params.Channels) == 0 {
 		out.AddFieldError(validation.FieldChannels, errorx.ErrorMsgChannelsIsEmpty)
 	}
@@ -107,7 +186,7 @@ func (m messageIn) Validate() *validation.Result {
 			}
 
 			// check if the channel is private, token should exist
-			if ch.IsSupportedPrivateChannel() && !m.Params.HasToken() {
+			if ch.IsSupportedPrivateChannel() && !authenticated {
 				out.AddFieldError(
 					validation.SubField(validation.FieldChannels, ch.String()),
 					errorx.ErrorMsgAuthTokenIsMissing,
@@ -119,14 +198,130 @@ func (m messageIn) Validate() *validation.Result {
 	return out
 }
 
+// validatePublish validates the params of the publish message.
+func (m messageIn) validatePublish(out *validation.Result, authenticated bool) {
+	ch := m.Params.Channel
+	switch {
+	case ch == "":
+		out.AddFieldError(validation.FieldChannel, errorx.ErrorMsgChannelIsEmpty)
+	case !ch.IsSupportedChannel():
+		out.AddFieldError(validation.SubField(validation.FieldChannel, ch.String()), errorx.ErrorMsgUnsupportedChannel)
+	case !ch.AllowClientPublish():
+		out.AddFieldError(validation.SubField(validation.FieldChannel, ch.String()), errorx.ErrorMsgClientPublishNotAllowed)
+	case ch.IsSupportedPrivateChannel() && !authenticated:
+		out.AddFieldError(validation.SubField(validation.FieldChannel, ch.String()), errorx.ErrorMsgAuthTokenIsMissing)
+	}
+}
+
 // MessageOut represents the outbound message. Each the outbound message
 // includes a channel name that the message belongs to it, and the data
 // that is the main content.
 type MessageOut struct {
-	Channel channel.Channel `json:"channel"`
-	Data    interface{}     `json:"data"`
+	Channel  channel.Channel  `json:"channel"`
+	Data     interface{}      `json:"data"`
+	Metadata *MessageMetadata `json:"metadata,omitempty"`
+}
+
+// MessageMetadata represents the optional details of the outbound message
+// that are not part of its content.
+type MessageMetadata struct {
+	// TraceID is the trace ID of the publisher span. It is set only if the
+	// trace ID injection is enabled and the message is traced.
+	TraceID string `json:"trace_id,omitempty"`
+
+	// Snapshot is true if the message contains the current state of the
+	// channel that is sent after subscribing to the channel.
+	Snapshot bool `json:"snapshot,omitempty"`
+
+	// Presence is true if the message is a join or leave event of a presence
+	// channel, and not a message that is published to the channel.
+	Presence bool `json:"presence,omitempty"`
 }
 
 func newMessageOut(channel channel.Channel, data interface{}) *MessageOut {
 	return &MessageOut{Channel: channel, Data: data}
 }
+
+// NewSnapshotMessageOut creates an outbound message that contains the current
+// state of the input channel.
+func NewSnapshotMessageOut(channel channel.Channel, data interface{}) *MessageOut {
+	return &MessageOut{Channel: channel, Data: data, Metadata: &MessageMetadata{Snapshot: true}}
+}
+
+// NewPresenceMessageOut creates an outbound message that contains a join or
+// leave event of the input presence channel.
+func NewPresenceMessageOut(channel channel.Channel, event PresenceEventOut) *MessageOut {
+	return &MessageOut{Channel: channel, Data: event, Metadata: &MessageMetadata{Presence: true}}
+}
+
+// ErrorOut represents the content of the outbound messages that are sent to
+// the error channel.
+type ErrorOut struct {
+	Code    int         `json:"code,omitempty"`
+	Message string      `json:"message"`
+	Details interface{} `json:"details,omitempty"`
+}
+
+// NewErrorMessageOut creates an outbound message for the error channel. If
+// the input error is an errorx.ChannelizeError, it adds the error code to
+// the message.
+func NewErrorMessageOut(err error) *MessageOut {
+	return newMessageOut(channel.ErrorChannel, newErrorOut(err))
+}
+
+func newErrorOut(err error) ErrorOut {
+	errOut := ErrorOut{Message: err.Error()}
+
+	var chErr *errorx.ChannelizeError
+	if errors.As(err, &chErr) {
+		errOut.Code = chErr.Code
+	}
+
+	return errOut
+}
+
+// NewValidationErrorMessageOut creates an outbound message for the error
+// channel that includes the field errors of the input validation result.
+func NewValidationErrorMessageOut(res *validation.Result) *MessageOut {
+	return newMessageOut(channel.ErrorChannel, ErrorOut{
+		Code:    errorx.CodeInvalidMessage,
+		Message: errorx.ErrorMsgInvalidMessage,
+		Details: res.FieldErrors,
+	})
+}
+
+// AuthEventOut represents the content of the outbound messages that are sent
+// to the auth channel.
+type AuthEventOut struct {
+	Type      string `json:"type"`
+	ExpiresAt int64  `json:"expires_at,omitempty"`
+}
+
+// NewAuthEventMessageOut creates an outbound message for the auth channel.
+func NewAuthEventMessageOut(eventType string, expiresAt int64) *MessageOut {
+	return newMessageOut(channel.AuthChannel, AuthEventOut{Type: eventType, ExpiresAt: expiresAt})
+}
+
+// ReplyOut represents the content of the outbound messages that are sent to
+// the reply channel. It contains either the result or the error.
+type ReplyOut struct {
+	ID     string      `json:"id"`
+	Type   MessageType `json:"type"`
+	Result interface{} `json:"result,omitempty"`
+	Error  *ErrorOut   `json:"error,omitempty"`
+}
+
+// NewReplyMessageOut creates an outbound message for the reply channel. The
+// input id and messageType are the values of the inbound message. If err is
+// not nil, the reply contains the error instead of the result.
+func NewReplyMessageOut(id string, messageType MessageType, result interface{}, err error) *MessageOut {
+	replyOut := ReplyOut{ID: id, Type: messageType}
+	if err != nil {
+		errOut := newErrorOut(err)
+		replyOut.Error = &errOut
+	} else {
+		replyOut.Result = result
+	}
+
+	return newMessageOut(channel.ReplyChannel, replyOut)
+}
@@ -5,6 +5,7 @@
 package core
 
 import (
+	"encoding/json"
 	"errors"
 	"testing"
 
@@ -30,6 +31,7 @@ func TestUnmarshalMessageIn(t *testing.T) {
 				"feed",
 			},
 		},
+		RawParams: json.RawMessage(`{"channels":["notification","alert","feed"]}`),
 	}
 
 	correctJSONString := `{"type":"subscribe","params":{"channels":["notification","alert","feed"]}}`
@@ -144,6 +146,19 @@ func TestMessageIn_Validate(t *testing.T) {
 		)
 		assert.Equal(t, expectedResult, result)
 	})
+
+	t.Run("valid messageIn: authenticated private channels", func(t *testing.T) {
+		validMsg := messageIn{
+			MessageType: MessageTypeSubscribe,
+			Params: paramIn{
+				Channels: append(channels, privateChannel),
+			},
+		}
+
+		result := validMsg.ValidateAuthenticated()
+		expectedResult := new(validation.Result)
+		assert.Equal(t, expectedResult, result)
+	})
 }
 
 func registerChannels() []channel.Channel {
@@ -160,3 +175,165 @@ func registerChannels() []channel.Channel {
 
 	return channels
 }
+
+func TestNewErrorMessageOut(t *testing.T) {
+	t.Run("channelize error", func(t *testing.T) {
+		msgOut := NewErrorMessageOut(errorx.NewChannelizeError(errorx.CodeRateLimitExceeded))
+		assert.Equal(t, channel.ErrorChannel, msgOut.Channel)
+		assert.Equal(t, ErrorOut{
+			Code:    errorx.CodeRateLimitExceeded,
+			Message: errorx.ErrorMsgRateLimitExceeded,
+		}, msgOut.Data)
+	})
+
+	t.Run("other errors", func(t *testing.T) {
+		msgOut := NewErrorMessageOut(errors.New("test error"))
+		assert.Equal(t, channel.ErrorChannel, msgOut.Channel)
+		assert.Equal(t, ErrorOut{Message: "test error"}, msgOut.Data)
+	})
+}
+
+func TestNewValidationErrorMessageOut(t *testing.T) {
+	res := new(validation.Result)
+	res.AddFieldError(validation.FieldType, errorx.ErrorMsgUnsupportedMessageType)
+
+	msgOut := NewValidationErrorMessageOut(res)
+	assert.Equal(t, channel.ErrorChannel, msgOut.Channel)
+	assert.Equal(t, ErrorOut{
+		Code:    errorx.CodeInvalidMessage,
+		Message: errorx.ErrorMsgInvalidMessage,
+		Details: res.FieldErrors,
+	}, msgOut.Data)
+}
+
+func TestMessageIn_Validate_Refresh(t *testing.T) {
+	t.Run("valid refresh message", func(t *testing.T) {
+		testAuthToken := "test-auth-token" // nolint
+		msg := messageIn{
+			MessageType: MessageTypeRefresh,
+			Params: paramIn{
+				Token: &testAuthToken,
+			},
+		}
+
+		assert.Equal(t, new(validation.Result), msg.Validate())
+	})
+
+	t.Run("missing token", func(t *testing.T) {
+		msg := messageIn{MessageType: MessageTypeRefresh}
+
+		expectedResult := new(validation.Result)
+		expectedResult.AddFieldError(validation.FieldToken, errorx.ErrorMsgTokenIsEmpty)
+		assert.Equal(t, expectedResult, msg.Validate())
+	})
+}
+
+func TestMessageIn_Validate_Publish(t *testing.T) {
+	room := channel.RegisterPrivateChannel("validate-publish-room", channel.WithClientPublish(nil))
+	news := channel.RegisterPublicChannel("validate-publish-news")
+	defer channel.UnregisterChannel(room)
+	defer channel.UnregisterChannel(news)
+
+	tests := []struct {
+		name          string
+		ch            channel.Channel
+		authenticated bool
+		field         string
+		err           string
+	}{
+		{name: "valid publish message", ch: room, authenticated: true},
+		{name: "missing channel", field: validation.FieldChannel, err: errorx.ErrorMsgChannelIsEmpty},
+		{
+			name:  "unsupported channel",
+			ch:    "validate-publish-unknown",
+			field: validation.SubField(validation.FieldChannel, "validate-publish-unknown"),
+			err:   errorx.ErrorMsgUnsupportedChannel,
+		},
+		{
+			name:          "client publish is not allowed",
+			ch:            news,
+			authenticated: true,
+			field:         validation.SubField(validation.FieldChannel, news.String()),
+			err:           errorx.ErrorMsgClientPublishNotAllowed,
+		},
+		{
+			name:  "private channel without token",
+			ch:    room,
+			field: validation.SubField(validation.FieldChannel, room.String()),
+			err:   errorx.ErrorMsgAuthTokenIsMissing,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg := messageIn{
+				MessageType: MessageTypePublish,
+				Params:      paramIn{Channel: tt.ch, Data: json.RawMessage(`"hi"`)},
+			}
+
+			validate := msg.Validate
+			if tt.authenticated {
+				validate = msg.ValidateAuthenticated
+			}
+
+			expectedResult := new(validation.Result)
+			if tt.err != "" {
+				expectedResult.AddFieldError(tt.field, tt.err)
+			}
+			assert.Equal(t, expectedResult, validate())
+		})
+	}
+}
+
+func TestNewSnapshotMessageOut(t *testing.T) {
+	data, err := json.Marshal(NewSnapshotMessageOut("balances", map[string]int{"btc": 2}))
+	require.Nil(t, err)
+	assert.JSONEq(t, `{"channel":"balances","data":{"btc":2},"metadata":{"snapshot":true}}`, string(data))
+}
+
+func TestNewPresenceMessageOut(t *testing.T) {
+	data, err := json.Marshal(NewPresenceMessageOut("chat", PresenceEventOut{Type: PresenceEventJoin, UserID: "1"}))
+	require.Nil(t, err)
+	assert.JSONEq(t, `{"channel":"chat","data":{"type":"join","user_id":"1"},"metadata":{"presence":true}}`, string(data))
+}
+
+// TestUnmarshalMessageIn_Custom unmarshals a custom message with params that
+// don't match the built-in params.
+func TestUnmarshalMessageIn_Custom(t *testing.T) {
+	msg, err := UnmarshalMessageIn([]byte(`{"id":"7","type":"place_order","params":{"channels":3}}`))
+	require.Nil(t, err)
+	assert.Equal(t, "7", msg.ID)
+	assert.Equal(t, MessageType("place_order"), msg.MessageType)
+	assert.Equal(t, json.RawMessage(`{"channels":3}`), msg.RawParams)
+
+	_, err = UnmarshalMessageIn([]byte(`{"type":"subscribe","params":{"channels":3}}`))
+	var chanErr *errorx.ChannelizeError
+	require.True(t, errors.As(err, &chanErr))
+	assert.Equal(t, errorx.CodeFailedToUnmarshalMessage, chanErr.Code)
+}
+
+func TestIsBuiltinMessageType(t *testing.T) {
+	assert.True(t, IsBuiltinMessageType("subscribe"))
+	assert.True(t, IsBuiltinMessageType("refresh"))
+	assert.False(t, IsBuiltinMessageType("place_order"))
+}
+
+func TestNewReplyMessageOut(t *testing.T) {
+	data, err := json.Marshal(NewReplyMessageOut("7", "place_order", map[string]string{"order_id": "42"}, nil))
+	require.Nil(t, err)
+	assert.JSONEq(t, `{"channel":"reply","data":{"id":"7","type":"place_order","result":{"order_id":"42"}}}`, string(data))
+
+	data, err = json.Marshal(NewReplyMessageOut("8", "place_order", nil, errorx.NewChannelizeError(errorx.CodeAccessDenied)))
+	require.Nil(t, err)
+	assert.JSONEq(
+		t,
+		`{"channel":"reply","data":{"id":"8","type":"place_order","error":{"code":2003,"message":"access to the channel is denied"}}}`,
+		string(data),
+	)
+}
+
+func TestNewAuthEventMessageOut(t *testing.T) {
+	msgOut := NewAuthEventMessageOut(AuthEventTokenExpiring, 42)
+	assert.Equal(t, channel.AuthChannel, msgOut.Channel)
+	assert.Equal(t, AuthEventOut{Type: AuthEventTokenExpiring, ExpiresAt: 42}, msgOut.Data)
+}
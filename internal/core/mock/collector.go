@@ -7,6 +7,7 @@ package mock
 import (
 	"sync"
 	"sync/atomic"
+	"time"
 )
 
 type atomicFloat64 struct {
@@ -28,9 +29,21 @@ func (a *atomicFloat64) Value() float64 {
 
 type Collector struct {
 	PrivateConnectionsGauge int32
+	ExpiredTokensCount      int32
+	ReauthenticatedCount    int32
+	PublishedCount          int32
+	DeliveredCount          int32
+	DroppedCount            int32
+	AuthFailuresCount       int32
+	SubscriptionsCount      int32
+	UnsubscriptionsCount    int32
+	MarshalCount            int32
+	FanoutCount             int32
+	FanoutQueueLatencyCount int32
 	SubscribedChannelsCount *atomicFloat64
 	OpenConnectionsCount    *atomicFloat64
 	PrivateConnectionsCount *atomicFloat64
+	FanoutQueueLengthGauge  *atomicFloat64
 }
 
 func NewCollector() *Collector {
@@ -38,6 +51,7 @@ func NewCollector() *Collector {
 		SubscribedChannelsCount: new(atomicFloat64),
 		OpenConnectionsCount:    new(atomicFloat64),
 		PrivateConnectionsCount: new(atomicFloat64),
+		FanoutQueueLengthGauge:  new(atomicFloat64),
 	}
 }
 
@@ -60,3 +74,51 @@ func (c *Collector) PrivateConnections(val float64) {
 func (c *Collector) OpenConnections(val float64) {
 	c.OpenConnectionsCount.Set(val)
 }
+
+func (c *Collector) ExpiredTokensInc() {
+	atomic.AddInt32(&c.ExpiredTokensCount, 1)
+}
+
+func (c *Collector) ReauthenticatedTokensInc() {
+	atomic.AddInt32(&c.ReauthenticatedCount, 1)
+}
+
+func (c *Collector) MessagesPublishedInc(_ string) {
+	atomic.AddInt32(&c.PublishedCount, 1)
+}
+
+func (c *Collector) MessagesDeliveredInc(_ string) {
+	atomic.AddInt32(&c.DeliveredCount, 1)
+}
+
+func (c *Collector) MessagesDroppedInc(_ string, _ string) {
+	atomic.AddInt32(&c.DroppedCount, 1)
+}
+
+func (c *Collector) AuthFailuresInc() {
+	atomic.AddInt32(&c.AuthFailuresCount, 1)
+}
+
+func (c *Collector) SubscriptionsInc(_ string) {
+	atomic.AddInt32(&c.SubscriptionsCount, 1)
+}
+
+func (c *Collector) UnsubscriptionsInc(_ string) {
+	atomic.AddInt32(&c.UnsubscriptionsCount, 1)
+}
+
+func (c *Collector) MarshalDurationObserve(_ string, _ time.Duration) {
+	atomic.AddInt32(&c.MarshalCount, 1)
+}
+
+func (c *Collector) FanoutDurationObserve(_ string, _ time.Duration) {
+	atomic.AddInt32(&c.FanoutCount, 1)
+}
+
+func (c *Collector) FanoutQueueLength(in float64) {
+	c.FanoutQueueLengthGauge.Set(in)
+}
+
+func (c *Collector) FanoutQueueLatencyObserve(_ time.Duration) {
+	atomic.AddInt32(&c.FanoutQueueLatencyCount, 1)
+}
@@ -4,12 +4,29 @@
 
 package mock
 
+import (
+	"context"
+
+	"github.com/hmdsefi/channelize/auth"
+	"github.com/hmdsefi/channelize/internal/common"
+	"github.com/hmdsefi/channelize/internal/common/utils"
+)
+
+type CloseFrame struct {
+	Code   int
+	Reason string
+}
+
 type Connection struct {
 	id       string
 	userID   *string
+	token    *auth.Token
 	err      error
 	send     chan []byte
+	closed   chan CloseFrame
+	revoked  chan struct{}
 	authFunc func() error
+	tags     map[string]struct{}
 }
 
 func NewConnection(id string, userID *string, authFunc func() error) *Connection {
@@ -17,7 +34,10 @@ func NewConnection(id string, userID *string, authFunc func() error) *Connection
 		id:       id,
 		userID:   userID,
 		send:     make(chan []byte, 256),
+		closed:   make(chan CloseFrame, 1),
+		revoked:  make(chan struct{}, 1),
 		authFunc: authFunc,
+		tags:     make(map[string]struct{}),
 	}
 }
 
@@ -29,7 +49,29 @@ func (c Connection) UserID() *string {
 	return c.userID
 }
 
-func (c Connection) Authenticate() error {
+func (c Connection) Token() *auth.Token {
+	return c.token
+}
+
+func (c Connection) IsAuthenticated() bool {
+	return c.token != nil && utils.Now().Unix() < c.token.ExpiresAt
+}
+
+func (c Connection) Info() common.ConnectionInfo {
+	info := common.ConnectionInfo{
+		ID:        c.id,
+		BufferLen: len(c.send),
+		BufferCap: cap(c.send),
+	}
+
+	if c.userID != nil {
+		info.UserID = *c.userID
+	}
+
+	return info
+}
+
+func (c Connection) Authenticate(_ context.Context) error {
 	return c.authFunc()
 }
 
@@ -42,16 +84,60 @@ func (c Connection) SendMessage(data []byte) error {
 	return nil
 }
 
+func (c Connection) SendMessageContext(_ context.Context, data []byte) error {
+	return c.SendMessage(data)
+}
+
 func (c Connection) Message() <-chan []byte {
 	return c.send
 }
 
+func (c Connection) RevokeToken() {
+	c.revoked <- struct{}{}
+}
+
+func (c Connection) Revoked() <-chan struct{} {
+	return c.revoked
+}
+
+func (c Connection) CloseWithReason(code int, reason string) error {
+	c.closed <- CloseFrame{Code: code, Reason: reason}
+	return c.err
+}
+
+func (c Connection) CloseFrame() <-chan CloseFrame {
+	return c.closed
+}
+
 func (c Connection) Close() {
 	close(c.send)
 }
 
+func (c Connection) HasTag(tag string) bool {
+	_, ok := c.tags[tag]
+	return ok
+}
+
+func (c Connection) AddTags(tags ...string) {
+	for _, tag := range tags {
+		c.tags[tag] = struct{}{}
+	}
+}
+
+func (c Connection) RemoveTags(tags ...string) {
+	for _, tag := range tags {
+		delete(c.tags, tag)
+	}
+}
+
 func (c Connection) WithError(err error) Connection {
 	conn := c
 	conn.err = err
 	return conn
 }
+
+func (c Connection) WithToken(token *auth.Token) Connection {
+	conn := c
+	conn.token = token
+	return conn
+}
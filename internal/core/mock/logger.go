@@ -5,7 +5,7 @@
 package mock
 
 import (
-	"github.com/hmdsefi/channelize/internal/common/log"
+	"github.com/hmdsefi/channelize/log"
 	"github.com/stretchr/testify/assert"
 	"testing"
 )
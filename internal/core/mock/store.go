@@ -37,10 +37,33 @@ func (s Store) Connections(_ context.Context, _ channel.Channel) []common.Connec
 	return s.connections
 }
 
+func (s Store) AllConnections(_ context.Context) []common.ConnectionWrapper {
+	return s.connections
+}
+
 func (s Store) ConnectionByUserID(_ context.Context, _ channel.Channel, userID string) common.ConnectionWrapper {
 	return s.userConnections[userID]
 }
 
+func (s Store) Connection(_ context.Context, connID string) common.ConnectionWrapper {
+	for _, conn := range s.connections {
+		if conn.ID() == connID {
+			return conn
+		}
+	}
+
+	return nil
+}
+
+func (s Store) ConnectionsByChannels(_ context.Context, channels []channel.Channel) map[channel.Channel][]common.ConnectionWrapper {
+	out := make(map[channel.Channel][]common.ConnectionWrapper, len(channels))
+	for _, ch := range channels {
+		out[ch] = s.connections
+	}
+
+	return out
+}
+
 func (s Store) Receive() string {
 	return <-s.send
 }
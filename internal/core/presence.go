@@ -0,0 +1,288 @@
+/**
+ * Copyright © 2022 Hamed Yousefi <hdyousefi@gmail.com>.
+ */
+
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"sync"
+
+	"github.com/hmdsefi/channelize/internal/channel"
+	"github.com/hmdsefi/channelize/internal/common"
+	"github.com/hmdsefi/channelize/internal/common/errorx"
+	"github.com/hmdsefi/channelize/log"
+)
+
+const (
+	// PresenceEventJoin notifies the channel subscribers that a user has
+	// subscribed to the channel for the first time.
+	PresenceEventJoin = "join"
+
+	// PresenceEventLeave notifies the channel subscribers that the last
+	// connection of a user has unsubscribed from the channel.
+	PresenceEventLeave = "leave"
+)
+
+// PresenceEventOut represents the content of the join and leave events that
+// are sent to the presence channels.
+type PresenceEventOut struct {
+	Type   string `json:"type"`
+	UserID string `json:"user_id"`
+}
+
+// PresenceMembers represents the current members of a presence channel.
+type PresenceMembers struct {
+	// UserIDs is the sorted list of the authenticated users that subscribed
+	// to the channel.
+	UserIDs []string
+
+	// Connections is the number of connections that subscribed to the
+	// channel, including the anonymous connections.
+	Connections int
+}
+
+// presenceEvent is a join or leave event that should be sent to a channel.
+type presenceEvent struct {
+	channel channel.Channel
+	out     PresenceEventOut
+}
+
+// PresenceCache wraps the Cache and tracks the users of the presence channels.
+// It counts the connections of each user per channel, so a user joins a channel
+// with the first connection and leaves it with the last one.
+//
+// If the events are enabled for a presence channel, the join and leave events
+// are sent to all the connections that subscribed to that channel. The events
+// are marked as presence in the message metadata. Only the authenticated
+// connections generate events.
+//
+// The joins and leaves are serialized by mu, and the join only counts the
+// channels that the connection still subscribed in the Cache. So a connection
+// that is removed before its join doesn't remain as a member.
+type PresenceCache struct {
+	*Cache
+
+	mu sync.Mutex
+
+	// channels stores the presence channels. The value shows if the join
+	// and leave events should be sent to the channel.
+	channels map[channel.Channel]bool
+
+	// members stores the number of connections per user for each channel.
+	members map[channel.Channel]map[string]int
+
+	// connections stores the presence channels of each connection with the
+	// userID that has been counted for them.
+	connections map[string]map[channel.Channel]string
+
+	logger log.Logger
+}
+
+// NewPresenceCache creates a new instance of PresenceCache. The input channels
+// map enables the presence for its keys, and the values enable the join and
+// leave events.
+func NewPresenceCache(cache *Cache, logger log.Logger, channels map[channel.Channel]bool) *PresenceCache {
+	if channels == nil {
+		channels = make(map[channel.Channel]bool)
+	}
+
+	return &PresenceCache{
+		Cache:       cache,
+		channels:    channels,
+		members:     make(map[channel.Channel]map[string]int),
+		connections: make(map[string]map[channel.Channel]string),
+		logger:      logger,
+	}
+}
+
+// Members returns the current members of the input channel. It returns error
+// if the presence is not enabled for the channel.
+func (p *PresenceCache) Members(ctx context.Context, ch channel.Channel) (*PresenceMembers, error) {
+	if _, enabled := p.channels[ch]; !enabled {
+		return nil, errorx.NewChannelizeError(errorx.CodePresenceIsDisabled)
+	}
+
+	p.mu.Lock()
+	userIDs := make([]string, 0, len(p.members[ch]))
+	for userID := range p.members[ch] {
+		userIDs = append(userIDs, userID)
+	}
+	p.mu.Unlock()
+
+	sort.Strings(userIDs)
+
+	return &PresenceMembers{
+		UserIDs:     userIDs,
+		Connections: len(p.Cache.Connections(ctx, ch)),
+	}, nil
+}
+
+// Subscribe stores the subscription in the Cache and joins the connection user
+// to the presence channels that the connection subscribed.
+func (p *PresenceCache) Subscribe(ctx context.Context, conn common.ConnectionWrapper, channels ...channel.Channel) {
+	p.Cache.Subscribe(ctx, conn, channels...)
+
+	userID := conn.UserID()
+	if len(p.channels) == 0 || userID == nil {
+		return
+	}
+
+	p.join(ctx, conn.ID(), *userID)
+}
+
+// Unsubscribe removes the subscriptions from the Cache and leaves the input
+// presence channels.
+func (p *PresenceCache) Unsubscribe(ctx context.Context, connID string, channels ...channel.Channel) {
+	p.Cache.Unsubscribe(ctx, connID, channels...)
+	p.leave(ctx, connID, func(ch channel.Channel) bool {
+		for i := range channels {
+			if channels[i] == ch {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// UnsubscribeUserID removes the subscription from the Cache and leaves the
+// input presence channel.
+func (p *PresenceCache) UnsubscribeUserID(ctx context.Context, connID string, userID string, ch channel.Channel) {
+	p.Cache.UnsubscribeUserID(ctx, connID, userID, ch)
+	p.leave(ctx, connID, func(presenceChannel channel.Channel) bool {
+		return presenceChannel == ch
+	})
+}
+
+// UnsubscribePrivateChannels removes the private subscriptions from the Cache
+// and leaves the private presence channels.
+func (p *PresenceCache) UnsubscribePrivateChannels(ctx context.Context, connID string, userID string) {
+	p.Cache.UnsubscribePrivateChannels(ctx, connID, userID)
+	p.leave(ctx, connID, func(ch channel.Channel) bool {
+		return ch.IsSupportedPrivateChannel()
+	})
+}
+
+// Remove removes the connection from the Cache and leaves all the presence
+// channels of the connection.
+func (p *PresenceCache) Remove(ctx context.Context, connID string, userID *string) {
+	p.Cache.Remove(ctx, connID, userID)
+	p.leave(ctx, connID, func(channel.Channel) bool {
+		return true
+	})
+}
+
+// RemoveChannel removes the subscriptions of the input channel from the Cache
+// and the presence members of the channel.
+func (p *PresenceCache) RemoveChannel(ctx context.Context, ch channel.Channel) {
+	p.Cache.RemoveChannel(ctx, ch)
+
+	p.mu.Lock()
+	for connID, channels := range p.connections {
+		delete(channels, ch)
+		if len(channels) == 0 {
+			delete(p.connections, connID)
+		}
+	}
+	delete(p.members, ch)
+	p.mu.Unlock()
+}
+
+// join counts the input user for the presence channels that the connection
+// subscribed, and sends the join events if the user is a new member of the
+// channel.
+func (p *PresenceCache) join(ctx context.Context, connID string, userID string) {
+	var events []presenceEvent
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	// check all the connection channels, since the connection might have
+	// subscribed to some channels before the authentication. The channels
+	// are read under the lock, so a connection that has been unsubscribed
+	// or removed meanwhile doesn't join.
+	for _, ch := range p.Cache.Channels(ctx, connID) {
+		if _, enabled := p.channels[ch]; !enabled {
+			continue
+		}
+
+		if _, exists := p.connections[connID][ch]; exists {
+			continue
+		}
+
+		if _, exists := p.connections[connID]; !exists {
+			p.connections[connID] = make(map[channel.Channel]string)
+		}
+
+		if _, exists := p.members[ch]; !exists {
+			p.members[ch] = make(map[string]int)
+		}
+
+		p.connections[connID][ch] = userID
+		p.members[ch][userID]++
+
+		if p.members[ch][userID] == 1 && p.channels[ch] {
+			events = append(events, presenceEvent{channel: ch, out: PresenceEventOut{Type: PresenceEventJoin, UserID: userID}})
+		}
+	}
+
+	p.send(ctx, events)
+}
+
+// leave removes the connection from the presence channels that match the input
+// function, and sends the leave events if it was the last connection of the user.
+func (p *PresenceCache) leave(ctx context.Context, connID string, match func(ch channel.Channel) bool) {
+	var events []presenceEvent
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for ch, userID := range p.connections[connID] {
+		if !match(ch) {
+			continue
+		}
+
+		delete(p.connections[connID], ch)
+
+		p.members[ch][userID]--
+		if p.members[ch][userID] > 0 {
+			continue
+		}
+
+		delete(p.members[ch], userID)
+		if p.channels[ch] {
+			events = append(events, presenceEvent{channel: ch, out: PresenceEventOut{Type: PresenceEventLeave, UserID: userID}})
+		}
+	}
+
+	if len(p.connections[connID]) == 0 {
+		delete(p.connections, connID)
+	}
+
+	p.send(ctx, events)
+}
+
+// send sends the input events to the connections that subscribed to the
+// event channels. The caller must hold the lock, so the subscribers receive
+// the events in the order of the member changes.
+func (p *PresenceCache) send(ctx context.Context, events []presenceEvent) {
+	for _, event := range events {
+		msgOutBytes, err := json.Marshal(NewPresenceMessageOut(event.channel, event.out))
+		if err != nil {
+			p.logger.Error("failed to marshal presence event", common.LogFieldError, err.Error())
+			continue
+		}
+
+		for _, conn := range p.Cache.Connections(ctx, event.channel) {
+			if err = conn.SendMessage(msgOutBytes); err != nil {
+				p.logger.Error(
+					"failed to send presence event to the outbound buffer",
+					common.LogFieldID, conn.ID(),
+					common.LogFieldError, err.Error(),
+				)
+			}
+		}
+	}
+}
@@ -0,0 +1,165 @@
+/**
+ * Copyright © 2022 Hamed Yousefi <hdyousefi@gmail.com>.
+ */
+
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/hmdsefi/channelize/internal/channel"
+	"github.com/hmdsefi/channelize/internal/common/errorx"
+	"github.com/hmdsefi/channelize/internal/core/mock"
+	"github.com/hmdsefi/channelize/log"
+)
+
+type testPresenceEventOut struct {
+	Channel  channel.Channel  `json:"channel"`
+	Data     PresenceEventOut `json:"data"`
+	Metadata *MessageMetadata `json:"metadata"`
+}
+
+func readPresenceEvent(t *testing.T, conn *mock.Connection) PresenceEventOut {
+	var msgOut testPresenceEventOut
+	require.Nil(t, json.Unmarshal(<-conn.Message(), &msgOut))
+	require.NotNil(t, msgOut.Metadata)
+	assert.True(t, msgOut.Metadata.Presence)
+	return msgOut.Data
+}
+
+// TestPresenceCache_Members tracks the users of a presence channel.
+func TestPresenceCache_Members(t *testing.T) {
+	ctx := context.Background()
+	presenceChannel := channel.RegisterPublicChannel("presence-members-channel")
+	userID := "test-user-id"
+
+	cache := NewPresenceCache(NewCache(mock.NewCollector()), log.NewDefaultLogger(), map[channel.Channel]bool{
+		presenceChannel: false,
+	})
+
+	conn1 := mock.NewConnection(testConnectionIDs[0], &userID, authNoopFunc)
+	conn2 := mock.NewConnection(testConnectionIDs[1], &userID, authNoopFunc)
+	anonymousConn := mock.NewConnection(testConnectionIDs[2], nil, authNoopFunc)
+	cache.Subscribe(ctx, conn1, presenceChannel)
+	cache.Subscribe(ctx, conn2, presenceChannel)
+	cache.Subscribe(ctx, anonymousConn, presenceChannel)
+
+	members, err := cache.Members(ctx, presenceChannel)
+	require.Nil(t, err)
+	assert.Equal(t, &PresenceMembers{UserIDs: []string{userID}, Connections: 3}, members)
+
+	cache.Remove(ctx, conn1.ID(), conn1.UserID())
+	members, err = cache.Members(ctx, presenceChannel)
+	require.Nil(t, err)
+	assert.Equal(t, &PresenceMembers{UserIDs: []string{userID}, Connections: 2}, members)
+
+	cache.Unsubscribe(ctx, conn2.ID(), presenceChannel)
+	members, err = cache.Members(ctx, presenceChannel)
+	require.Nil(t, err)
+	assert.Equal(t, &PresenceMembers{UserIDs: []string{}, Connections: 1}, members)
+
+	// events are disabled for the channel.
+	assert.Empty(t, anonymousConn.Message())
+
+	t.Run("presence is disabled", func(t *testing.T) {
+		_, err := cache.Members(ctx, "presence-disabled-channel")
+		var chanErr *errorx.ChannelizeError
+		require.True(t, errors.As(err, &chanErr))
+		assert.Equal(t, errorx.CodePresenceIsDisabled, chanErr.Code)
+	})
+}
+
+// TestPresenceCache_Events sends the join and leave events to the subscribers.
+func TestPresenceCache_Events(t *testing.T) {
+	ctx := context.Background()
+	presenceChannel := channel.RegisterPublicChannel("presence-events-channel")
+	privatePresenceChannel := channel.RegisterPrivateChannel("presence-events-private-channel")
+	observerID := "observer-user-id"
+	userID := "test-user-id"
+
+	cache := NewPresenceCache(NewCache(mock.NewCollector()), log.NewDefaultLogger(), map[channel.Channel]bool{
+		presenceChannel:        true,
+		privatePresenceChannel: true,
+	})
+
+	observer := mock.NewConnection(testConnectionIDs[0], &observerID, authNoopFunc)
+	cache.Subscribe(ctx, observer, presenceChannel, privatePresenceChannel)
+	assert.Equal(t, PresenceEventOut{Type: PresenceEventJoin, UserID: observerID}, readPresenceEvent(t, observer))
+	assert.Equal(t, PresenceEventOut{Type: PresenceEventJoin, UserID: observerID}, readPresenceEvent(t, observer))
+
+	conn1 := mock.NewConnection(testConnectionIDs[1], &userID, authNoopFunc)
+	conn2 := mock.NewConnection(testConnectionIDs[2], &userID, authNoopFunc)
+
+	cache.Subscribe(ctx, conn1, presenceChannel)
+	assert.Equal(t, PresenceEventOut{Type: PresenceEventJoin, UserID: userID}, readPresenceEvent(t, observer))
+
+	// the second connection of the user doesn't join again.
+	cache.Subscribe(ctx, conn2, presenceChannel)
+	cache.Remove(ctx, conn1.ID(), conn1.UserID())
+	assert.Empty(t, observer.Message())
+
+	cache.Remove(ctx, conn2.ID(), conn2.UserID())
+	assert.Equal(t, PresenceEventOut{Type: PresenceEventLeave, UserID: userID}, readPresenceEvent(t, observer))
+
+	t.Run("revoke private channels", func(t *testing.T) {
+		cache.Subscribe(ctx, conn1, privatePresenceChannel)
+		assert.Equal(t, PresenceEventOut{Type: PresenceEventJoin, UserID: userID}, readPresenceEvent(t, observer))
+
+		cache.UnsubscribePrivateChannels(ctx, conn1.ID(), userID)
+		assert.Equal(t, PresenceEventOut{Type: PresenceEventLeave, UserID: userID}, readPresenceEvent(t, observer))
+	})
+}
+
+// TestPresenceCache_JoinAfterRemove doesn't join a connection that has been
+// removed before its join.
+func TestPresenceCache_JoinAfterRemove(t *testing.T) {
+	ctx := context.Background()
+	presenceChannel := channel.RegisterPublicChannel("presence-join-after-remove-channel")
+	userID := "test-user-id"
+
+	cache := NewPresenceCache(NewCache(mock.NewCollector()), log.NewDefaultLogger(), map[channel.Channel]bool{
+		presenceChannel: false,
+	})
+
+	// the leave of Remove runs between the subscription and the join.
+	conn := mock.NewConnection(testConnID, &userID, authNoopFunc)
+	cache.Cache.Subscribe(ctx, conn, presenceChannel)
+	cache.Remove(ctx, conn.ID(), conn.UserID())
+	cache.join(ctx, conn.ID(), userID)
+
+	members, err := cache.Members(ctx, presenceChannel)
+	require.Nil(t, err)
+	assert.Empty(t, members.UserIDs)
+	assert.Empty(t, cache.connections)
+}
+
+// TestPresenceCache_RemoveChannel removes the members of a removed channel.
+func TestPresenceCache_RemoveChannel(t *testing.T) {
+	ctx := context.Background()
+	presenceChannel := channel.RegisterPublicChannel("presence-remove-channel")
+	userID := "test-user-id"
+
+	cache := NewPresenceCache(NewCache(mock.NewCollector()), log.NewDefaultLogger(), map[channel.Channel]bool{
+		presenceChannel: false,
+	})
+
+	conn := mock.NewConnection(testConnID, &userID, authNoopFunc)
+	cache.Subscribe(ctx, conn, presenceChannel)
+	cache.RemoveChannel(ctx, presenceChannel)
+
+	members, err := cache.Members(ctx, presenceChannel)
+	require.Nil(t, err)
+	assert.Equal(t, &PresenceMembers{UserIDs: []string{}, Connections: 0}, members)
+
+	// subscribing again joins the channel.
+	cache.Subscribe(ctx, conn, presenceChannel)
+	members, err = cache.Members(ctx, presenceChannel)
+	require.Nil(t, err)
+	assert.Equal(t, []string{userID}, members.UserIDs)
+}
@@ -0,0 +1,119 @@
+/**
+ * Copyright © 2022 Hamed Yousefi <hdyousefi@gmail.com>.
+ */
+
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"unicode/utf8"
+
+	"github.com/hmdsefi/channelize/internal/common"
+	"github.com/hmdsefi/channelize/internal/common/errorx"
+	"github.com/hmdsefi/channelize/log"
+)
+
+const (
+	// maxCloseReasonLength is the maximum length of the close message reason.
+	// The control frame payload is limited to 125 bytes, and two bytes of
+	// it are used by the close code.
+	maxCloseReasonLength = 123
+)
+
+// revokerStore provides the connections to the Revoker.
+type revokerStore interface {
+	// Connection returns the connection with the input connID.
+	Connection(ctx context.Context, connID string) common.ConnectionWrapper
+
+	// ConnectionsByUserID returns all the connections of the input userID.
+	ConnectionsByUserID(ctx context.Context, userID string) []common.ConnectionWrapper
+
+	// UnsubscribePrivateChannels removes all the private channel subscriptions of
+	// the input connection, and removes the userID and connID mapping.
+	UnsubscribePrivateChannels(ctx context.Context, connID string, userID string)
+}
+
+// Revoker closes the connections or revokes their private subscriptions on
+// the server demand, e.g. when a user is banned.
+type Revoker struct {
+	store  revokerStore
+	logger log.Logger
+}
+
+// NewRevoker creates a new instance of Revoker.
+func NewRevoker(store revokerStore, logger log.Logger) *Revoker {
+	return &Revoker{
+		store:  store,
+		logger: logger,
+	}
+}
+
+// DisconnectUser closes all the connections of the input userID with the
+// input close code and reason. It returns the number of closed connections.
+func (r *Revoker) DisconnectUser(ctx context.Context, userID string, code int, reason string) int {
+	connections := r.store.ConnectionsByUserID(ctx, userID)
+	for _, conn := range connections {
+		r.close(conn, code, reason)
+	}
+
+	return len(connections)
+}
+
+// DisconnectConnection closes the connection with the input connID with the
+// input close code and reason. It returns error if the connection doesn't exist.
+func (r *Revoker) DisconnectConnection(ctx context.Context, connID string, code int, reason string) error {
+	conn := r.store.Connection(ctx, connID)
+	if conn == nil {
+		return errorx.NewChannelizeError(errorx.CodeConnectionNotFound)
+	}
+
+	r.close(conn, code, reason)
+
+	return nil
+}
+
+// RevokePrivateSubscriptions removes the private channel subscriptions and the
+// auth token of all the connections of the input userID, and notifies the
+// clients in the auth channel. The connections stay open with their public
+// subscriptions. It returns the number of revoked connections.
+func (r *Revoker) RevokePrivateSubscriptions(ctx context.Context, userID string) int {
+	connections := r.store.ConnectionsByUserID(ctx, userID)
+	for _, conn := range connections {
+		r.store.UnsubscribePrivateChannels(ctx, conn.ID(), userID)
+		conn.RevokeToken()
+
+		msgOutBytes, err := json.Marshal(NewAuthEventMessageOut(AuthEventSubscriptionsRevoked, 0))
+		if err != nil {
+			r.logger.Error("failed to marshal subscriptions revoked event", common.LogFieldID, conn.ID(), common.LogFieldError, err.Error())
+			continue
+		}
+
+		if err = conn.SendMessage(msgOutBytes); err != nil {
+			r.logger.Error(
+				"failed to send subscriptions revoked event to the outbound buffer",
+				common.LogFieldID, conn.ID(),
+				common.LogFieldError, err.Error(),
+			)
+		}
+	}
+
+	return len(connections)
+}
+
+// close writes the close message to the peer and closes the connection.
+func (r *Revoker) close(conn common.ConnectionWrapper, code int, reason string) {
+	if len(reason) > maxCloseReasonLength {
+		// truncate on a character boundary to keep the reason a valid UTF-8
+		// text.
+		i := maxCloseReasonLength
+		for i > 0 && !utf8.RuneStart(reason[i]) {
+			i--
+		}
+		reason = reason[:i]
+	}
+
+	if err := conn.CloseWithReason(code, reason); err != nil {
+		r.logger.Warn(errorx.ErrorMsgFailedToCloseConnection, common.LogFieldID, conn.ID(), common.LogFieldError, err.Error())
+	}
+}
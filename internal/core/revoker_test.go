@@ -0,0 +1,105 @@
+/**
+ * Copyright © 2022 Hamed Yousefi <hdyousefi@gmail.com>.
+ */
+
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/gorilla/websocket"
+	uuid "github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/hmdsefi/channelize/internal/channel"
+	"github.com/hmdsefi/channelize/internal/common/errorx"
+	"github.com/hmdsefi/channelize/internal/core/mock"
+	"github.com/hmdsefi/channelize/log"
+)
+
+const testCloseReason = "account is banned"
+
+// TestRevoker_DisconnectUser closes all the connections of a user.
+func TestRevoker_DisconnectUser(t *testing.T) {
+	ctx := context.Background()
+	userID := uuid.NewV4().String()
+	otherUserID := uuid.NewV4().String()
+	conn1 := mock.NewConnection(testConnectionIDs[0], &userID, authNoopFunc)
+	conn2 := mock.NewConnection(testConnectionIDs[1], &userID, authNoopFunc)
+	otherConn := mock.NewConnection(testConnectionIDs[2], &otherUserID, authNoopFunc)
+
+	revoker := NewRevoker(initCache(mock.NewCollector(), conn1, conn2, otherConn), log.NewDefaultLogger())
+
+	assert.Equal(t, 2, revoker.DisconnectUser(ctx, userID, websocket.ClosePolicyViolation, testCloseReason))
+	for _, conn := range []*mock.Connection{conn1, conn2} {
+		assert.Equal(t, mock.CloseFrame{Code: websocket.ClosePolicyViolation, Reason: testCloseReason}, <-conn.CloseFrame())
+	}
+	assert.Empty(t, otherConn.CloseFrame())
+
+	assert.Equal(t, 0, revoker.DisconnectUser(ctx, "unknown-user-id", websocket.ClosePolicyViolation, testCloseReason))
+}
+
+// TestRevoker_DisconnectConnection closes a connection by its ID.
+func TestRevoker_DisconnectConnection(t *testing.T) {
+	ctx := context.Background()
+	conn := mock.NewConnection(testConnID, nil, authNoopFunc)
+	revoker := NewRevoker(initCache(mock.NewCollector(), conn), log.NewDefaultLogger())
+
+	t.Run("close connection", func(t *testing.T) {
+		require.Nil(t, revoker.DisconnectConnection(ctx, conn.ID(), websocket.CloseNormalClosure, testCloseReason))
+		assert.Equal(t, mock.CloseFrame{Code: websocket.CloseNormalClosure, Reason: testCloseReason}, <-conn.CloseFrame())
+	})
+
+	t.Run("truncate long reason", func(t *testing.T) {
+		longReason := strings.Repeat("a", 2*maxCloseReasonLength)
+		require.Nil(t, revoker.DisconnectConnection(ctx, conn.ID(), websocket.CloseNormalClosure, longReason))
+		assert.Equal(t, maxCloseReasonLength, len((<-conn.CloseFrame()).Reason))
+	})
+
+	t.Run("truncate long reason on a character boundary", func(t *testing.T) {
+		longReason := strings.Repeat("é", maxCloseReasonLength)
+		require.Nil(t, revoker.DisconnectConnection(ctx, conn.ID(), websocket.CloseNormalClosure, longReason))
+		reason := (<-conn.CloseFrame()).Reason
+		assert.True(t, utf8.ValidString(reason))
+		assert.Equal(t, strings.Repeat("é", maxCloseReasonLength/2), reason)
+	})
+
+	t.Run("connection not found", func(t *testing.T) {
+		err := revoker.DisconnectConnection(ctx, "unknown-conn-id", websocket.CloseNormalClosure, testCloseReason)
+		var chanErr *errorx.ChannelizeError
+		require.True(t, errors.As(err, &chanErr))
+		assert.Equal(t, errorx.CodeConnectionNotFound, chanErr.Code)
+	})
+}
+
+// TestRevoker_RevokePrivateSubscriptions removes the private subscriptions and
+// keeps the connection and the public subscriptions.
+func TestRevoker_RevokePrivateSubscriptions(t *testing.T) {
+	ctx := context.Background()
+	privateChannel := channel.RegisterPrivateChannel("revoker-private-channel")
+	publicChannel := channel.RegisterPublicChannel("revoker-public-channel")
+	userID := uuid.NewV4().String()
+	conn := mock.NewConnection(testConnID, &userID, authNoopFunc)
+
+	cache := NewCache(mock.NewCollector())
+	cache.Subscribe(ctx, conn, privateChannel, publicChannel)
+
+	revoker := NewRevoker(cache, log.NewDefaultLogger())
+	assert.Equal(t, 1, revoker.RevokePrivateSubscriptions(ctx, userID))
+
+	<-conn.Revoked()
+	assert.Nil(t, cache.ConnectionByUserID(ctx, privateChannel, userID))
+	assert.Equal(t, []channel.Channel{publicChannel}, cache.Channels(ctx, conn.ID()))
+	assert.Empty(t, conn.CloseFrame())
+
+	var msgOut testAuthEventOut
+	require.Nil(t, json.Unmarshal(<-conn.Message(), &msgOut))
+	assert.Equal(t, channel.AuthChannel, msgOut.Channel)
+	assert.Equal(t, AuthEventSubscriptionsRevoked, msgOut.Data.Type)
+}
@@ -0,0 +1,100 @@
+/**
+ * Copyright © 2022 Hamed Yousefi <hdyousefi@gmail.com>.
+ */
+
+package core
+
+import (
+	"context"
+	"sync"
+
+	"github.com/hmdsefi/channelize/internal/common"
+	"github.com/hmdsefi/channelize/internal/common/errorx"
+)
+
+// pendingMessage represents a message that is held by the SnapshotGate.
+type pendingMessage struct {
+	ctx  context.Context
+	data []byte
+}
+
+// SnapshotGate wraps a connection and holds its messages until the snapshots
+// of the subscribed channels are sent. It is stored as the subscriber of the
+// snapshot channels, so the messages that are published between storing the
+// subscription and sending the snapshots are not lost and are delivered after
+// the snapshots.
+//
+// After releasing, the SnapshotGate passes the messages to the connection.
+type SnapshotGate struct {
+	common.ConnectionWrapper
+
+	// limit is the maximum number of held messages. Zero means there is no
+	// limit.
+	limit    int
+	pending  []pendingMessage
+	released bool
+	mu       sync.Mutex
+}
+
+// NewSnapshotGate creates a new instance of SnapshotGate. It holds at most as
+// many messages as the outbound buffer capacity of the connection.
+func NewSnapshotGate(conn common.ConnectionWrapper) *SnapshotGate {
+	return &SnapshotGate{
+		ConnectionWrapper: conn,
+		limit:             conn.Info().BufferCap,
+	}
+}
+
+// SendMessage holds the message if the gate is not released. Otherwise, sends
+// it to the connection.
+func (g *SnapshotGate) SendMessage(data []byte) error {
+	return g.SendMessageContext(context.Background(), data)
+}
+
+// SendMessageContext holds the message if the gate is not released. Otherwise,
+// sends it to the connection. It returns error if the number of held messages
+// reaches the limit.
+func (g *SnapshotGate) SendMessageContext(ctx context.Context, data []byte) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.released {
+		return g.ConnectionWrapper.SendMessageContext(ctx, data)
+	}
+
+	if g.limit > 0 && len(g.pending) >= g.limit {
+		return errorx.NewChannelizeError(errorx.CodeOutboundBufferIsFull)
+	}
+
+	g.pending = append(g.pending, pendingMessage{ctx: ctx, data: data})
+
+	return nil
+}
+
+// Release sends the input snapshots and then the held messages to the
+// connection, and passes the next messages to the connection directly.
+func (g *SnapshotGate) Release(ctx context.Context, snapshots ...[]byte) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.released {
+		return
+	}
+
+	for _, snapshot := range snapshots {
+		g.send(ctx, snapshot)
+	}
+
+	for _, msg := range g.pending {
+		g.send(msg.ctx, msg.data)
+	}
+
+	g.pending = nil
+	g.released = true
+}
+
+func (g *SnapshotGate) send(ctx context.Context, data []byte) {
+	// the connection counts the messages that are dropped because of the
+	// full outbound buffer.
+	_ = g.ConnectionWrapper.SendMessageContext(ctx, data)
+}
@@ -0,0 +1,101 @@
+/**
+ * Copyright © 2022 Hamed Yousefi <hdyousefi@gmail.com>.
+ */
+
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/hmdsefi/channelize/internal/channel"
+	"github.com/hmdsefi/channelize/internal/common"
+	"github.com/hmdsefi/channelize/internal/common/errorx"
+	"github.com/hmdsefi/channelize/internal/core/mock"
+	"github.com/hmdsefi/channelize/log"
+)
+
+// TestSnapshotGate_Release holds the published messages until the snapshot
+// is sent, then passes the messages to the connection.
+func TestSnapshotGate_Release(t *testing.T) {
+	ctx := context.Background()
+	ch := channel.Channel("balances")
+	conn := mock.NewConnection(testConnectionIDs[0], nil, authNoopFunc)
+	gate := NewSnapshotGate(conn)
+
+	cache := NewCache(mock.NewCollector())
+	cache.Subscribe(ctx, gate, ch)
+	dispatch := NewDispatch(cache, mock.NewCollector(), log.NewDefaultLogger())
+
+	require.Nil(t, dispatch.SendPublicMessage(ctx, ch, "delta-1"))
+	assert.Len(t, conn.Message(), 0)
+
+	snapshot, err := json.Marshal(NewSnapshotMessageOut(ch, "state"))
+	require.Nil(t, err)
+	gate.Release(ctx, snapshot)
+
+	require.Nil(t, dispatch.SendPublicMessage(ctx, ch, "delta-2"))
+
+	for _, expected := range []*MessageOut{
+		NewSnapshotMessageOut(ch, "state"),
+		newMessageOut(ch, "delta-1"),
+		newMessageOut(ch, "delta-2"),
+	} {
+		var msgOut MessageOut
+		require.Nil(t, json.Unmarshal(<-conn.Message(), &msgOut))
+		assert.Equal(t, *expected, msgOut)
+	}
+
+	// releasing again doesn't send the snapshots.
+	gate.Release(ctx, snapshot)
+	assert.Len(t, conn.Message(), 0)
+}
+
+// TestSnapshotGate_Replace stores the connection instead of the released gate.
+func TestSnapshotGate_Replace(t *testing.T) {
+	ctx := context.Background()
+	ch := channel.Channel("balances")
+	conn := mock.NewConnection(testConnectionIDs[0], nil, authNoopFunc)
+	gate := NewSnapshotGate(conn)
+
+	cache := NewCache(mock.NewCollector())
+	cache.Subscribe(ctx, conn, "feed")
+	cache.Subscribe(ctx, gate, ch)
+	require.Equal(t, gate, cache.Connection(ctx, conn.ID()))
+
+	gate.Release(ctx)
+	cache.Replace(ctx, conn)
+
+	assert.Equal(t, conn, cache.Connection(ctx, conn.ID()))
+	assert.Equal(t, []common.ConnectionWrapper{conn}, cache.Connections(ctx, ch))
+	assert.Equal(t, []common.ConnectionWrapper{conn}, cache.Connections(ctx, "feed"))
+
+	// a removed connection is not stored again.
+	cache.Remove(ctx, conn.ID(), nil)
+	cache.Replace(ctx, conn)
+	assert.Nil(t, cache.Connection(ctx, conn.ID()))
+}
+
+// TestSnapshotGate_Limit returns error if the number of held messages reaches
+// the outbound buffer capacity of the connection.
+func TestSnapshotGate_Limit(t *testing.T) {
+	conn := mock.NewConnection(testConnectionIDs[0], nil, authNoopFunc)
+	gate := NewSnapshotGate(conn)
+
+	for i := 0; i < cap(conn.Message()); i++ {
+		require.Nil(t, gate.SendMessage([]byte("delta")))
+	}
+
+	err := gate.SendMessage([]byte("delta"))
+	var chanErr *errorx.ChannelizeError
+	require.True(t, errors.As(err, &chanErr))
+	assert.Equal(t, errorx.CodeOutboundBufferIsFull, chanErr.Code)
+
+	gate.Release(context.Background())
+	assert.Len(t, conn.Message(), cap(conn.Message()))
+}
@@ -0,0 +1,129 @@
+/**
+ * Copyright © 2022 Hamed Yousefi <hdyousefi@gmail.com>.
+ */
+
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/hmdsefi/channelize/internal/common"
+	"github.com/hmdsefi/channelize/internal/common/utils"
+	"github.com/hmdsefi/channelize/log"
+)
+
+// defaultSweepInterval is the sweep interval that is used if the input
+// interval is not positive.
+const defaultSweepInterval = time.Minute
+
+// sweeperStore provides the private connections to the Sweeper.
+type sweeperStore interface {
+	// PrivateConnections returns all the connections that are mapped to a userID,
+	// including multiple connections of the same user.
+	PrivateConnections(ctx context.Context) []common.ConnectionWrapper
+
+	// UnsubscribePrivateChannels removes all the private channel subscriptions of
+	// the input connection, and removes the userID and connID mapping.
+	UnsubscribePrivateChannels(ctx context.Context, connID string, userID string)
+}
+
+// sweeperCollector is an interface for collecting the token sweeper metrics.
+type sweeperCollector interface {
+	ExpiredTokensInc()
+	ReauthenticatedTokensInc()
+}
+
+// Sweeper checks the token expiration of the private connections periodically.
+// It re-authenticates the expired tokens, since the token lifetime might have
+// been extended. If the re-authentication fails, it revokes the private channel
+// subscriptions of the connection and notifies the client in the auth channel.
+type Sweeper struct {
+	store     sweeperStore
+	collector sweeperCollector
+	logger    log.Logger
+}
+
+// NewSweeper creates a new instance of Sweeper.
+func NewSweeper(store sweeperStore, collector sweeperCollector, logger log.Logger) *Sweeper {
+	return &Sweeper{
+		store:     store,
+		collector: collector,
+		logger:    logger,
+	}
+}
+
+// Run sweeps the private connections with the input interval until the input
+// context is cancelled. It uses the defaultSweepInterval if the input interval
+// is not positive.
+func (s *Sweeper) Run(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		s.logger.Warn("invalid token sweeper interval, the default interval is used", "interval", interval.String())
+		interval = defaultSweepInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.Sweep(ctx)
+		}
+	}
+}
+
+// Sweep checks the token expiration of all the private connections once.
+func (s *Sweeper) Sweep(ctx context.Context) {
+	now := utils.Now().Unix()
+
+	for _, conn := range s.store.PrivateConnections(ctx) {
+		token := conn.Token()
+		if token != nil && now < token.ExpiresAt {
+			continue
+		}
+
+		// validate the token again. It is possible that the token lifetime
+		// has been extended.
+		if err := conn.Authenticate(ctx); err == nil {
+			s.collector.ReauthenticatedTokensInc()
+			continue
+		}
+
+		s.revoke(ctx, conn)
+	}
+}
+
+// revoke removes the private channel subscriptions of the input connection
+// and notifies the client.
+func (s *Sweeper) revoke(ctx context.Context, conn common.ConnectionWrapper) {
+	userID := conn.UserID()
+	if userID == nil {
+		return
+	}
+
+	s.store.UnsubscribePrivateChannels(ctx, conn.ID(), *userID)
+	s.collector.ExpiredTokensInc()
+
+	var expiresAt int64
+	if token := conn.Token(); token != nil {
+		expiresAt = token.ExpiresAt
+	}
+
+	msgOutBytes, err := json.Marshal(NewAuthEventMessageOut(AuthEventTokenExpired, expiresAt))
+	if err != nil {
+		s.logger.Error("failed to marshal token expired event", common.LogFieldID, conn.ID(), common.LogFieldError, err.Error())
+		return
+	}
+
+	if err = conn.SendMessage(msgOutBytes); err != nil {
+		s.logger.Error(
+			"failed to send token expired event to the outbound buffer",
+			common.LogFieldID, conn.ID(),
+			common.LogFieldError, err.Error(),
+		)
+	}
+}
@@ -0,0 +1,139 @@
+/**
+ * Copyright © 2022 Hamed Yousefi <hdyousefi@gmail.com>.
+ */
+
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/hmdsefi/channelize/auth"
+	"github.com/hmdsefi/channelize/internal/channel"
+	"github.com/hmdsefi/channelize/internal/common/errorx"
+	"github.com/hmdsefi/channelize/internal/common/utils"
+	"github.com/hmdsefi/channelize/internal/core/mock"
+	"github.com/hmdsefi/channelize/log"
+)
+
+type testAuthEventOut struct {
+	Channel channel.Channel `json:"channel"`
+	Data    AuthEventOut    `json:"data"`
+}
+
+// TestSweeper_Sweep checks the private connections with valid, re-authenticated
+// and expired tokens.
+func TestSweeper_Sweep(t *testing.T) {
+	ctx := context.Background()
+	privateChannel := channel.RegisterPrivateChannel("sweeper-private-channel")
+	expiresAt := utils.Now().Add(-1 * time.Minute).Unix()
+
+	newConn := func(id string, expiresAt int64, authFunc func() error) (string, mock.Connection) {
+		userID := uuid.NewV4().String()
+		conn := mock.NewConnection(id, &userID, authFunc).
+			WithToken(&auth.Token{UserID: userID, ExpiresAt: expiresAt})
+		return userID, conn
+	}
+
+	validUserID, validConn := newConn(testConnectionIDs[0], utils.Now().Add(time.Hour).Unix(), makeAuthFunc(errorx.CodeAuthTokenIsExpired))
+	extendedUserID, extendedConn := newConn(testConnectionIDs[1], expiresAt, authNoopFunc)
+	expiredUserID, expiredConn := newConn(testConnectionIDs[2], expiresAt, makeAuthFunc(errorx.CodeAuthTokenIsExpired))
+
+	mockCollector := mock.NewCollector()
+	cache := NewCache(mockCollector)
+	cache.Subscribe(ctx, validConn, privateChannel)
+	cache.Subscribe(ctx, extendedConn, privateChannel)
+	cache.Subscribe(ctx, expiredConn, privateChannel)
+
+	NewSweeper(cache, mockCollector, log.NewDefaultLogger()).Sweep(ctx)
+
+	assert.NotNil(t, cache.ConnectionByUserID(ctx, privateChannel, validUserID))
+	assert.NotNil(t, cache.ConnectionByUserID(ctx, privateChannel, extendedUserID))
+	assert.Nil(t, cache.ConnectionByUserID(ctx, privateChannel, expiredUserID))
+	assert.Equal(t, int32(1), mockCollector.ExpiredTokensCount)
+	assert.Equal(t, int32(1), mockCollector.ReauthenticatedCount)
+
+	var msgOut testAuthEventOut
+	require.Nil(t, json.Unmarshal(<-expiredConn.Message(), &msgOut))
+	assert.Equal(t, channel.AuthChannel, msgOut.Channel)
+	assert.Equal(t, AuthEventOut{Type: AuthEventTokenExpired, ExpiresAt: expiresAt}, msgOut.Data)
+	assert.Empty(t, validConn.Message())
+	assert.Empty(t, extendedConn.Message())
+}
+
+// TestSweeper_Sweep_MultipleConnections revokes the expired tokens of all the
+// connections of a user.
+func TestSweeper_Sweep_MultipleConnections(t *testing.T) {
+	ctx := context.Background()
+	privateChannel := channel.RegisterPrivateChannel("sweeper-multiple-private-channel")
+	userID := uuid.NewV4().String()
+	token := &auth.Token{UserID: userID, ExpiresAt: utils.Now().Add(-1 * time.Minute).Unix()}
+
+	mockCollector := mock.NewCollector()
+	cache := NewCache(mockCollector)
+
+	var connections []mock.Connection
+	for _, id := range testConnectionIDs[:2] {
+		conn := mock.NewConnection(id, &userID, makeAuthFunc(errorx.CodeAuthTokenIsExpired)).WithToken(token)
+		cache.Subscribe(ctx, conn, privateChannel)
+		connections = append(connections, conn)
+	}
+
+	NewSweeper(cache, mockCollector, log.NewDefaultLogger()).Sweep(ctx)
+
+	assert.Equal(t, int32(2), mockCollector.ExpiredTokensCount)
+	assert.Empty(t, cache.Connections(ctx, privateChannel))
+	assert.Empty(t, cache.PrivateConnections(ctx))
+	for _, conn := range connections {
+		var msgOut testAuthEventOut
+		require.Nil(t, json.Unmarshal(<-conn.Message(), &msgOut))
+		assert.Equal(t, AuthEventTokenExpired, msgOut.Data.Type)
+	}
+}
+
+// TestSweeper_Run_InvalidInterval uses the default interval instead of
+// panicking for the non-positive intervals.
+func TestSweeper_Run_InvalidInterval(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	sweeper := NewSweeper(NewCache(mock.NewCollector()), mock.NewCollector(), log.NewDefaultLogger())
+	for _, interval := range []time.Duration{0, -1 * time.Second} {
+		assert.NotPanics(t, func() { sweeper.Run(ctx, interval) })
+	}
+}
+
+// TestSweeper_Run stops sweeping when the context is cancelled.
+func TestSweeper_Run(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	privateChannel := channel.RegisterPrivateChannel("sweeper-run-private-channel")
+	userID := uuid.NewV4().String()
+	conn := mock.NewConnection(testConnID, &userID, makeAuthFunc(errorx.CodeAuthTokenIsExpired)).
+		WithToken(&auth.Token{UserID: userID, ExpiresAt: utils.Now().Add(-1 * time.Minute).Unix()})
+
+	mockCollector := mock.NewCollector()
+	cache := NewCache(mockCollector)
+	cache.Subscribe(ctx, conn, privateChannel)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		NewSweeper(cache, mockCollector, log.NewDefaultLogger()).Run(ctx, 10*time.Millisecond)
+	}()
+
+	select {
+	case <-conn.Message():
+	case <-time.After(time.Second):
+		t.Fatal("token expired event is not sent")
+	}
+
+	cancel()
+	<-done
+	assert.Nil(t, cache.ConnectionByUserID(ctx, privateChannel, userID))
+}
@@ -0,0 +1,107 @@
+/**
+ * Copyright © 2022 Hamed Yousefi <hdyousefi@gmail.com>.
+ */
+
+package hooks
+
+import (
+	"context"
+	"errors"
+
+	"github.com/hmdsefi/channelize/auth"
+	"github.com/hmdsefi/channelize/internal/channel"
+	"github.com/hmdsefi/channelize/internal/common"
+	"github.com/hmdsefi/channelize/internal/common/errorx"
+)
+
+// Hooks represents the functions that are called on the connection lifecycle
+// transitions. All the hooks are optional.
+//
+// The "before" hooks, OnConnect, OnAuth, and OnSubscribe, can reject the
+// action by returning an error. The error is sent to the error channel of
+// the connection. The "after" hooks, OnDisconnect and OnUnsubscribe, only
+// observe the action.
+//
+// The hooks are called synchronously by the connection goroutines, so the
+// slow hooks delay reading the client messages.
+type Hooks struct {
+	// OnConnect is called before the connection is registered. Returning
+	// error rejects the connection. The error is sent to the error channel,
+	// and the connection is closed with the policy violation code.
+	OnConnect func(ctx context.Context, info common.ConnectionInfo) error
+
+	// OnDisconnect is called after the connection is closed and removed from
+	// the storage. The info contains the channels that the connection had
+	// subscribed before closing.
+	OnDisconnect func(ctx context.Context, info common.ConnectionInfo)
+
+	// OnAuth is called after the token has been validated by the authenticator
+	// and before it is stored in the connection, including the handshake, the
+	// refresh, and the re-authentication of the expired tokens. Returning error
+	// rejects the token.
+	OnAuth func(ctx context.Context, info common.ConnectionInfo, token *auth.Token) error
+
+	// OnSubscribe is called before subscribing the connection to the input
+	// channels. Returning error rejects the whole subscribe message.
+	OnSubscribe func(ctx context.Context, info common.ConnectionInfo, channels []channel.Channel) error
+
+	// OnUnsubscribe is called after unsubscribing the connection from the
+	// input channels by the client.
+	OnUnsubscribe func(ctx context.Context, info common.ConnectionInfo, channels []channel.Channel)
+}
+
+// Connect calls the OnConnect hook if it is set.
+func (h Hooks) Connect(ctx context.Context, info common.ConnectionInfo) error {
+	if h.OnConnect == nil {
+		return nil
+	}
+
+	return rejected(h.OnConnect(ctx, info))
+}
+
+// Disconnect calls the OnDisconnect hook if it is set.
+func (h Hooks) Disconnect(ctx context.Context, info common.ConnectionInfo) {
+	if h.OnDisconnect != nil {
+		h.OnDisconnect(ctx, info)
+	}
+}
+
+// Auth calls the OnAuth hook if it is set.
+func (h Hooks) Auth(ctx context.Context, info common.ConnectionInfo, token *auth.Token) error {
+	if h.OnAuth == nil {
+		return nil
+	}
+
+	return rejected(h.OnAuth(ctx, info, token))
+}
+
+// Subscribe calls the OnSubscribe hook if it is set.
+func (h Hooks) Subscribe(ctx context.Context, info common.ConnectionInfo, channels []channel.Channel) error {
+	if h.OnSubscribe == nil {
+		return nil
+	}
+
+	return rejected(h.OnSubscribe(ctx, info, channels))
+}
+
+// Unsubscribe calls the OnUnsubscribe hook if it is set.
+func (h Hooks) Unsubscribe(ctx context.Context, info common.ConnectionInfo, channels []channel.Channel) {
+	if h.OnUnsubscribe != nil {
+		h.OnUnsubscribe(ctx, info, channels)
+	}
+}
+
+// rejected wraps the input hook error with the rejected error code, unless
+// it is already an errorx.ChannelizeError.
+func rejected(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	var chanErr *errorx.ChannelizeError
+	if errors.As(err, &chanErr) {
+		return err
+	}
+
+	return errorx.NewChannelizeErrorWithErr(errorx.CodeRejectedByHook, err)
+}
@@ -0,0 +1,88 @@
+/**
+ * Copyright © 2022 Hamed Yousefi <hdyousefi@gmail.com>.
+ */
+
+package hooks
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/hmdsefi/channelize/auth"
+	"github.com/hmdsefi/channelize/internal/channel"
+	"github.com/hmdsefi/channelize/internal/common"
+	"github.com/hmdsefi/channelize/internal/common/errorx"
+)
+
+func TestHooks_Empty(t *testing.T) {
+	ctx := context.Background()
+	info := common.ConnectionInfo{ID: "conn-1"}
+	hooks := Hooks{}
+
+	assert.Nil(t, hooks.Connect(ctx, info))
+	assert.Nil(t, hooks.Auth(ctx, info, &auth.Token{}))
+	assert.Nil(t, hooks.Subscribe(ctx, info, []channel.Channel{"news"}))
+	hooks.Disconnect(ctx, info)
+	hooks.Unsubscribe(ctx, info, []channel.Channel{"news"})
+}
+
+func TestHooks_Reject(t *testing.T) {
+	ctx := context.Background()
+	info := common.ConnectionInfo{ID: "conn-1", UserID: "user-1"}
+	reason := errors.New("banned user")
+
+	hooks := Hooks{
+		OnConnect: func(_ context.Context, actual common.ConnectionInfo) error {
+			assert.Equal(t, info, actual)
+			return reason
+		},
+		OnAuth: func(_ context.Context, _ common.ConnectionInfo, token *auth.Token) error {
+			assert.Equal(t, "user-1", token.UserID)
+			return errorx.NewChannelizeError(errorx.CodeAccessDenied)
+		},
+		OnSubscribe: func(_ context.Context, _ common.ConnectionInfo, channels []channel.Channel) error {
+			assert.Equal(t, []channel.Channel{"news"}, channels)
+			return nil
+		},
+	}
+
+	err := hooks.Connect(ctx, info)
+	var chanErr *errorx.ChannelizeError
+	require.True(t, errors.As(err, &chanErr))
+	assert.Equal(t, errorx.CodeRejectedByHook, chanErr.Code)
+	assert.Equal(t, "action is rejected: banned user", err.Error())
+
+	// the ChannelizeError is not wrapped.
+	err = hooks.Auth(ctx, info, &auth.Token{UserID: "user-1"})
+	require.True(t, errors.As(err, &chanErr))
+	assert.Equal(t, errorx.CodeAccessDenied, chanErr.Code)
+
+	assert.Nil(t, hooks.Subscribe(ctx, info, []channel.Channel{"news"}))
+}
+
+func TestHooks_After(t *testing.T) {
+	ctx := context.Background()
+	info := common.ConnectionInfo{ID: "conn-1", Channels: []channel.Channel{"news"}}
+
+	var disconnected, unsubscribed bool
+	hooks := Hooks{
+		OnDisconnect: func(_ context.Context, actual common.ConnectionInfo) {
+			assert.Equal(t, info, actual)
+			disconnected = true
+		},
+		OnUnsubscribe: func(_ context.Context, _ common.ConnectionInfo, channels []channel.Channel) {
+			assert.Equal(t, []channel.Channel{"news"}, channels)
+			unsubscribed = true
+		},
+	}
+
+	hooks.Disconnect(ctx, info)
+	hooks.Unsubscribe(ctx, info, []channel.Channel{"news"})
+
+	assert.True(t, disconnected)
+	assert.True(t, unsubscribed)
+}
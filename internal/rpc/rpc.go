@@ -0,0 +1,96 @@
+/**
+ * Copyright © 2022 Hamed Yousefi <hdyousefi@gmail.com>.
+ */
+
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"sync/atomic"
+
+	"github.com/hmdsefi/channelize/auth"
+	"github.com/hmdsefi/channelize/internal/common"
+	"github.com/hmdsefi/channelize/internal/common/errorx"
+	"github.com/hmdsefi/channelize/internal/core"
+)
+
+// Connection represents the connection that has sent the custom message.
+type Connection interface {
+	ID() string
+	UserID() *string
+	Token() *auth.Token
+	IsAuthenticated() bool
+	Info() common.ConnectionInfo
+}
+
+// ReplyFunc is a function type that sends the reply of a custom message to
+// the reply channel of the connection. If err is not nil, the reply contains
+// the error instead of the result.
+//
+// A message can be replied only once, and it is thread-safe, so the handler
+// can reply in another goroutine.
+type ReplyFunc func(result interface{}, err error) error
+
+// Handler is a function type that handles a custom message type. The params
+// is the raw params object of the message.
+//
+// The handlers are called in the read goroutine of the connection, so the
+// next messages of the connection are not read until the handler returns.
+type Handler func(ctx context.Context, conn Connection, params json.RawMessage, reply ReplyFunc)
+
+// Route represents the handler of a custom message type. The handler is
+// called only for the authenticated connections, unless Anonymous is true.
+type Route struct {
+	Handler Handler
+
+	// Anonymous allows the connections without a valid token to call the
+	// handler.
+	Anonymous bool
+}
+
+// Serve calls the handler of the route. It returns error without calling
+// the handler if the route requires authentication and the connection has
+// no valid token.
+func (r Route) Serve(ctx context.Context, conn Connection, params json.RawMessage, reply ReplyFunc) error {
+	if !r.Anonymous && !conn.IsAuthenticated() {
+		if conn.Token() == nil {
+			return errorx.NewChannelizeError(errorx.CodeAuthTokenIsMissing)
+		}
+
+		return errorx.NewChannelizeError(errorx.CodeAuthTokenIsExpired)
+	}
+
+	r.Handler(ctx, conn, params, reply)
+	return nil
+}
+
+// sender sends the serialized messages to the connection.
+type sender interface {
+	SendMessage([]byte) error
+}
+
+// NewReplyFunc creates a ReplyFunc for the inbound message with the input id
+// and type. The reply contains the id, so the client can correlate it with
+// its request. If the id is empty, the client doesn't expect a reply and the
+// ReplyFunc doesn't send anything.
+func NewReplyFunc(conn sender, id string, messageType core.MessageType) ReplyFunc {
+	var replied int32
+
+	return func(result interface{}, err error) error {
+		if id == "" {
+			return nil
+		}
+
+		data, mErr := json.Marshal(core.NewReplyMessageOut(id, messageType, result, err))
+		if mErr != nil {
+			return errorx.NewChannelizeErrorWithErr(errorx.CodeFailedToMarshalMessage, mErr)
+		}
+
+		if !atomic.CompareAndSwapInt32(&replied, 0, 1) {
+			return errorx.NewChannelizeError(errorx.CodeAlreadyReplied)
+		}
+
+		return conn.SendMessage(data)
+	}
+}
@@ -0,0 +1,107 @@
+/**
+ * Copyright © 2022 Hamed Yousefi <hdyousefi@gmail.com>.
+ */
+
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/hmdsefi/channelize/auth"
+	"github.com/hmdsefi/channelize/internal/common/errorx"
+	"github.com/hmdsefi/channelize/internal/common/utils"
+	"github.com/hmdsefi/channelize/internal/core/mock"
+)
+
+func TestRoute_Serve(t *testing.T) {
+	var called bool
+	handler := func(context.Context, Connection, json.RawMessage, ReplyFunc) { called = true }
+	reply := func(interface{}, error) error { return nil }
+
+	t.Run("unauthenticated connection", func(t *testing.T) {
+		called = false
+		conn := mock.NewConnection("conn-1", nil, func() error { return nil })
+
+		err := Route{Handler: handler}.Serve(context.Background(), conn, nil, reply)
+		var chanErr *errorx.ChannelizeError
+		require.True(t, errors.As(err, &chanErr))
+		assert.Equal(t, errorx.CodeAuthTokenIsMissing, chanErr.Code)
+		assert.False(t, called)
+	})
+
+	t.Run("expired token", func(t *testing.T) {
+		called = false
+		conn := mock.NewConnection("conn-1", nil, func() error { return nil }).
+			WithToken(&auth.Token{ExpiresAt: utils.Now().Add(-time.Minute).Unix()})
+
+		err := Route{Handler: handler}.Serve(context.Background(), conn, nil, reply)
+		var chanErr *errorx.ChannelizeError
+		require.True(t, errors.As(err, &chanErr))
+		assert.Equal(t, errorx.CodeAuthTokenIsExpired, chanErr.Code)
+		assert.False(t, called)
+	})
+
+	t.Run("authenticated connection", func(t *testing.T) {
+		called = false
+		conn := mock.NewConnection("conn-1", nil, func() error { return nil }).
+			WithToken(&auth.Token{ExpiresAt: utils.Now().Add(time.Minute).Unix()})
+
+		require.Nil(t, Route{Handler: handler}.Serve(context.Background(), conn, nil, reply))
+		assert.True(t, called)
+	})
+
+	t.Run("anonymous route", func(t *testing.T) {
+		called = false
+		conn := mock.NewConnection("conn-1", nil, func() error { return nil })
+
+		require.Nil(t, Route{Handler: handler, Anonymous: true}.Serve(context.Background(), conn, nil, reply))
+		assert.True(t, called)
+	})
+}
+
+func TestNewReplyFunc(t *testing.T) {
+	conn := mock.NewConnection("conn-1", nil, func() error { return nil })
+
+	reply := NewReplyFunc(conn, "7", "place_order")
+	require.Nil(t, reply(map[string]string{"order_id": "42"}, nil))
+	assert.JSONEq(
+		t,
+		`{"channel":"reply","data":{"id":"7","type":"place_order","result":{"order_id":"42"}}}`,
+		string(<-conn.Message()),
+	)
+
+	// the message is already replied.
+	err := reply(nil, errors.New("insufficient balance"))
+	var chanErr *errorx.ChannelizeError
+	require.True(t, errors.As(err, &chanErr))
+	assert.Equal(t, errorx.CodeAlreadyReplied, chanErr.Code)
+	assert.Len(t, conn.Message(), 0)
+}
+
+func TestNewReplyFunc_Error(t *testing.T) {
+	conn := mock.NewConnection("conn-1", nil, func() error { return nil })
+
+	reply := NewReplyFunc(conn, "8", "place_order")
+	require.Nil(t, reply(nil, errors.New("insufficient balance")))
+	assert.JSONEq(
+		t,
+		`{"channel":"reply","data":{"id":"8","type":"place_order","error":{"message":"insufficient balance"}}}`,
+		string(<-conn.Message()),
+	)
+}
+
+func TestNewReplyFunc_WithoutID(t *testing.T) {
+	conn := mock.NewConnection("conn-1", nil, func() error { return nil })
+
+	reply := NewReplyFunc(conn, "", "ping_app")
+	assert.Nil(t, reply("pong", nil))
+	assert.Nil(t, reply("pong", nil))
+	assert.Len(t, conn.Message(), 0)
+}
@@ -0,0 +1,261 @@
+/**
+ * Copyright © 2022 Hamed Yousefi <hdyousefi@gmail.com>.
+ */
+
+package log
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	// badKey is the key of the last value if the number of key-value items
+	// is odd.
+	badKey = "!BADKEY"
+
+	textTimeLayout = "2006/01/02 15:04:05"
+)
+
+const (
+	Debug Level = iota
+	Info
+	Warn
+	Error
+)
+
+// Level represents the log level. The messages with a lower level than the
+// logger level are dropped.
+type Level int
+
+// String returns the upper case name of the level.
+func (l Level) String() string {
+	switch l {
+	case Debug:
+		return "DEBUG"
+	case Info:
+		return "INFO"
+	case Warn:
+		return "WARN"
+	case Error:
+		return "ERROR"
+	default:
+		return fmt.Sprintf("LEVEL(%d)", int(l))
+	}
+}
+
+// Config represents the DefaultLogger configuration.
+type Config struct {
+	level  Level
+	output io.Writer
+	json   bool
+}
+
+type Option func(*Config)
+
+// WithLevel sets the minimum level of the messages. The default value is Info.
+func WithLevel(level Level) Option {
+	return func(config *Config) {
+		if config == nil {
+			return
+		}
+
+		config.level = level
+	}
+}
+
+// WithOutput sets the writer of the messages. The default value is os.Stderr.
+func WithOutput(output io.Writer) Option {
+	return func(config *Config) {
+		if config == nil || output == nil {
+			return
+		}
+
+		config.output = output
+	}
+}
+
+// WithJSON writes each message as a JSON object instead of a line of text.
+func WithJSON(enabled bool) Option {
+	return func(config *Config) {
+		if config == nil {
+			return
+		}
+
+		config.json = enabled
+	}
+}
+
+// DefaultLogger is an implementation of the Logger interface that writes the
+// messages as text lines or JSON objects. It is used if logger is not specified.
+//
+// A text message looks like:
+//
+//	2022/09/01 10:00:00 ERROR failed to read message id=f1c2 error="unexpected EOF"
+//
+// and the same JSON message looks like:
+//
+//	{"time":"2022-09-01T10:00:00Z","level":"ERROR","msg":"failed to read message","id":"f1c2","error":"unexpected EOF"}
+type DefaultLogger struct {
+	config    Config
+	keyValues []interface{}
+
+	// mu prevents interleaving the messages. It is shared with the child loggers.
+	mu *sync.Mutex
+}
+
+// NewDefaultLogger creates a new instance of DefaultLogger. By default, it
+// writes the text messages with info level or higher to the os.Stderr.
+func NewDefaultLogger(options ...Option) *DefaultLogger {
+	config := Config{level: Info, output: os.Stderr}
+	for _, option := range options {
+		option(&config)
+	}
+
+	return &DefaultLogger{config: config, mu: new(sync.Mutex)}
+}
+
+// With returns a child logger that adds the input key-value pairs to all its
+// messages.
+func (l *DefaultLogger) With(keyValues ...interface{}) Logger {
+	child := *l
+	child.keyValues = append(append(make([]interface{}, 0, len(l.keyValues)+len(keyValues)), l.keyValues...), keyValues...)
+
+	return &child
+}
+
+// Info writes message to the log with info level.
+func (l *DefaultLogger) Info(msg string, keyValues ...interface{}) {
+	l.log(Info, msg, keyValues)
+}
+
+// Error writes message to the log with error level.
+func (l *DefaultLogger) Error(msg string, keyValues ...interface{}) {
+	l.log(Error, msg, keyValues)
+}
+
+// Warn writes message to the log with warn level.
+func (l *DefaultLogger) Warn(msg string, keyValues ...interface{}) {
+	l.log(Warn, msg, keyValues)
+}
+
+// Debug writes message to the log with debug level.
+func (l *DefaultLogger) Debug(msg string, keyValues ...interface{}) {
+	l.log(Debug, msg, keyValues)
+}
+
+func (l *DefaultLogger) log(level Level, msg string, keyValues []interface{}) {
+	if level < l.config.level {
+		return
+	}
+
+	now := time.Now()
+	keyValues = append(append(make([]interface{}, 0, len(l.keyValues)+len(keyValues)), l.keyValues...), keyValues...)
+
+	var buf bytes.Buffer
+	if l.config.json {
+		writeJSON(&buf, now, level, msg, keyValues)
+	} else {
+		writeText(&buf, now, level, msg, keyValues)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	_, _ = l.config.output.Write(buf.Bytes())
+}
+
+// writeText writes the message as a line of text. The values that contain
+// spaces or quotes are quoted.
+func writeText(buf *bytes.Buffer, now time.Time, level Level, msg string, keyValues []interface{}) {
+	buf.WriteString(now.Format(textTimeLayout))
+	buf.WriteByte(' ')
+	buf.WriteString(level.String())
+	buf.WriteByte(' ')
+	buf.WriteString(msg)
+
+	forEachPair(keyValues, func(key string, value interface{}) {
+		buf.WriteByte(' ')
+		buf.WriteString(key)
+		buf.WriteByte('=')
+
+		text := fmt.Sprint(value)
+		if needsQuote(text) {
+			text = fmt.Sprintf("%q", text)
+		}
+		buf.WriteString(text)
+	})
+
+	buf.WriteByte('\n')
+}
+
+// writeJSON writes the message as a JSON object in a single line.
+func writeJSON(buf *bytes.Buffer, now time.Time, level Level, msg string, keyValues []interface{}) {
+	buf.WriteByte('{')
+	writeJSONField(buf, "time", now.Format(time.RFC3339Nano))
+	buf.WriteByte(',')
+	writeJSONField(buf, "level", level.String())
+	buf.WriteByte(',')
+	writeJSONField(buf, "msg", msg)
+
+	forEachPair(keyValues, func(key string, value interface{}) {
+		buf.WriteByte(',')
+		writeJSONField(buf, key, value)
+	})
+
+	buf.WriteString("}\n")
+}
+
+func writeJSONField(buf *bytes.Buffer, key string, value interface{}) {
+	keyBytes, _ := json.Marshal(key)
+	buf.Write(keyBytes)
+	buf.WriteByte(':')
+
+	// errors are marshaled as empty objects, so use their messages.
+	if err, ok := value.(error); ok {
+		value = err.Error()
+	}
+
+	valueBytes, err := json.Marshal(value)
+	if err != nil {
+		valueBytes, _ = json.Marshal(fmt.Sprint(value))
+	}
+	buf.Write(valueBytes)
+}
+
+// forEachPair calls the input function for each key-value pair. If the number
+// of items is odd, the key of the last item is badKey.
+func forEachPair(keyValues []interface{}, fn func(key string, value interface{})) {
+	for i := 0; i < len(keyValues); i += 2 {
+		if i+1 == len(keyValues) {
+			fn(badKey, keyValues[i])
+			return
+		}
+
+		key, ok := keyValues[i].(string)
+		if !ok {
+			key = fmt.Sprint(keyValues[i])
+		}
+
+		fn(key, keyValues[i+1])
+	}
+}
+
+func needsQuote(text string) bool {
+	if text == "" {
+		return true
+	}
+
+	for _, r := range text {
+		if r <= ' ' || r == '=' || r == '"' {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,105 @@
+/**
+ * Copyright © 2022 Hamed Yousefi <hdyousefi@gmail.com>.
+ */
+
+package log
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLevel_String(t *testing.T) {
+	assert.Equal(t, "DEBUG", Debug.String())
+	assert.Equal(t, "INFO", Info.String())
+	assert.Equal(t, "WARN", Warn.String())
+	assert.Equal(t, "ERROR", Error.String())
+	assert.Equal(t, "LEVEL(10)", Level(10).String())
+}
+
+func TestDefaultLogger_Text(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewDefaultLogger(WithOutput(&buf))
+
+	logger.Error("failed to read message", "id", "conn-1", "error", errors.New("unexpected EOF"), "odd")
+
+	line := buf.String()
+	assert.True(t, strings.HasSuffix(
+		line,
+		" ERROR failed to read message id=conn-1 error=\"unexpected EOF\" !BADKEY=odd\n",
+	), line)
+}
+
+func TestDefaultLogger_Level(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewDefaultLogger(WithOutput(&buf), WithLevel(Warn))
+
+	logger.Debug("debug")
+	logger.Info("info")
+	assert.Empty(t, buf.String())
+
+	logger.Warn("warn")
+	logger.Error("error")
+	assert.Equal(t, 2, strings.Count(buf.String(), "\n"))
+
+	buf.Reset()
+	NewDefaultLogger(WithOutput(&buf)).Debug("debug")
+	assert.Empty(t, buf.String(), "default level is info")
+}
+
+func TestDefaultLogger_JSON(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewDefaultLogger(WithOutput(&buf), WithJSON(true))
+
+	logger.Info("connected", "id", "conn-1", "count", 2, "error", errors.New("test error"))
+
+	var out map[string]interface{}
+	require.Nil(t, json.Unmarshal(buf.Bytes(), &out))
+	assert.Equal(t, "INFO", out["level"])
+	assert.Equal(t, "connected", out["msg"])
+	assert.Equal(t, "conn-1", out["id"])
+	assert.Equal(t, float64(2), out["count"])
+	assert.Equal(t, "test error", out["error"])
+	assert.NotEmpty(t, out["time"])
+}
+
+func TestDefaultLogger_With(t *testing.T) {
+	var buf bytes.Buffer
+	parent := NewDefaultLogger(WithOutput(&buf), WithJSON(true))
+	child := With(parent, "id", "conn-1")
+	With(child, "user_id", "user-1").Warn("rate limit exceeded", "count", 3)
+
+	var out map[string]interface{}
+	require.Nil(t, json.Unmarshal(buf.Bytes(), &out))
+	assert.Equal(t, "conn-1", out["id"])
+	assert.Equal(t, "user-1", out["user_id"])
+	assert.Equal(t, float64(3), out["count"])
+
+	// the parent logger doesn't have the child fields.
+	buf.Reset()
+	parent.Warn("parent")
+	assert.NotContains(t, buf.String(), "conn-1")
+}
+
+func TestWith_NotChildLogger(t *testing.T) {
+	logger := &recordLogger{}
+	With(With(logger, "id", "conn-1"), "user_id", "user-1").Error("failed", "error", "test")
+
+	assert.Equal(t, []interface{}{"id", "conn-1", "user_id", "user-1", "error", "test"}, logger.keyValues)
+	assert.Same(t, logger, With(logger))
+}
+
+type recordLogger struct {
+	keyValues []interface{}
+}
+
+func (l *recordLogger) Info(_ string, keyValues ...interface{})  { l.keyValues = keyValues }
+func (l *recordLogger) Error(_ string, keyValues ...interface{}) { l.keyValues = keyValues }
+func (l *recordLogger) Warn(_ string, keyValues ...interface{})  { l.keyValues = keyValues }
+func (l *recordLogger) Debug(_ string, keyValues ...interface{}) { l.keyValues = keyValues }
@@ -11,3 +11,61 @@ type Logger interface {
 	Warn(msg string, keyValues ...interface{})
 	Debug(msg string, keyValues ...interface{})
 }
+
+// ChildLogger is an interface for the loggers that can create a child logger
+// which adds the input key-value pairs to all its messages.
+type ChildLogger interface {
+	With(keyValues ...interface{}) Logger
+}
+
+// With returns a child logger that adds the input key-value pairs to all its
+// messages. It uses the ChildLogger.With method if the input logger implements
+// it. Otherwise, it wraps the input logger.
+func With(logger Logger, keyValues ...interface{}) Logger {
+	if len(keyValues) == 0 {
+		return logger
+	}
+
+	if child, ok := logger.(ChildLogger); ok {
+		return child.With(keyValues...)
+	}
+
+	return &childLogger{parent: logger, keyValues: keyValues}
+}
+
+// childLogger prepends the key-value pairs to the key-value pairs of each
+// message and passes the message to the parent logger.
+type childLogger struct {
+	parent    Logger
+	keyValues []interface{}
+}
+
+func (l *childLogger) with(keyValues []interface{}) []interface{} {
+	return append(append(make([]interface{}, 0, len(l.keyValues)+len(keyValues)), l.keyValues...), keyValues...)
+}
+
+// Info writes message to the parent logger with info level.
+func (l *childLogger) Info(msg string, keyValues ...interface{}) {
+	l.parent.Info(msg, l.with(keyValues)...)
+}
+
+// Error writes message to the parent logger with error level.
+func (l *childLogger) Error(msg string, keyValues ...interface{}) {
+	l.parent.Error(msg, l.with(keyValues)...)
+}
+
+// Warn writes message to the parent logger with warn level.
+func (l *childLogger) Warn(msg string, keyValues ...interface{}) {
+	l.parent.Warn(msg, l.with(keyValues)...)
+}
+
+// Debug writes message to the parent logger with debug level.
+func (l *childLogger) Debug(msg string, keyValues ...interface{}) {
+	l.parent.Debug(msg, l.with(keyValues)...)
+}
+
+// With returns a child logger that adds the input key-value pairs after the
+// key-value pairs of the receiver.
+func (l *childLogger) With(keyValues ...interface{}) Logger {
+	return &childLogger{parent: l.parent, keyValues: l.with(keyValues)}
+}
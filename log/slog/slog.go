@@ -0,0 +1,61 @@
+//go:build go1.21
+
+/**
+ * Copyright © 2022 Hamed Yousefi <hdyousefi@gmail.com>.
+ */
+
+// Package slog implements the Channelize log.Logger interface on top of the
+// standard library log/slog package.
+package slog
+
+import (
+	"log/slog"
+
+	"github.com/hmdsefi/channelize/log"
+)
+
+var (
+	_ log.Logger      = (*Logger)(nil)
+	_ log.ChildLogger = (*Logger)(nil)
+)
+
+// Logger wraps a slog.Logger.
+type Logger struct {
+	logger *slog.Logger
+}
+
+// New creates a new Logger that writes the messages to the input slog.Logger.
+// It uses slog.Default if the input logger is nil.
+func New(logger *slog.Logger) *Logger {
+	if logger == nil {
+		logger = slog.Default()
+	}
+
+	return &Logger{logger: logger}
+}
+
+// Info writes message to the log with info level.
+func (l *Logger) Info(msg string, keyValues ...interface{}) {
+	l.logger.Info(msg, keyValues...)
+}
+
+// Error writes message to the log with error level.
+func (l *Logger) Error(msg string, keyValues ...interface{}) {
+	l.logger.Error(msg, keyValues...)
+}
+
+// Warn writes message to the log with warn level.
+func (l *Logger) Warn(msg string, keyValues ...interface{}) {
+	l.logger.Warn(msg, keyValues...)
+}
+
+// Debug writes message to the log with debug level.
+func (l *Logger) Debug(msg string, keyValues ...interface{}) {
+	l.logger.Debug(msg, keyValues...)
+}
+
+// With returns a child logger that adds the input key-value pairs to all its
+// messages.
+func (l *Logger) With(keyValues ...interface{}) log.Logger {
+	return &Logger{logger: l.logger.With(keyValues...)}
+}
@@ -0,0 +1,32 @@
+//go:build go1.21
+
+/**
+ * Copyright © 2022 Hamed Yousefi <hdyousefi@gmail.com>.
+ */
+
+package slog
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLogger(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelInfo})))
+
+	logger.Debug("debug")
+	logger.With("id", "conn-1").Error("failed to read message", "error", "unexpected EOF")
+
+	var out map[string]interface{}
+	require.Nil(t, json.Unmarshal(buf.Bytes(), &out))
+	assert.Equal(t, "ERROR", out["level"])
+	assert.Equal(t, "failed to read message", out["msg"])
+	assert.Equal(t, "conn-1", out["id"])
+	assert.Equal(t, "unexpected EOF", out["error"])
+}
@@ -0,0 +1,19 @@
+module github.com/hmdsefi/channelize/log/zap
+
+go 1.19
+
+require (
+	github.com/hmdsefi/channelize v0.0.0
+	github.com/stretchr/testify v1.8.3
+	go.uber.org/zap v1.24.0
+)
+
+require (
+	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
+	go.uber.org/atomic v1.7.0 // indirect
+	go.uber.org/multierr v1.6.0 // indirect
+	gopkg.in/yaml.v3 v3.0.1 // indirect
+)
+
+replace github.com/hmdsefi/channelize => ../..
@@ -0,0 +1,54 @@
+/**
+ * Copyright © 2022 Hamed Yousefi <hdyousefi@gmail.com>.
+ */
+
+// Package zap implements the Channelize log.Logger interface on top of the
+// zap sugared logger.
+package zap
+
+import (
+	"go.uber.org/zap"
+
+	"github.com/hmdsefi/channelize/log"
+)
+
+var (
+	_ log.Logger      = (*Logger)(nil)
+	_ log.ChildLogger = (*Logger)(nil)
+)
+
+// Logger wraps a zap.SugaredLogger.
+type Logger struct {
+	logger *zap.SugaredLogger
+}
+
+// New creates a new Logger that writes the messages to the input zap.Logger.
+func New(logger *zap.Logger) *Logger {
+	return &Logger{logger: logger.Sugar()}
+}
+
+// Info writes message to the log with info level.
+func (l *Logger) Info(msg string, keyValues ...interface{}) {
+	l.logger.Infow(msg, keyValues...)
+}
+
+// Error writes message to the log with error level.
+func (l *Logger) Error(msg string, keyValues ...interface{}) {
+	l.logger.Errorw(msg, keyValues...)
+}
+
+// Warn writes message to the log with warn level.
+func (l *Logger) Warn(msg string, keyValues ...interface{}) {
+	l.logger.Warnw(msg, keyValues...)
+}
+
+// Debug writes message to the log with debug level.
+func (l *Logger) Debug(msg string, keyValues ...interface{}) {
+	l.logger.Debugw(msg, keyValues...)
+}
+
+// With returns a child logger that adds the input key-value pairs to all its
+// messages.
+func (l *Logger) With(keyValues ...interface{}) log.Logger {
+	return &Logger{logger: l.logger.With(keyValues...)}
+}
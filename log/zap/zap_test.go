@@ -0,0 +1,29 @@
+/**
+ * Copyright © 2022 Hamed Yousefi <hdyousefi@gmail.com>.
+ */
+
+package zap
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestLogger(t *testing.T) {
+	core, logs := observer.New(zapcore.InfoLevel)
+	logger := New(zap.New(core))
+
+	logger.Debug("debug")
+	logger.With("id", "conn-1").Error("failed to read message", "error", "unexpected EOF")
+
+	entries := logs.AllUntimed()
+	require.Len(t, entries, 1)
+	assert.Equal(t, zapcore.ErrorLevel, entries[0].Level)
+	assert.Equal(t, "failed to read message", entries[0].Message)
+	assert.Equal(t, map[string]interface{}{"id": "conn-1", "error": "unexpected EOF"}, entries[0].ContextMap())
+}
@@ -0,0 +1,20 @@
+module github.com/hmdsefi/channelize/log/zerolog
+
+go 1.19
+
+require (
+	github.com/hmdsefi/channelize v0.0.0
+	github.com/rs/zerolog v1.29.1
+	github.com/stretchr/testify v1.8.3
+)
+
+require (
+	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/mattn/go-colorable v0.1.12 // indirect
+	github.com/mattn/go-isatty v0.0.14 // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
+	golang.org/x/sys v0.8.0 // indirect
+	gopkg.in/yaml.v3 v3.0.1 // indirect
+)
+
+replace github.com/hmdsefi/channelize => ../..
@@ -0,0 +1,68 @@
+/**
+ * Copyright © 2022 Hamed Yousefi <hdyousefi@gmail.com>.
+ */
+
+// Package zerolog implements the Channelize log.Logger interface on top of
+// the zerolog logger.
+package zerolog
+
+import (
+	"github.com/rs/zerolog"
+
+	"github.com/hmdsefi/channelize/log"
+)
+
+// badKey is the key of the last value if the number of key-value items is odd.
+const badKey = "!BADKEY"
+
+var (
+	_ log.Logger      = (*Logger)(nil)
+	_ log.ChildLogger = (*Logger)(nil)
+)
+
+// Logger wraps a zerolog.Logger.
+type Logger struct {
+	logger zerolog.Logger
+}
+
+// New creates a new Logger that writes the messages to the input zerolog.Logger.
+func New(logger zerolog.Logger) *Logger {
+	return &Logger{logger: logger}
+}
+
+// Info writes message to the log with info level.
+func (l *Logger) Info(msg string, keyValues ...interface{}) {
+	l.logger.Info().Fields(fields(keyValues)).Msg(msg)
+}
+
+// Error writes message to the log with error level.
+func (l *Logger) Error(msg string, keyValues ...interface{}) {
+	l.logger.Error().Fields(fields(keyValues)).Msg(msg)
+}
+
+// Warn writes message to the log with warn level.
+func (l *Logger) Warn(msg string, keyValues ...interface{}) {
+	l.logger.Warn().Fields(fields(keyValues)).Msg(msg)
+}
+
+// Debug writes message to the log with debug level.
+func (l *Logger) Debug(msg string, keyValues ...interface{}) {
+	l.logger.Debug().Fields(fields(keyValues)).Msg(msg)
+}
+
+// With returns a child logger that adds the input key-value pairs to all its
+// messages.
+func (l *Logger) With(keyValues ...interface{}) log.Logger {
+	return &Logger{logger: l.logger.With().Fields(fields(keyValues)).Logger()}
+}
+
+// fields returns the input key-value pairs. If the number of items is odd,
+// it adds badKey before the last item, since zerolog expects pairs.
+func fields(keyValues []interface{}) []interface{} {
+	if len(keyValues)%2 == 0 {
+		return keyValues
+	}
+
+	last := len(keyValues) - 1
+	return append(append(make([]interface{}, 0, len(keyValues)+1), keyValues[:last]...), badKey, keyValues[last])
+}
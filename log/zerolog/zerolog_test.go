@@ -0,0 +1,31 @@
+/**
+ * Copyright © 2022 Hamed Yousefi <hdyousefi@gmail.com>.
+ */
+
+package zerolog
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLogger(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(zerolog.New(&buf).Level(zerolog.InfoLevel))
+
+	logger.Debug("debug")
+	logger.With("id", "conn-1").Warn("rate limit exceeded", "count", 3, "odd")
+
+	var out map[string]interface{}
+	require.Nil(t, json.Unmarshal(buf.Bytes(), &out))
+	assert.Equal(t, "warn", out["level"])
+	assert.Equal(t, "rate limit exceeded", out["message"])
+	assert.Equal(t, "conn-1", out["id"])
+	assert.Equal(t, float64(3), out["count"])
+	assert.Equal(t, "odd", out[badKey])
+}
@@ -0,0 +1,110 @@
+/**
+ * Copyright © 2022 Hamed Yousefi <hdyousefi@gmail.com>.
+ */
+
+package metrics
+
+import "time"
+
+// Reasons of the dropped messages that are passed to the
+// Collector.MessagesDroppedInc method.
+const (
+	DropReasonBufferFull       = "buffer_full"
+	DropReasonConnectionClosed = "connection_closed"
+	DropReasonUnauthenticated  = "unauthenticated"
+	DropReasonError            = "error"
+	DropReasonFanoutQueueFull  = "fanout_queue_full"
+)
+
+// Collector is an interface for collecting the Channelize metrics. It is
+// implemented by the prometheus, otel, and expvar packages, and it can be
+// implemented for any other metrics backend.
+//
+// The methods are called concurrently from the connection goroutines, so
+// the implementations must be thread safe.
+type Collector interface {
+	// OpenConnectionsInc increases the total number of open connections.
+	OpenConnectionsInc()
+
+	// OpenConnectionsDec decreases the total number of open connections.
+	OpenConnectionsDec()
+
+	// PrivateConnectionsInc increases total number of private connections.
+	PrivateConnectionsInc()
+
+	// PrivateConnectionsDec decreases total number of private connections.
+	PrivateConnectionsDec()
+
+	// SubscribedChannels sets the number of channels that have at least one
+	// subscription in the storage.
+	SubscribedChannels(float64)
+
+	// PrivateConnections sets the number of stored private connections.
+	PrivateConnections(float64)
+
+	// OpenConnections sets the number of stored connections.
+	OpenConnections(float64)
+
+	// ExpiredTokensInc increases the total number of connections that their
+	// private subscriptions are revoked because of token expiration.
+	ExpiredTokensInc()
+
+	// ReauthenticatedTokensInc increases the total number of expired tokens
+	// that are re-authenticated successfully.
+	ReauthenticatedTokensInc()
+
+	// MessagesPublishedInc increases the total number of published messages
+	// of the input channel.
+	MessagesPublishedInc(ch string)
+
+	// MessagesDeliveredInc increases the total number of messages of the input
+	// channel that have been sent to the connections outbound buffer.
+	MessagesDeliveredInc(ch string)
+
+	// MessagesDroppedInc increases the total number of messages of the input
+	// channel that couldn't be sent to the connections.
+	MessagesDroppedInc(ch string, reason string)
+
+	// BufferFullInc increases the total number of outbound messages that have
+	// been rejected because of the full outbound buffer.
+	BufferFullInc()
+
+	// AuthFailuresInc increases the total number of failed authentications.
+	AuthFailuresInc()
+
+	// SubscriptionsInc increases the total number of subscriptions of the
+	// input channel.
+	SubscriptionsInc(ch string)
+
+	// UnsubscriptionsInc increases the total number of removed subscriptions
+	// of the input channel.
+	UnsubscriptionsInc(ch string)
+
+	// QueueLatencyObserve observes the time that an outbound message waited
+	// in the outbound buffer before it has been written to the peer.
+	QueueLatencyObserve(d time.Duration)
+
+	// WriteDurationObserve observes the time of writing an outbound message
+	// to the websocket connection.
+	WriteDurationObserve(d time.Duration)
+
+	// BufferOccupancyObserve observes the ratio of the used outbound buffer
+	// capacity when a message is enqueued.
+	BufferOccupancyObserve(ratio float64)
+
+	// MarshalDurationObserve observes the time of serializing a published
+	// message of the input channel.
+	MarshalDurationObserve(ch string, d time.Duration)
+
+	// FanoutDurationObserve observes the time of sending a published message
+	// of the input channel to all its connections.
+	FanoutDurationObserve(ch string, d time.Duration)
+
+	// FanoutQueueLength sets the number of fan-out tasks that are waiting in
+	// the queues of the fan-out workers.
+	FanoutQueueLength(float64)
+
+	// FanoutQueueLatencyObserve observes the time that a fan-out task waited
+	// in the queue before a fan-out worker picked it.
+	FanoutQueueLatencyObserve(d time.Duration)
+}
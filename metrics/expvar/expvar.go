@@ -0,0 +1,227 @@
+/**
+ * Copyright © 2022 Hamed Yousefi <hdyousefi@gmail.com>.
+ */
+
+// Package expvar implements the Channelize metrics collector by using the
+// standard library expvar package. The metrics are published as a single
+// map, and they are served by the expvar handler at /debug/vars.
+//
+// expvar doesn't support histograms, so the durations are published as the
+// number of observations and their sum in seconds.
+package expvar
+
+import (
+	"expvar"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/hmdsefi/channelize/metrics"
+)
+
+const (
+	keyCount = "count"
+	keySum   = "sum"
+)
+
+var _ metrics.Collector = (*Collector)(nil)
+
+// publishMu prevents publishing the same name by two collectors at once.
+var publishMu sync.Mutex
+
+// Collector collects the Channelize metrics in an expvar map.
+type Collector struct {
+	vars *expvar.Map
+
+	// mu prevents creating the nested maps more than once.
+	mu sync.Mutex
+}
+
+// NewCollector creates a new Collector and publishes its metrics with the
+// input name. It returns error if a variable with the same name is already
+// published, e.g. by another Channelize instance, since sharing the map mixes
+// up the values of the instances.
+func NewCollector(name string) (*Collector, error) {
+	publishMu.Lock()
+	defer publishMu.Unlock()
+
+	if expvar.Get(name) != nil {
+		return nil, fmt.Errorf("expvar variable %q is already published, use a distinct name", name)
+	}
+
+	return &Collector{vars: expvar.NewMap(name)}, nil
+}
+
+// Vars returns the published map of the metrics.
+func (c *Collector) Vars() *expvar.Map {
+	return c.vars
+}
+
+// OpenConnectionsInc increases the number of open connections.
+func (c *Collector) OpenConnectionsInc() {
+	c.vars.Add("open_connections", 1)
+}
+
+// OpenConnectionsDec decreases the number of open connections.
+func (c *Collector) OpenConnectionsDec() {
+	c.vars.Add("open_connections", -1)
+}
+
+// PrivateConnectionsInc increases the number of private connections.
+func (c *Collector) PrivateConnectionsInc() {
+	c.vars.Add("private_connections", 1)
+}
+
+// PrivateConnectionsDec decreases the number of private connections.
+func (c *Collector) PrivateConnectionsDec() {
+	c.vars.Add("private_connections", -1)
+}
+
+// SubscribedChannels sets the number of stored subscribed channels.
+func (c *Collector) SubscribedChannels(in float64) {
+	c.setFloat("subscribed_channels_storage_length", in)
+}
+
+// PrivateConnections sets the number of stored private connections.
+func (c *Collector) PrivateConnections(in float64) {
+	c.setFloat("private_connections_storage_length", in)
+}
+
+// OpenConnections sets the number of stored open connections.
+func (c *Collector) OpenConnections(in float64) {
+	c.setFloat("open_connections_storage_length", in)
+}
+
+// ExpiredTokensInc increases the number of revoked expired tokens.
+func (c *Collector) ExpiredTokensInc() {
+	c.vars.Add("expired_tokens_total", 1)
+}
+
+// ReauthenticatedTokensInc increases the number of re-authenticated tokens.
+func (c *Collector) ReauthenticatedTokensInc() {
+	c.vars.Add("reauthenticated_tokens_total", 1)
+}
+
+// MessagesPublishedInc increases the number of published messages of the
+// input channel.
+func (c *Collector) MessagesPublishedInc(ch string) {
+	c.child(c.vars, "messages_published_total").Add(ch, 1)
+}
+
+// MessagesDeliveredInc increases the number of delivered messages of the
+// input channel.
+func (c *Collector) MessagesDeliveredInc(ch string) {
+	c.child(c.vars, "messages_delivered_total").Add(ch, 1)
+}
+
+// MessagesDroppedInc increases the number of dropped messages of the input
+// channel and reason.
+func (c *Collector) MessagesDroppedInc(ch string, reason string) {
+	c.child(c.child(c.vars, "messages_dropped_total"), ch).Add(reason, 1)
+}
+
+// BufferFullInc increases the number of rejected outbound messages because
+// of the full buffer.
+func (c *Collector) BufferFullInc() {
+	c.vars.Add("outbound_buffer_full_total", 1)
+}
+
+// AuthFailuresInc increases the number of failed authentications.
+func (c *Collector) AuthFailuresInc() {
+	c.vars.Add("auth_failures_total", 1)
+}
+
+// SubscriptionsInc increases the number of subscriptions of the input channel.
+func (c *Collector) SubscriptionsInc(ch string) {
+	c.child(c.vars, "subscriptions_total").Add(ch, 1)
+}
+
+// UnsubscriptionsInc increases the number of removed subscriptions of the
+// input channel.
+func (c *Collector) UnsubscriptionsInc(ch string) {
+	c.child(c.vars, "unsubscriptions_total").Add(ch, 1)
+}
+
+// QueueLatencyObserve records the time that a message waited in the outbound
+// buffer.
+func (c *Collector) QueueLatencyObserve(d time.Duration) {
+	observe(c.child(c.vars, "outbound_queue_latency_seconds"), d.Seconds())
+}
+
+// WriteDurationObserve records the time of writing a message to the peer.
+func (c *Collector) WriteDurationObserve(d time.Duration) {
+	observe(c.child(c.vars, "write_duration_seconds"), d.Seconds())
+}
+
+// BufferOccupancyObserve records the ratio of the used outbound buffer capacity.
+func (c *Collector) BufferOccupancyObserve(ratio float64) {
+	observe(c.child(c.vars, "outbound_buffer_occupancy_ratio"), ratio)
+}
+
+// MarshalDurationObserve records the time of serializing a message of the
+// input channel.
+func (c *Collector) MarshalDurationObserve(ch string, d time.Duration) {
+	observe(c.child(c.child(c.vars, "marshal_duration_seconds"), ch), d.Seconds())
+}
+
+// FanoutDurationObserve records the time of sending a message of the input
+// channel to all its connections.
+func (c *Collector) FanoutDurationObserve(ch string, d time.Duration) {
+	observe(c.child(c.child(c.vars, "fanout_duration_seconds"), ch), d.Seconds())
+}
+
+// FanoutQueueLength sets the number of queued fan-out tasks.
+func (c *Collector) FanoutQueueLength(in float64) {
+	c.setFloat("fanout_queue_length", in)
+}
+
+// FanoutQueueLatencyObserve records the time that a fan-out task waited in
+// the fan-out queue.
+func (c *Collector) FanoutQueueLatencyObserve(d time.Duration) {
+	observe(c.child(c.vars, "fanout_queue_latency_seconds"), d.Seconds())
+}
+
+// setFloat sets the value of the input key.
+func (c *Collector) setFloat(key string, val float64) {
+	if v, ok := c.vars.Get(key).(*expvar.Float); ok {
+		v.Set(val)
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	v, ok := c.vars.Get(key).(*expvar.Float)
+	if !ok {
+		v = new(expvar.Float)
+		c.vars.Set(key, v)
+	}
+
+	v.Set(val)
+}
+
+// child returns the nested map of the input key. It creates the nested map
+// if it doesn't exist.
+func (c *Collector) child(parent *expvar.Map, key string) *expvar.Map {
+	if m, ok := parent.Get(key).(*expvar.Map); ok {
+		return m
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	m, ok := parent.Get(key).(*expvar.Map)
+	if !ok {
+		m = new(expvar.Map).Init()
+		parent.Set(key, m)
+	}
+
+	return m
+}
+
+// observe adds the input value to the sum and increases the count of the
+// input map.
+func observe(m *expvar.Map, val float64) {
+	m.Add(keyCount, 1)
+	m.AddFloat(keySum, val)
+}
@@ -0,0 +1,79 @@
+/**
+ * Copyright © 2022 Hamed Yousefi <hdyousefi@gmail.com>.
+ */
+
+package expvar
+
+import (
+	"encoding/json"
+	"expvar"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCollector(t *testing.T) {
+	collector, err := NewCollector("channelize_test")
+	require.NoError(t, err)
+
+	collector.OpenConnectionsInc()
+	collector.OpenConnectionsInc()
+	collector.OpenConnectionsDec()
+	collector.SubscribedChannels(3)
+	collector.SubscribedChannels(2)
+	collector.MessagesPublishedInc("feed")
+	collector.MessagesDroppedInc("feed", "buffer_full")
+	collector.MessagesDroppedInc("feed", "buffer_full")
+	collector.FanoutDurationObserve("feed", time.Second)
+	collector.FanoutDurationObserve("feed", time.Second)
+	collector.FanoutQueueLength(5)
+	collector.FanoutQueueLatencyObserve(time.Second)
+
+	var vars struct {
+		OpenConnections    int64                       `json:"open_connections"`
+		SubscribedChannels float64                     `json:"subscribed_channels_storage_length"`
+		Published          map[string]int64            `json:"messages_published_total"`
+		Dropped            map[string]map[string]int64 `json:"messages_dropped_total"`
+		Fanout             map[string]struct {
+			Count int64   `json:"count"`
+			Sum   float64 `json:"sum"`
+		} `json:"fanout_duration_seconds"`
+		FanoutQueueLength  float64 `json:"fanout_queue_length"`
+		FanoutQueueLatency struct {
+			Count int64 `json:"count"`
+		} `json:"fanout_queue_latency_seconds"`
+	}
+	require.Nil(t, json.Unmarshal([]byte(collector.Vars().String()), &vars))
+
+	assert.Equal(t, int64(1), vars.OpenConnections)
+	assert.Equal(t, float64(2), vars.SubscribedChannels)
+	assert.Equal(t, int64(1), vars.Published["feed"])
+	assert.Equal(t, int64(2), vars.Dropped["feed"]["buffer_full"])
+	assert.Equal(t, int64(2), vars.Fanout["feed"].Count)
+	assert.Equal(t, float64(2), vars.Fanout["feed"].Sum)
+	assert.Equal(t, float64(5), vars.FanoutQueueLength)
+	assert.Equal(t, int64(1), vars.FanoutQueueLatency.Count)
+}
+
+func TestNewCollector_DuplicateName(t *testing.T) {
+	t.Run("published collector", func(t *testing.T) {
+		_, err := NewCollector("channelize_duplicate_test")
+		require.NoError(t, err)
+
+		collector, err := NewCollector("channelize_duplicate_test")
+		assert.Error(t, err)
+		assert.Nil(t, collector)
+	})
+
+	t.Run("published non-map variable", func(t *testing.T) {
+		expvar.NewInt("channelize_duplicate_int_test")
+
+		var err error
+		require.NotPanics(t, func() {
+			_, err = NewCollector("channelize_duplicate_int_test")
+		})
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,322 @@
+/**
+ * Copyright © 2022 Hamed Yousefi <hdyousefi@gmail.com>.
+ */
+
+// Package otel implements the Channelize metrics collector by using the
+// OpenTelemetry metrics API.
+package otel
+
+import (
+	"context"
+	"math"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+
+	"github.com/hmdsefi/channelize/metrics"
+)
+
+const (
+	attrChannel = "channel"
+	attrReason  = "reason"
+)
+
+var _ metrics.Collector = (*Collector)(nil)
+
+// Collector collects the Channelize metrics by using an OpenTelemetry meter.
+type Collector struct {
+	// subscribedChannels, openConnectionsSet, privateConnectionsSet, and
+	// fanoutQueueLength store the float64 bits of the last values that are
+	// observed by the gauge callback. They are the first fields to keep the
+	// 64-bit alignment for the atomic operations on 32-bit platforms.
+	subscribedChannels    uint64
+	openConnectionsSet    uint64
+	privateConnectionsSet uint64
+	fanoutQueueLength     uint64
+
+	openConnections       metric.Int64UpDownCounter
+	privateConnections    metric.Int64UpDownCounter
+	expiredTokens         metric.Int64Counter
+	reauthenticatedTokens metric.Int64Counter
+	messagesPublished     metric.Int64Counter
+	messagesDelivered     metric.Int64Counter
+	messagesDropped       metric.Int64Counter
+	bufferFull            metric.Int64Counter
+	authFailures          metric.Int64Counter
+	subscriptions         metric.Int64Counter
+	unsubscriptions       metric.Int64Counter
+	queueLatency          metric.Float64Histogram
+	writeDuration         metric.Float64Histogram
+	bufferOccupancy       metric.Float64Histogram
+	marshalDuration       metric.Float64Histogram
+	fanoutDuration        metric.Float64Histogram
+	fanoutQueueLatency    metric.Float64Histogram
+}
+
+// NewCollector creates the instruments by using the input meter. It returns
+// error if the meter fails to create an instrument.
+func NewCollector(meter metric.Meter) (*Collector, error) {
+	var err error
+	c := new(Collector)
+
+	// keep the first error and skip creating the rest of the instruments.
+	upDownCounter := func(name, description string) metric.Int64UpDownCounter {
+		if err != nil {
+			return nil
+		}
+
+		var instrument metric.Int64UpDownCounter
+		instrument, err = meter.Int64UpDownCounter(name, metric.WithDescription(description))
+		return instrument
+	}
+
+	counter := func(name, description string) metric.Int64Counter {
+		if err != nil {
+			return nil
+		}
+
+		var instrument metric.Int64Counter
+		instrument, err = meter.Int64Counter(name, metric.WithDescription(description))
+		return instrument
+	}
+
+	histogram := func(name, description, unit string) metric.Float64Histogram {
+		if err != nil {
+			return nil
+		}
+
+		var instrument metric.Float64Histogram
+		instrument, err = meter.Float64Histogram(name, metric.WithDescription(description), metric.WithUnit(unit))
+		return instrument
+	}
+
+	c.openConnections = upDownCounter("open_connections", "Number of open connections")
+	c.privateConnections = upDownCounter("private_connections", "Number of private connections")
+	c.expiredTokens = counter("expired_tokens", "Number of expired tokens that have been revoked")
+	c.reauthenticatedTokens = counter("reauthenticated_tokens", "Number of expired tokens that have been re-authenticated")
+	c.messagesPublished = counter("messages_published", "Number of published messages")
+	c.messagesDelivered = counter("messages_delivered", "Number of messages that have been sent to the connections")
+	c.messagesDropped = counter("messages_dropped", "Number of messages that couldn't be sent to the connections")
+	c.bufferFull = counter("outbound_buffer_full", "Number of messages rejected because of the full outbound buffer")
+	c.authFailures = counter("auth_failures", "Number of failed authentications")
+	c.subscriptions = counter("subscriptions", "Number of new subscriptions")
+	c.unsubscriptions = counter("unsubscriptions", "Number of removed subscriptions")
+	c.queueLatency = histogram(
+		"outbound_queue_latency",
+		"Time between sending a message to the outbound buffer and writing it to the peer",
+		"s",
+	)
+	c.writeDuration = histogram("write_duration", "Time of writing a message to the websocket connection", "s")
+	c.bufferOccupancy = histogram(
+		"outbound_buffer_occupancy",
+		"Ratio of the used outbound buffer capacity when a message is enqueued",
+		"1",
+	)
+	c.marshalDuration = histogram("marshal_duration", "Time of serializing a published message", "s")
+	c.fanoutDuration = histogram(
+		"fanout_duration",
+		"Time of sending a published message to all the connections of the channel",
+		"s",
+	)
+	c.fanoutQueueLatency = histogram(
+		"fanout_queue_latency",
+		"Time that a fan-out task waited in the fan-out queue before a worker picked it",
+		"s",
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = c.registerGauges(meter); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// registerGauges creates the storage length and fan-out queue length gauges,
+// and registers a callback that observes their last values.
+func (c *Collector) registerGauges(meter metric.Meter) error {
+	subscribedChannels, err := meter.Float64ObservableGauge(
+		"subscribed_channels_storage_length",
+		metric.WithDescription("Number of subscribed channels that are stored"),
+	)
+	if err != nil {
+		return err
+	}
+
+	openConnections, err := meter.Float64ObservableGauge(
+		"open_connections_storage_length",
+		metric.WithDescription("Number of stored open connections"),
+	)
+	if err != nil {
+		return err
+	}
+
+	privateConnections, err := meter.Float64ObservableGauge(
+		"private_connections_storage_length",
+		metric.WithDescription("Number of stored private connections"),
+	)
+	if err != nil {
+		return err
+	}
+
+	fanoutQueueLength, err := meter.Float64ObservableGauge(
+		"fanout_queue_length",
+		metric.WithDescription("Number of fan-out tasks that are waiting in the fan-out queues"),
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = meter.RegisterCallback(func(_ context.Context, observer metric.Observer) error {
+		observer.ObserveFloat64(subscribedChannels, loadFloat64(&c.subscribedChannels))
+		observer.ObserveFloat64(openConnections, loadFloat64(&c.openConnectionsSet))
+		observer.ObserveFloat64(privateConnections, loadFloat64(&c.privateConnectionsSet))
+		observer.ObserveFloat64(fanoutQueueLength, loadFloat64(&c.fanoutQueueLength))
+		return nil
+	}, subscribedChannels, openConnections, privateConnections, fanoutQueueLength)
+
+	return err
+}
+
+// OpenConnectionsInc increases the number of open connections.
+func (c *Collector) OpenConnectionsInc() {
+	c.openConnections.Add(context.Background(), 1)
+}
+
+// OpenConnectionsDec decreases the number of open connections.
+func (c *Collector) OpenConnectionsDec() {
+	c.openConnections.Add(context.Background(), -1)
+}
+
+// PrivateConnectionsInc increases the number of private connections.
+func (c *Collector) PrivateConnectionsInc() {
+	c.privateConnections.Add(context.Background(), 1)
+}
+
+// PrivateConnectionsDec decreases the number of private connections.
+func (c *Collector) PrivateConnectionsDec() {
+	c.privateConnections.Add(context.Background(), -1)
+}
+
+// SubscribedChannels sets the number of stored subscribed channels.
+func (c *Collector) SubscribedChannels(in float64) {
+	storeFloat64(&c.subscribedChannels, in)
+}
+
+// PrivateConnections sets the number of stored private connections.
+func (c *Collector) PrivateConnections(in float64) {
+	storeFloat64(&c.privateConnectionsSet, in)
+}
+
+// OpenConnections sets the number of stored open connections.
+func (c *Collector) OpenConnections(in float64) {
+	storeFloat64(&c.openConnectionsSet, in)
+}
+
+// ExpiredTokensInc increases the number of revoked expired tokens.
+func (c *Collector) ExpiredTokensInc() {
+	c.expiredTokens.Add(context.Background(), 1)
+}
+
+// ReauthenticatedTokensInc increases the number of re-authenticated tokens.
+func (c *Collector) ReauthenticatedTokensInc() {
+	c.reauthenticatedTokens.Add(context.Background(), 1)
+}
+
+// MessagesPublishedInc increases the number of published messages of the
+// input channel.
+func (c *Collector) MessagesPublishedInc(ch string) {
+	c.messagesPublished.Add(context.Background(), 1, withChannel(ch))
+}
+
+// MessagesDeliveredInc increases the number of delivered messages of the
+// input channel.
+func (c *Collector) MessagesDeliveredInc(ch string) {
+	c.messagesDelivered.Add(context.Background(), 1, withChannel(ch))
+}
+
+// MessagesDroppedInc increases the number of dropped messages of the input
+// channel and reason.
+func (c *Collector) MessagesDroppedInc(ch string, reason string) {
+	c.messagesDropped.Add(
+		context.Background(), 1,
+		metric.WithAttributes(attribute.String(attrChannel, ch), attribute.String(attrReason, reason)),
+	)
+}
+
+// BufferFullInc increases the number of rejected outbound messages because
+// of the full buffer.
+func (c *Collector) BufferFullInc() {
+	c.bufferFull.Add(context.Background(), 1)
+}
+
+// AuthFailuresInc increases the number of failed authentications.
+func (c *Collector) AuthFailuresInc() {
+	c.authFailures.Add(context.Background(), 1)
+}
+
+// SubscriptionsInc increases the number of subscriptions of the input channel.
+func (c *Collector) SubscriptionsInc(ch string) {
+	c.subscriptions.Add(context.Background(), 1, withChannel(ch))
+}
+
+// UnsubscriptionsInc increases the number of removed subscriptions of the
+// input channel.
+func (c *Collector) UnsubscriptionsInc(ch string) {
+	c.unsubscriptions.Add(context.Background(), 1, withChannel(ch))
+}
+
+// QueueLatencyObserve records the time that a message waited in the outbound
+// buffer.
+func (c *Collector) QueueLatencyObserve(d time.Duration) {
+	c.queueLatency.Record(context.Background(), d.Seconds())
+}
+
+// WriteDurationObserve records the time of writing a message to the peer.
+func (c *Collector) WriteDurationObserve(d time.Duration) {
+	c.writeDuration.Record(context.Background(), d.Seconds())
+}
+
+// BufferOccupancyObserve records the ratio of the used outbound buffer capacity.
+func (c *Collector) BufferOccupancyObserve(ratio float64) {
+	c.bufferOccupancy.Record(context.Background(), ratio)
+}
+
+// MarshalDurationObserve records the time of serializing a message of the
+// input channel.
+func (c *Collector) MarshalDurationObserve(ch string, d time.Duration) {
+	c.marshalDuration.Record(context.Background(), d.Seconds(), withChannel(ch))
+}
+
+// FanoutDurationObserve records the time of sending a message of the input
+// channel to all its connections.
+func (c *Collector) FanoutDurationObserve(ch string, d time.Duration) {
+	c.fanoutDuration.Record(context.Background(), d.Seconds(), withChannel(ch))
+}
+
+// FanoutQueueLength sets the number of queued fan-out tasks.
+func (c *Collector) FanoutQueueLength(in float64) {
+	storeFloat64(&c.fanoutQueueLength, in)
+}
+
+// FanoutQueueLatencyObserve records the time that a fan-out task waited in
+// the fan-out queue.
+func (c *Collector) FanoutQueueLatencyObserve(d time.Duration) {
+	c.fanoutQueueLatency.Record(context.Background(), d.Seconds())
+}
+
+func withChannel(ch string) metric.MeasurementOption {
+	return metric.WithAttributes(attribute.String(attrChannel, ch))
+}
+
+func storeFloat64(addr *uint64, val float64) {
+	atomic.StoreUint64(addr, math.Float64bits(val))
+}
+
+func loadFloat64(addr *uint64) float64 {
+	return math.Float64frombits(atomic.LoadUint64(addr))
+}
@@ -0,0 +1,76 @@
+/**
+ * Copyright © 2022 Hamed Yousefi <hdyousefi@gmail.com>.
+ */
+
+package otel
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+func TestCollector(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	provider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+
+	collector, err := NewCollector(provider.Meter("channelize"))
+	require.Nil(t, err)
+
+	collector.OpenConnectionsInc()
+	collector.OpenConnectionsInc()
+	collector.OpenConnectionsDec()
+	collector.SubscribedChannels(3)
+	collector.MessagesPublishedInc("feed")
+	collector.MessagesPublishedInc("feed")
+	collector.MessagesDroppedInc("feed", "buffer_full")
+	collector.FanoutDurationObserve("feed", time.Millisecond)
+	collector.FanoutQueueLength(4)
+	collector.FanoutQueueLatencyObserve(time.Millisecond)
+
+	var rm metricdata.ResourceMetrics
+	require.Nil(t, reader.Collect(context.Background(), &rm))
+	require.Len(t, rm.ScopeMetrics, 1)
+
+	data := make(map[string]metricdata.Aggregation)
+	for _, m := range rm.ScopeMetrics[0].Metrics {
+		data[m.Name] = m.Data
+	}
+
+	openConnections, ok := data["open_connections"].(metricdata.Sum[int64])
+	require.True(t, ok)
+	assert.Equal(t, int64(1), openConnections.DataPoints[0].Value)
+
+	subscribedChannels, ok := data["subscribed_channels_storage_length"].(metricdata.Gauge[float64])
+	require.True(t, ok)
+	assert.Equal(t, float64(3), subscribedChannels.DataPoints[0].Value)
+
+	published, ok := data["messages_published"].(metricdata.Sum[int64])
+	require.True(t, ok)
+	assert.Equal(t, int64(2), published.DataPoints[0].Value)
+	ch, _ := published.DataPoints[0].Attributes.Value(attrChannel)
+	assert.Equal(t, attribute.StringValue("feed"), ch)
+
+	dropped, ok := data["messages_dropped"].(metricdata.Sum[int64])
+	require.True(t, ok)
+	reason, _ := dropped.DataPoints[0].Attributes.Value(attrReason)
+	assert.Equal(t, attribute.StringValue("buffer_full"), reason)
+
+	fanout, ok := data["fanout_duration"].(metricdata.Histogram[float64])
+	require.True(t, ok)
+	assert.Equal(t, uint64(1), fanout.DataPoints[0].Count)
+
+	queueLength, ok := data["fanout_queue_length"].(metricdata.Gauge[float64])
+	require.True(t, ok)
+	assert.Equal(t, float64(4), queueLength.DataPoints[0].Value)
+
+	queueLatency, ok := data["fanout_queue_latency"].(metricdata.Histogram[float64])
+	require.True(t, ok)
+	assert.Equal(t, uint64(1), queueLatency.DataPoints[0].Count)
+}
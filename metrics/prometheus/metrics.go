@@ -0,0 +1,445 @@
+/**
+ * Copyright © 2022 Hamed Yousefi <hdyousefi@gmail.com>.
+ */
+
+// Package prometheus implements the Channelize metrics collector by using
+// the prometheus client. It is the default collector of Channelize.
+package prometheus
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/hmdsefi/channelize/metrics"
+)
+
+const (
+	labelChannel = "channel"
+	labelReason  = "reason"
+)
+
+var (
+	// defaultLatencyBuckets are the default buckets of the latency histograms
+	// in seconds, from 50µs to ~1.6s.
+	defaultLatencyBuckets = prometheus.ExponentialBuckets(0.00005, 2, 16)
+
+	// occupancyBuckets are the buckets of the outbound buffer occupancy ratio.
+	occupancyBuckets = prometheus.LinearBuckets(0.1, 0.1, 10)
+)
+
+var _ metrics.Collector = (*Metrics)(nil)
+
+// Config represents the metrics configuration.
+type Config struct {
+	// registerer registers the metrics. The default value is the prometheus
+	// default registerer.
+	registerer prometheus.Registerer
+
+	// namespace is the prefix of all the metric names.
+	namespace string
+
+	// constLabels are the labels with fixed values that are added to all
+	// the metrics.
+	constLabels prometheus.Labels
+
+	// latencyBuckets are the buckets of the latency histograms in seconds.
+	latencyBuckets []float64
+}
+
+type Option func(*Config)
+
+// WithRegisterer sets the registerer of the metrics.
+func WithRegisterer(registerer prometheus.Registerer) Option {
+	return func(config *Config) {
+		if config == nil || registerer == nil {
+			return
+		}
+
+		config.registerer = registerer
+	}
+}
+
+// WithNamespace sets the prefix of the metric names.
+func WithNamespace(namespace string) Option {
+	return func(config *Config) {
+		if config == nil {
+			return
+		}
+
+		config.namespace = namespace
+	}
+}
+
+// WithConstLabels sets the labels with fixed values that are added to all
+// the metrics, e.g. the instance name.
+func WithConstLabels(labels prometheus.Labels) Option {
+	return func(config *Config) {
+		if config == nil {
+			return
+		}
+
+		config.constLabels = labels
+	}
+}
+
+// WithLatencyBuckets sets the buckets of the latency histograms in seconds.
+func WithLatencyBuckets(buckets []float64) Option {
+	return func(config *Config) {
+		if config == nil || len(buckets) == 0 {
+			return
+		}
+
+		config.latencyBuckets = buckets
+	}
+}
+
+// Metrics represents application metrics. It is responsible to manages the
+// application metrics and registers them in prometheus.
+type Metrics struct {
+	// openConnections represents total number of open connections.
+	openConnections prometheus.Gauge
+
+	// privateConnections represents total number of private connections.
+	privateConnections prometheus.Gauge
+
+	subscribedChannelsSet prometheus.Gauge
+	openConnectionsSet    prometheus.Gauge
+	privateConnectionsSet prometheus.Gauge
+
+	// expiredTokens represents total number of expired tokens that have been
+	// revoked by the token sweeper.
+	expiredTokens prometheus.Counter
+
+	// reauthenticatedTokens represents total number of expired tokens that
+	// have been re-authenticated by the token sweeper.
+	reauthenticatedTokens prometheus.Counter
+
+	// messagesPublished represents total number of published messages per channel.
+	messagesPublished *prometheus.CounterVec
+
+	// messagesDelivered represents total number of messages per channel that
+	// have been sent to the connections outbound buffer.
+	messagesDelivered *prometheus.CounterVec
+
+	// messagesDropped represents total number of messages per channel and
+	// reason that couldn't be sent to the connections.
+	messagesDropped *prometheus.CounterVec
+
+	// bufferFull represents total number of outbound messages that have been
+	// rejected because of the full outbound buffer.
+	bufferFull prometheus.Counter
+
+	// authFailures represents total number of failed authentications.
+	authFailures prometheus.Counter
+
+	// subscriptions represents total number of subscriptions per channel.
+	subscriptions *prometheus.CounterVec
+
+	// unsubscriptions represents total number of removed subscriptions per channel.
+	unsubscriptions *prometheus.CounterVec
+
+	// queueLatency represents the time that the outbound messages waited in
+	// the outbound buffer before they have been written to the peer.
+	queueLatency prometheus.Histogram
+
+	// writeDuration represents the time of writing the outbound messages to
+	// the websocket connections.
+	writeDuration prometheus.Histogram
+
+	// bufferOccupancy represents the ratio of the used outbound buffer
+	// capacity when the messages are enqueued.
+	bufferOccupancy prometheus.Histogram
+
+	// marshalDuration represents the time of serializing the published
+	// messages per channel.
+	marshalDuration *prometheus.HistogramVec
+
+	// fanoutDuration represents the time of sending the published messages
+	// to all the connections per channel.
+	fanoutDuration *prometheus.HistogramVec
+
+	// fanoutQueueLength represents the number of fan-out tasks that are
+	// waiting in the fan-out queues.
+	fanoutQueueLength prometheus.Gauge
+
+	// fanoutQueueLatency represents the time that the fan-out tasks waited
+	// in the fan-out queues.
+	fanoutQueueLatency prometheus.Histogram
+}
+
+// NewMetrics creates the metrics and registers them. It returns error if a
+// metric is already registered, e.g. by another Channelize instance, since
+// sharing the metrics mixes up the values of the instances. Each instance
+// should use a distinct registerer, namespace, or const labels. Nothing is
+// registered if it returns error.
+func NewMetrics(options ...Option) (*Metrics, error) {
+	config := &Config{
+		registerer:     prometheus.DefaultRegisterer,
+		latencyBuckets: defaultLatencyBuckets,
+	}
+	for _, option := range options {
+		option(config)
+	}
+
+	var collectors []prometheus.Collector
+	add := func(collector prometheus.Collector) prometheus.Collector {
+		collectors = append(collectors, collector)
+		return collector
+	}
+
+	gauge := func(name, help string) prometheus.Gauge {
+		return add(prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace:   config.namespace,
+			Name:        name,
+			Help:        help,
+			ConstLabels: config.constLabels,
+		})).(prometheus.Gauge)
+	}
+
+	counter := func(name, help string) prometheus.Counter {
+		return add(prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace:   config.namespace,
+			Name:        name,
+			Help:        help,
+			ConstLabels: config.constLabels,
+		})).(prometheus.Counter)
+	}
+
+	counterVec := func(name, help string, labels ...string) *prometheus.CounterVec {
+		return add(prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace:   config.namespace,
+			Name:        name,
+			Help:        help,
+			ConstLabels: config.constLabels,
+		}, labels)).(*prometheus.CounterVec)
+	}
+
+	histogram := func(name, help string, buckets []float64) prometheus.Histogram {
+		return add(prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace:   config.namespace,
+			Name:        name,
+			Help:        help,
+			ConstLabels: config.constLabels,
+			Buckets:     buckets,
+		})).(prometheus.Histogram)
+	}
+
+	histogramVec := func(name, help string, labels ...string) *prometheus.HistogramVec {
+		return add(prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace:   config.namespace,
+			Name:        name,
+			Help:        help,
+			ConstLabels: config.constLabels,
+			Buckets:     config.latencyBuckets,
+		}, labels)).(*prometheus.HistogramVec)
+	}
+
+	m := &Metrics{
+		openConnections:    gauge("open_connections", "Total number of open connections"),
+		privateConnections: gauge("private_connections", "Total number of private connections"),
+		privateConnectionsSet: gauge(
+			"private_connections_storage_length",
+			"Total number of private connections based on the length of storage",
+		),
+		openConnectionsSet: gauge(
+			"open_connections_storage_length",
+			"Total number of open connections based on the length of storage",
+		),
+		subscribedChannelsSet: gauge(
+			"subscribed_channels_storage_length",
+			"Total number of subscribed channels based on the length of storage",
+		),
+		expiredTokens: counter("expired_tokens_total", "Total number of expired tokens that have been revoked"),
+		reauthenticatedTokens: counter(
+			"reauthenticated_tokens_total",
+			"Total number of expired tokens that have been re-authenticated",
+		),
+		messagesPublished: counterVec("messages_published_total", "Total number of published messages", labelChannel),
+		messagesDelivered: counterVec(
+			"messages_delivered_total",
+			"Total number of messages that have been sent to the connections outbound buffer",
+			labelChannel,
+		),
+		messagesDropped: counterVec(
+			"messages_dropped_total",
+			"Total number of messages that couldn't be sent to the connections",
+			labelChannel, labelReason,
+		),
+		bufferFull: counter(
+			"outbound_buffer_full_total",
+			"Total number of outbound messages that have been rejected by the full buffer",
+		),
+		authFailures:    counter("auth_failures_total", "Total number of failed authentications"),
+		subscriptions:   counterVec("subscriptions_total", "Total number of subscriptions", labelChannel),
+		unsubscriptions: counterVec("unsubscriptions_total", "Total number of removed subscriptions", labelChannel),
+		queueLatency: histogram(
+			"outbound_queue_latency_seconds",
+			"Time between sending a message to the outbound buffer and writing it to the peer",
+			config.latencyBuckets,
+		),
+		writeDuration: histogram(
+			"write_duration_seconds",
+			"Time of writing a message to the websocket connection",
+			config.latencyBuckets,
+		),
+		bufferOccupancy: histogram(
+			"outbound_buffer_occupancy_ratio",
+			"Ratio of the used outbound buffer capacity when a message is enqueued",
+			occupancyBuckets,
+		),
+		marshalDuration: histogramVec(
+			"marshal_duration_seconds",
+			"Time of serializing a published message",
+			labelChannel,
+		),
+		fanoutDuration: histogramVec(
+			"fanout_duration_seconds",
+			"Time of sending a published message to all the connections of the channel",
+			labelChannel,
+		),
+		fanoutQueueLength: gauge("fanout_queue_length", "Number of fan-out tasks that are waiting in the fan-out queues"),
+		fanoutQueueLatency: histogram(
+			"fanout_queue_latency_seconds",
+			"Time that a fan-out task waited in the fan-out queue before a worker picked it",
+			config.latencyBuckets,
+		),
+	}
+
+	for i, collector := range collectors {
+		if err := config.registerer.Register(collector); err != nil {
+			for _, registered := range collectors[:i] {
+				config.registerer.Unregister(registered)
+			}
+
+			return nil, fmt.Errorf(
+				"failed to register the metrics, use a distinct registerer, namespace, or const labels: %w",
+				err,
+			)
+		}
+	}
+
+	return m, nil
+}
+
+// OpenConnectionsInc increases the total number of open connections.
+func (m *Metrics) OpenConnectionsInc() {
+	m.openConnections.Inc()
+}
+
+// OpenConnectionsDec decreases the total number of open connections.
+func (m *Metrics) OpenConnectionsDec() {
+	m.openConnections.Dec()
+}
+
+// PrivateConnectionsInc increases the total number of private connections.
+func (m *Metrics) PrivateConnectionsInc() {
+	m.privateConnections.Inc()
+}
+
+// PrivateConnectionsDec decreases the total number of private connections.
+func (m *Metrics) PrivateConnectionsDec() {
+	m.privateConnections.Dec()
+}
+
+func (m *Metrics) PrivateConnections(in float64) {
+	m.privateConnectionsSet.Set(in)
+}
+
+func (m *Metrics) OpenConnections(in float64) {
+	m.openConnectionsSet.Set(in)
+}
+
+func (m *Metrics) SubscribedChannels(in float64) {
+	m.subscribedChannelsSet.Set(in)
+}
+
+// ExpiredTokensInc increases the total number of revoked expired tokens.
+func (m *Metrics) ExpiredTokensInc() {
+	m.expiredTokens.Inc()
+}
+
+// ReauthenticatedTokensInc increases the total number of re-authenticated tokens.
+func (m *Metrics) ReauthenticatedTokensInc() {
+	m.reauthenticatedTokens.Inc()
+}
+
+// MessagesPublishedInc increases the total number of published messages of
+// the input channel.
+func (m *Metrics) MessagesPublishedInc(ch string) {
+	m.messagesPublished.WithLabelValues(ch).Inc()
+}
+
+// MessagesDeliveredInc increases the total number of delivered messages of
+// the input channel.
+func (m *Metrics) MessagesDeliveredInc(ch string) {
+	m.messagesDelivered.WithLabelValues(ch).Inc()
+}
+
+// MessagesDroppedInc increases the total number of dropped messages of the
+// input channel and reason.
+func (m *Metrics) MessagesDroppedInc(ch string, reason string) {
+	m.messagesDropped.WithLabelValues(ch, reason).Inc()
+}
+
+// BufferFullInc increases the total number of rejected outbound messages
+// because of the full buffer.
+func (m *Metrics) BufferFullInc() {
+	m.bufferFull.Inc()
+}
+
+// AuthFailuresInc increases the total number of failed authentications.
+func (m *Metrics) AuthFailuresInc() {
+	m.authFailures.Inc()
+}
+
+// SubscriptionsInc increases the total number of subscriptions of the input channel.
+func (m *Metrics) SubscriptionsInc(ch string) {
+	m.subscriptions.WithLabelValues(ch).Inc()
+}
+
+// UnsubscriptionsInc increases the total number of removed subscriptions of
+// the input channel.
+func (m *Metrics) UnsubscriptionsInc(ch string) {
+	m.unsubscriptions.WithLabelValues(ch).Inc()
+}
+
+// QueueLatencyObserve observes the time that a message waited in the outbound
+// buffer.
+func (m *Metrics) QueueLatencyObserve(d time.Duration) {
+	m.queueLatency.Observe(d.Seconds())
+}
+
+// WriteDurationObserve observes the time of writing a message to the peer.
+func (m *Metrics) WriteDurationObserve(d time.Duration) {
+	m.writeDuration.Observe(d.Seconds())
+}
+
+// BufferOccupancyObserve observes the ratio of the used outbound buffer capacity.
+func (m *Metrics) BufferOccupancyObserve(ratio float64) {
+	m.bufferOccupancy.Observe(ratio)
+}
+
+// MarshalDurationObserve observes the time of serializing a message of the
+// input channel.
+func (m *Metrics) MarshalDurationObserve(ch string, d time.Duration) {
+	m.marshalDuration.WithLabelValues(ch).Observe(d.Seconds())
+}
+
+// FanoutDurationObserve observes the time of sending a message of the input
+// channel to all its connections.
+func (m *Metrics) FanoutDurationObserve(ch string, d time.Duration) {
+	m.fanoutDuration.WithLabelValues(ch).Observe(d.Seconds())
+}
+
+// FanoutQueueLength sets the number of queued fan-out tasks.
+func (m *Metrics) FanoutQueueLength(in float64) {
+	m.fanoutQueueLength.Set(in)
+}
+
+// FanoutQueueLatencyObserve observes the time that a fan-out task waited in
+// the fan-out queue.
+func (m *Metrics) FanoutQueueLatencyObserve(d time.Duration) {
+	m.fanoutQueueLatency.Observe(d.Seconds())
+}
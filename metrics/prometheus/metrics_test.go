@@ -0,0 +1,315 @@
+/**
+ * Copyright © 2022 Hamed Yousefi <hdyousefi@gmail.com>.
+ */
+
+package prometheus
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetrics(t *testing.T) {
+	collector := newTestMetrics()
+
+	assert.True(t, strings.Contains(collector.openConnections.Desc().String(), "\"open_connections\""))
+	assert.True(t, strings.Contains(collector.privateConnections.Desc().String(), "\"private_connections\""))
+}
+
+func TestMetrics_OpenConnectionsInc(t *testing.T) {
+	t.Run("test open connection inc", func(t *testing.T) {
+		collector := newTestMetrics()
+		assert.Equal(t, float64(0), testutil.ToFloat64(collector.openConnections))
+		collector.OpenConnectionsInc()
+		assert.Equal(t, float64(1), testutil.ToFloat64(collector.openConnections))
+	})
+
+	t.Run("test parallel open connection inc", func(t *testing.T) {
+		collector := newTestMetrics()
+		wg := new(sync.WaitGroup)
+		n := 10
+		wg.Add(n)
+		for i := 0; i < n; i++ {
+			go func() {
+				defer wg.Done()
+				collector.OpenConnectionsInc()
+			}()
+		}
+
+		wg.Wait()
+		assert.Equal(t, float64(10), testutil.ToFloat64(collector.openConnections))
+	})
+}
+
+func TestMetrics_OpenConnectionsDec(t *testing.T) {
+	t.Run("test open connection dec", func(t *testing.T) {
+		collector := newTestMetrics()
+		collector.openConnections.Add(2)
+		assert.Equal(t, float64(2), testutil.ToFloat64(collector.openConnections))
+		collector.OpenConnectionsDec()
+		assert.Equal(t, float64(1), testutil.ToFloat64(collector.openConnections))
+	})
+
+	t.Run("test parallel open connection dec", func(t *testing.T) {
+		collector := newTestMetrics()
+		wg := new(sync.WaitGroup)
+		n := 10
+		collector.openConnections.Add(float64(n))
+		wg.Add(n)
+		for i := 0; i < n; i++ {
+			go func() {
+				defer wg.Done()
+				collector.OpenConnectionsDec()
+			}()
+		}
+
+		wg.Wait()
+		assert.Equal(t, float64(0), testutil.ToFloat64(collector.openConnections))
+	})
+}
+
+func TestMetrics_PrivateConnectionsInc(t *testing.T) {
+	t.Run("test private connection inc", func(t *testing.T) {
+		collector := newTestMetrics()
+		assert.Equal(t, float64(0), testutil.ToFloat64(collector.privateConnections))
+		collector.PrivateConnectionsInc()
+		assert.Equal(t, float64(1), testutil.ToFloat64(collector.privateConnections))
+	})
+
+	t.Run("test parallel private connection inc", func(t *testing.T) {
+		collector := newTestMetrics()
+		wg := new(sync.WaitGroup)
+		n := 10
+		wg.Add(n)
+		for i := 0; i < n; i++ {
+			go func() {
+				defer wg.Done()
+				collector.PrivateConnectionsInc()
+			}()
+		}
+
+		wg.Wait()
+		assert.Equal(t, float64(10), testutil.ToFloat64(collector.privateConnections))
+	})
+}
+
+func TestMetrics_PrivateConnectionsDec(t *testing.T) {
+	t.Run("test private connection dec", func(t *testing.T) {
+		collector := newTestMetrics()
+		collector.privateConnections.Add(2)
+		assert.Equal(t, float64(2), testutil.ToFloat64(collector.privateConnections))
+		collector.PrivateConnectionsDec()
+		assert.Equal(t, float64(1), testutil.ToFloat64(collector.privateConnections))
+	})
+
+	t.Run("test parallel private connection dec", func(t *testing.T) {
+		collector := newTestMetrics()
+		wg := new(sync.WaitGroup)
+		n := 10
+		collector.privateConnections.Add(float64(n))
+		wg.Add(n)
+		for i := 0; i < n; i++ {
+			go func() {
+				defer wg.Done()
+				collector.PrivateConnectionsDec()
+			}()
+		}
+
+		wg.Wait()
+		assert.Equal(t, float64(0), testutil.ToFloat64(collector.privateConnections))
+	})
+}
+
+func TestMetrics_PrivateConnectionsSet(t *testing.T) {
+	t.Run("test private connection set", func(t *testing.T) {
+		collector := newTestMetrics()
+		collector.PrivateConnections(2)
+		assert.Equal(t, float64(2), testutil.ToFloat64(collector.privateConnectionsSet))
+	})
+}
+
+func TestMetrics_OpenConnectionsSet(t *testing.T) {
+	t.Run("test private connection set", func(t *testing.T) {
+		collector := newTestMetrics()
+		collector.OpenConnections(2)
+		assert.Equal(t, float64(2), testutil.ToFloat64(collector.openConnectionsSet))
+	})
+}
+
+func TestMetrics_SubscribedChannels(t *testing.T) {
+	t.Run("test private connection set", func(t *testing.T) {
+		collector := newTestMetrics()
+		collector.SubscribedChannels(2)
+		assert.Equal(t, float64(2), testutil.ToFloat64(collector.subscribedChannelsSet))
+	})
+}
+
+func TestMetrics_ExpiredTokensInc(t *testing.T) {
+	collector := newTestMetrics()
+	collector.ExpiredTokensInc()
+	assert.Equal(t, float64(1), testutil.ToFloat64(collector.expiredTokens))
+}
+
+func TestMetrics_ReauthenticatedTokensInc(t *testing.T) {
+	collector := newTestMetrics()
+	collector.ReauthenticatedTokensInc()
+	assert.Equal(t, float64(1), testutil.ToFloat64(collector.reauthenticatedTokens))
+}
+
+func TestNewMetrics_DuplicateRegistration(t *testing.T) {
+	t.Run("same registerer", func(t *testing.T) {
+		registry := prometheus.NewRegistry()
+		_, err := NewMetrics(WithRegisterer(registry))
+		require.NoError(t, err)
+
+		collector, err := NewMetrics(WithRegisterer(registry))
+		assert.Error(t, err)
+		assert.Nil(t, collector)
+	})
+
+	t.Run("distinct const labels", func(t *testing.T) {
+		registry := prometheus.NewRegistry()
+		collector1, err := NewMetrics(
+			WithRegisterer(registry),
+			WithConstLabels(prometheus.Labels{"instance": "node-1"}),
+		)
+		require.NoError(t, err)
+
+		collector2, err := NewMetrics(
+			WithRegisterer(registry),
+			WithConstLabels(prometheus.Labels{"instance": "node-2"}),
+		)
+		require.NoError(t, err)
+
+		collector1.OpenConnectionsInc()
+		assert.Equal(t, float64(1), testutil.ToFloat64(collector1.openConnections))
+		assert.Equal(t, float64(0), testutil.ToFloat64(collector2.openConnections))
+	})
+
+	t.Run("failed registration registers nothing", func(t *testing.T) {
+		registry := prometheus.NewRegistry()
+		require.NoError(t, registry.Register(prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "private_connections",
+			Help: "Total number of private connections",
+		})))
+
+		_, err := NewMetrics(WithRegisterer(registry))
+		assert.Error(t, err)
+		assert.Equal(t, 1, testutil.CollectAndCount(registry))
+	})
+}
+
+func TestNewMetrics_Options(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	collector, err := NewMetrics(
+		WithRegisterer(registry),
+		WithNamespace("channelize"),
+		WithConstLabels(prometheus.Labels{"instance": "node-1"}),
+	)
+	require.NoError(t, err)
+
+	// all the metrics are registered.
+	collector.MessagesPublishedInc("feed")
+	collector.MessagesDeliveredInc("feed")
+	collector.MessagesDroppedInc("feed", "buffer_full")
+	collector.SubscriptionsInc("feed")
+	collector.UnsubscriptionsInc("feed")
+	collector.MarshalDurationObserve("feed", time.Millisecond)
+	collector.FanoutDurationObserve("feed", time.Millisecond)
+	assert.Equal(t, 21, testutil.CollectAndCount(registry))
+
+	expected := `
+# HELP channelize_open_connections Total number of open connections
+# TYPE channelize_open_connections gauge
+channelize_open_connections{instance="node-1"} 1
+`
+	collector.OpenConnectionsInc()
+	assert.Nil(t, testutil.GatherAndCompare(registry, strings.NewReader(expected), "channelize_open_connections"))
+}
+
+func TestMetrics_Messages(t *testing.T) {
+	collector := newTestMetrics()
+	collector.MessagesPublishedInc("feed")
+	collector.MessagesDeliveredInc("feed")
+	collector.MessagesDeliveredInc("feed")
+	collector.MessagesDroppedInc("feed", "buffer_full")
+
+	assert.Equal(t, float64(1), testutil.ToFloat64(collector.messagesPublished.WithLabelValues("feed")))
+	assert.Equal(t, float64(2), testutil.ToFloat64(collector.messagesDelivered.WithLabelValues("feed")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(collector.messagesDropped.WithLabelValues("feed", "buffer_full")))
+}
+
+func TestMetrics_BufferFullInc(t *testing.T) {
+	collector := newTestMetrics()
+	collector.BufferFullInc()
+	assert.Equal(t, float64(1), testutil.ToFloat64(collector.bufferFull))
+}
+
+func TestMetrics_AuthFailuresInc(t *testing.T) {
+	collector := newTestMetrics()
+	collector.AuthFailuresInc()
+	assert.Equal(t, float64(1), testutil.ToFloat64(collector.authFailures))
+}
+
+func TestMetrics_Subscriptions(t *testing.T) {
+	collector := newTestMetrics()
+	collector.SubscriptionsInc("feed")
+	collector.SubscriptionsInc("feed")
+	collector.UnsubscriptionsInc("feed")
+
+	assert.Equal(t, float64(2), testutil.ToFloat64(collector.subscriptions.WithLabelValues("feed")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(collector.unsubscriptions.WithLabelValues("feed")))
+}
+
+func TestMetrics_Latencies(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	collector, err := NewMetrics(WithRegisterer(registry), WithLatencyBuckets([]float64{0.001, 0.01}))
+	require.NoError(t, err)
+	collector.QueueLatencyObserve(5 * time.Millisecond)
+	collector.WriteDurationObserve(time.Millisecond)
+	collector.BufferOccupancyObserve(0.5)
+	collector.MarshalDurationObserve("feed", time.Millisecond)
+	collector.FanoutDurationObserve("feed", 20*time.Millisecond)
+	collector.FanoutQueueLatencyObserve(2 * time.Millisecond)
+
+	expected := `
+# HELP outbound_queue_latency_seconds Time between sending a message to the outbound buffer and writing it to the peer
+# TYPE outbound_queue_latency_seconds histogram
+outbound_queue_latency_seconds_bucket{le="0.001"} 0
+outbound_queue_latency_seconds_bucket{le="0.01"} 1
+outbound_queue_latency_seconds_bucket{le="+Inf"} 1
+outbound_queue_latency_seconds_sum 0.005
+outbound_queue_latency_seconds_count 1
+# HELP fanout_duration_seconds Time of sending a published message to all the connections of the channel
+# TYPE fanout_duration_seconds histogram
+fanout_duration_seconds_bucket{channel="feed",le="0.001"} 0
+fanout_duration_seconds_bucket{channel="feed",le="0.01"} 0
+fanout_duration_seconds_bucket{channel="feed",le="+Inf"} 1
+fanout_duration_seconds_sum{channel="feed"} 0.02
+fanout_duration_seconds_count{channel="feed"} 1
+`
+	assert.Nil(t, testutil.GatherAndCompare(
+		registry, strings.NewReader(expected),
+		"outbound_queue_latency_seconds", "fanout_duration_seconds",
+	))
+	assert.Equal(t, 1, testutil.CollectAndCount(collector.writeDuration))
+	assert.Equal(t, 1, testutil.CollectAndCount(collector.bufferOccupancy))
+	assert.Equal(t, 1, testutil.CollectAndCount(collector.marshalDuration))
+	assert.Equal(t, 1, testutil.CollectAndCount(collector.fanoutQueueLatency))
+}
+
+func newTestMetrics() *Metrics {
+	collector, err := NewMetrics(WithRegisterer(prometheus.NewRegistry()))
+	if err != nil {
+		panic(err)
+	}
+
+	return collector
+}